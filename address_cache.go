@@ -0,0 +1,229 @@
+package leafy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"runtime"
+	"sync"
+)
+
+const (
+	addressCacheMagic   = "LFAC"
+	addressCacheVersion = 1
+	// addressCacheHeaderLen is the magic, version, wallet id and count
+	addressCacheHeaderLen = 4 + 1 + sha256.Size + 4
+	// addressCacheKeyLen is the x-only output key stored per address
+	addressCacheKeyLen = 32
+	// addressCacheParallelMin is the fewest addresses, per goroutine, worth deriving in parallel
+	addressCacheParallelMin = 16
+)
+
+// AddressCache maps the output scripts of a wallet's Leafy addresses to their derivation index. It is built
+// incrementally, see Extend, and can be persisted via MarshalBinary and LoadAddressCache. It is an AddressIndexer
+// and is safe for concurrent use.
+type AddressCache struct {
+	params   *chaincfg.Params
+	deriver  *addressDeriver
+	walletId [sha256.Size]byte
+	mutex    sync.RWMutex
+	// keys are the x-only output keys of addresses 0 through len(keys)-1
+	keys    [][]byte
+	indices map[string]uint32
+}
+
+// NewAddressCache creates an empty AddressCache for the ExternalChain of 'wallet'
+func NewAddressCache(params *chaincfg.Params, wallet RecoveryWallet) (*AddressCache, error) {
+	return NewChainAddressCache(params, wallet, ExternalChain)
+}
+
+// NewChainAddressCache creates an empty AddressCache for 'chain' of 'wallet'
+func NewChainAddressCache(params *chaincfg.Params, wallet RecoveryWallet, chain uint32) (*AddressCache, error) {
+	deriver, err := newAddressDeriver(params, wallet, addressBranch{chain: chain})
+	if err != nil {
+		return nil, err
+	}
+	return newAddressCache(params, deriver), nil
+}
+
+func newAddressCache(params *chaincfg.Params, deriver *addressDeriver) *AddressCache {
+	return &AddressCache{
+		params:   params,
+		deriver:  deriver,
+		walletId: addressCacheWalletId(params, deriver),
+		keys:     make([][]byte, 0),
+		indices:  make(map[string]uint32),
+	}
+}
+
+// LoadAddressCache restores an AddressCache for the ExternalChain of 'wallet' from 'data' (as returned by
+// MarshalBinary). It is an error if 'data' is for another wallet, chain, network or timelock.
+func LoadAddressCache(params *chaincfg.Params, wallet RecoveryWallet, data []byte) (*AddressCache, error) {
+	return LoadChainAddressCache(params, wallet, ExternalChain, data)
+}
+
+// LoadChainAddressCache is LoadAddressCache for 'chain' of 'wallet'
+func LoadChainAddressCache(params *chaincfg.Params, wallet RecoveryWallet, chain uint32, data []byte) (*AddressCache, error) {
+	cache, err := NewChainAddressCache(params, wallet, chain)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < addressCacheHeaderLen || string(data[:4]) != addressCacheMagic {
+		return nil, errors.New("invalid address cache; missing header")
+	}
+	if data[4] != addressCacheVersion {
+		return nil, fmt.Errorf("unsupported address cache version %d", data[4])
+	}
+	if !bytes.Equal(data[5:5+sha256.Size], cache.walletId[:]) {
+		return nil, errors.New("address cache is for a different wallet")
+	}
+	count := binary.BigEndian.Uint32(data[5+sha256.Size : addressCacheHeaderLen])
+	if uint64(len(data)-addressCacheHeaderLen) != uint64(count)*addressCacheKeyLen {
+		return nil, fmt.Errorf("invalid address cache; expecting %d addresses", count)
+	}
+	for index := uint32(0); index < count; index++ {
+		offset := addressCacheHeaderLen + int(index)*addressCacheKeyLen
+		key := make([]byte, addressCacheKeyLen)
+		copy(key, data[offset:offset+addressCacheKeyLen])
+		cache.keys = append(cache.keys, key)
+		cache.indices[string(key)] = index
+	}
+	return cache, nil
+}
+
+// MarshalBinary serializes the cache as a header followed by the 32 byte output key of each address
+func (c *AddressCache) MarshalBinary() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	data := make([]byte, 0, addressCacheHeaderLen+len(c.keys)*addressCacheKeyLen)
+	data = append(data, addressCacheMagic...)
+	data = append(data, addressCacheVersion)
+	data = append(data, c.walletId[:]...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(c.keys)))
+	for _, key := range c.keys {
+		data = append(data, key...)
+	}
+	return data, nil
+}
+
+// Len is the number of cached addresses, which are those of indices 0 through Len()-1
+func (c *AddressCache) Len() uint32 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return uint32(len(c.keys))
+}
+
+// Chain is the chain of the cached addresses
+func (c *AddressCache) Chain() uint32 {
+	return c.deriver.chain
+}
+
+// IndexOf implements AddressIndexer
+func (c *AddressCache) IndexOf(script []byte) (AddressDerivation, bool) {
+	if len(script) != 2+addressCacheKeyLen || script[0] != txscript.OP_1 || script[1] != txscript.OP_DATA_32 {
+		return AddressDerivation{}, false
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	index, found := c.indices[string(script[2:])]
+	return AddressDerivation{Chain: c.deriver.chain, Index: index, Legacy: c.deriver.legacy}, found
+}
+
+// EnsureIndex extends the cache, if necessary, so that it includes address 'index'
+func (c *AddressCache) EnsureIndex(index uint32) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.extendTo(uint64(index) + 1)
+}
+
+// Extend derives and caches the next 'num' addresses, in parallel across goroutines
+func (c *AddressCache) Extend(num uint32) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.extendTo(uint64(len(c.keys)) + uint64(num))
+}
+
+// extendTo derives and caches the addresses up to, excluding, index 'target'; the write lock must be held
+func (c *AddressCache) extendTo(target uint64) error {
+	start := uint32(len(c.keys))
+	if target <= uint64(start) {
+		return nil
+	}
+	if target > hdkeychain.HardenedKeyStart {
+		return fmt.Errorf("exhausted address indices at %d", start)
+	}
+	num := uint32(target - uint64(start))
+	keys := make([][]byte, num)
+	workers := runtime.NumCPU()
+	if perWorker := int(num) / addressCacheParallelMin; perWorker < workers {
+		workers = perWorker
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, workers)
+	var group sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		group.Add(1)
+		go func(worker int) {
+			defer group.Done()
+			for i := worker; i < len(keys); i += workers {
+				script, err := c.deriver.scriptAt(start + uint32(i))
+				if err != nil {
+					errs[worker] = err
+					return
+				}
+				keys[i] = script[2:]
+			}
+		}(worker)
+	}
+	group.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		c.keys = append(c.keys, key)
+		c.indices[string(key)] = start + uint32(i)
+	}
+	return nil
+}
+
+// GetAddresses is like GetChainAddresses for the cache's wallet and chain but resolves cached addresses without derivation,
+// extending the cache as needed
+func (c *AddressCache) GetAddresses(startIndex uint32, num uint32) ([]string, error) {
+	if num < 1 {
+		return nil, fmt.Errorf("invalid amount of addresses [%d], must be greater than 0", num)
+	}
+	if uint64(startIndex)+uint64(num) > hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("invalid addresses [%d, %d), must be less than %d", startIndex,
+			uint64(startIndex)+uint64(num), hdkeychain.HardenedKeyStart)
+	}
+	if err := c.EnsureIndex(startIndex + num - 1); err != nil {
+		return nil, err
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	addresses := make([]string, num)
+	for i := range addresses {
+		address, err := btcutil.NewAddressTaproot(c.keys[startIndex+uint32(i)], c.params)
+		if err != nil {
+			return nil, err
+		}
+		addresses[i] = address.EncodeAddress()
+	}
+	return addresses, nil
+}
+
+// addressCacheWalletId identifies the addresses derived by 'deriver'
+func addressCacheWalletId(params *chaincfg.Params, deriver *addressDeriver) [sha256.Size]byte {
+	// the descriptors include the coin type, account and chain
+	return sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%d", params.Name,
+		deriver.firstKey.GetTaprootParentDescriptorWithoutChecksum(""),
+		deriver.secondKey.GetTaprootParentDescriptorWithoutChecksum(""), deriver.timelock)))
+}
@@ -0,0 +1,126 @@
+package leafy_test
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestAddressCache(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	expected, err := leafy.GetAddresses(params, wallet, 0, 120)
+	require.NoError(t, err)
+
+	cache, err := leafy.NewAddressCache(params, wallet)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, cache.Len())
+	require.NoError(t, cache.Extend(3))
+	require.NoError(t, cache.Extend(97))
+	require.EqualValues(t, 100, cache.Len())
+	addresses, err := cache.GetAddresses(0, 100)
+	require.NoError(t, err)
+	require.Equal(t, expected[:100], addresses)
+	// extends as needed
+	addresses, err = cache.GetAddresses(110, 10)
+	require.NoError(t, err)
+	require.Equal(t, expected[110:], addresses)
+	require.EqualValues(t, 120, cache.Len())
+	require.NoError(t, cache.EnsureIndex(5))
+	require.EqualValues(t, 120, cache.Len())
+	for index, address := range expected {
+		found, ok := cache.IndexOf(addressScript(t, params, address))
+		require.True(t, ok)
+		require.Equal(t, leafy.AddressDerivation{Chain: leafy.ExternalChain, Index: uint32(index)}, found)
+	}
+	_, ok := cache.IndexOf([]byte{0x51, 0x20})
+	require.False(t, ok)
+	_, err = cache.GetAddresses(0, 0)
+	require.Error(t, err)
+
+	// persisted
+	data, err := cache.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, 4+1+32+4+120*32, len(data))
+	loaded, err := leafy.LoadAddressCache(params, wallet, data)
+	require.NoError(t, err)
+	require.EqualValues(t, 120, loaded.Len())
+	addresses, err = loaded.GetAddresses(0, 120)
+	require.NoError(t, err)
+	require.Equal(t, expected, addresses)
+	found, ok := loaded.IndexOf(addressScript(t, params, expected[42]))
+	require.True(t, ok)
+	require.Equal(t, leafy.AddressDerivation{Chain: leafy.ExternalChain, Index: 42}, found)
+
+	// for a different wallet, timelock or network
+	other, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	_, err = leafy.LoadAddressCache(params, other, data)
+	require.Error(t, err)
+	timelockWallet, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic, &leafy.WalletConfig{Timelock: 144})
+	require.NoError(t, err)
+	_, err = leafy.LoadAddressCache(params, timelockWallet, data)
+	require.Error(t, err)
+	_, err = leafy.LoadAddressCache(&chaincfg.TestNet3Params, wallet, data)
+	require.Error(t, err)
+	// corrupt
+	_, err = leafy.LoadAddressCache(params, wallet, data[:len(data)-1])
+	require.Error(t, err)
+	_, err = leafy.LoadAddressCache(params, wallet, data[:10])
+	require.Error(t, err)
+	corrupt := append([]byte{}, data...)
+	corrupt[4] = 2
+	_, err = leafy.LoadAddressCache(params, wallet, corrupt)
+	require.Error(t, err)
+}
+
+func TestAddressCacheConcurrentUse(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	cache, err := leafy.NewAddressCache(params, wallet)
+	require.NoError(t, err)
+	var group sync.WaitGroup
+	for i := uint32(0); i < 4; i++ {
+		group.Add(1)
+		go func(index uint32) {
+			defer group.Done()
+			require.NoError(t, cache.EnsureIndex(index*50))
+		}(i)
+	}
+	group.Wait()
+	require.EqualValues(t, 151, cache.Len())
+}
+
+func TestAddressCacheIndexBounds(t *testing.T) {
+	cache, err := leafy.NewAddressCache(&chaincfg.RegressionNetParams, leafy.NewWallet(seedMnemonic, seedMnemonic))
+	require.NoError(t, err)
+	// the range would overflow uint32 and wrap to index 0
+	_, err = cache.GetAddresses(math.MaxUint32, 2)
+	require.Error(t, err)
+	_, err = cache.GetAddresses(hdkeychain.HardenedKeyStart, 1)
+	require.Error(t, err)
+	require.Error(t, cache.EnsureIndex(hdkeychain.HardenedKeyStart))
+	require.EqualValues(t, 0, cache.Len())
+}
+
+func TestSignTransactionWithAddressCache(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	utxos := []leafy.Utxo{indexedUtxo(t, params, wallet, 7, 10000), indexedUtxo(t, params, wallet, 1200, 20000)}
+	destAddress, err := btcutil.DecodeAddress(utxos[0].FromAddress, params)
+	require.NoError(t, err)
+	tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 25000, 2)
+	require.NoError(t, err)
+
+	cache, err := leafy.NewAddressCache(params, wallet)
+	require.NoError(t, err)
+	require.NoError(t, cache.EnsureIndex(1200))
+	signed, err := leafy.SignTransactionWithIndexer(params, wallet, tx, cache)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+}
@@ -0,0 +1,173 @@
+package leafy
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Recipient is an output of a transaction. An 'Amount' of zero is "send max"; i.e. the recipient receives all
+// available coins after the other recipients and fees are paid.
+type Recipient struct {
+	Address btcutil.Address
+	Amount  int64
+}
+
+// IsSendMax returns true if the recipient receives all remaining coins
+func (r Recipient) IsSendMax() bool {
+	return r.Amount == 0
+}
+
+// CreateBatchTransaction constructs a transaction using the provided 'utxos' paying each of the 'recipients'. If
+// change is required, the change will be sent to the provided 'changeAddr'. Fees will be determined based on the
+// provided 'feeRate' (in sat/vByte). At most one recipient may be "send max", in which case all 'utxos' are spent
+// and there is no change. No recipient may receive a dust amount.
+//
+// If 'selector' is nil (or there is a "send max" recipient) the 'utxos' are spent in order, as in CreateTransaction,
+// otherwise the 'selector' chooses the 'utxos'.
+func CreateBatchTransaction(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	recipients []Recipient,
+	feeRate float64,
+	selector CoinSelector,
+) (*TransactionInfo, error) {
+	return createBatchTransaction(utxos, changeAddr, recipients, feeRate, selector, KeyPathSpend, 0)
+}
+
+// CreateBatchRecoveryTransaction is like CreateBatchTransaction but fees are estimated for spending the 'utxos'
+// via the timelock script path, see SignRecoveryTransaction, of the DefaultWalletConfig's timelock.
+func CreateBatchRecoveryTransaction(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	recipients []Recipient,
+	feeRate float64,
+	selector CoinSelector,
+) (*TransactionInfo, error) {
+	return createBatchTransaction(utxos, changeAddr, recipients, feeRate, selector, RecoveryPathSpend, 0)
+}
+
+// CreateAndSignBatchTransaction uses CreateBatchTransaction and signs the created transaction.
+func CreateAndSignBatchTransaction(
+	params *chaincfg.Params,
+	wallet Wallet,
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	recipients []Recipient,
+	feeRate float64,
+	selector CoinSelector,
+) (*SignedMsg, error) {
+	tx, err := CreateBatchTransaction(utxos, changeAddr, recipients, feeRate, selector)
+	if err != nil {
+		return nil, err
+	}
+	return SignTransaction(params, wallet, tx)
+}
+
+// CreateAndSignBatchRecoveryTransaction uses CreateBatchRecoveryTransaction and signs the created transaction via
+// the timelock script path.
+func CreateAndSignBatchRecoveryTransaction(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	recipients []Recipient,
+	feeRate float64,
+	selector CoinSelector,
+) (*SignedMsg, error) {
+	tx, err := createBatchTransaction(utxos, changeAddr, recipients, feeRate, selector, RecoveryPathSpend,
+		GetWalletConfig(wallet).Timelock)
+	if err != nil {
+		return nil, err
+	}
+	return SignRecoveryTransaction(params, wallet, tx)
+}
+
+func createBatchTransaction(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	recipients []Recipient,
+	feeRate float64,
+	selector CoinSelector,
+	path SpendPath,
+	timelock uint32,
+) (*TransactionInfo, error) {
+	outputs, maxIndex, _, err := recipientOutputs(recipients)
+	if err != nil {
+		return nil, err
+	}
+	for index, output := range outputs {
+		if index != maxIndex && isDust(output) {
+			return nil, fmt.Errorf("recipient %d amount %d is dust", index, output.Value)
+		}
+	}
+	tx, err := createTransactionWithCoinSelector(utxos, changeAddr, recipients, feeRate, selector, path, timelock)
+	if err != nil {
+		return nil, err
+	}
+	if maxIndex >= 0 && isDust(tx.MsgTx.TxOut[maxIndex]) {
+		return nil, fmt.Errorf("insufficient funds; send max recipient %d would receive dust amount %d",
+			maxIndex, tx.MsgTx.TxOut[maxIndex].Value)
+	}
+	return tx, nil
+}
+
+// recipientOutputs creates an output per recipient, returning the outputs, the index of the "send max" recipient
+// (or -1 if there is none) and the sum of the amounts of the other recipients.
+func recipientOutputs(recipients []Recipient) ([]*wire.TxOut, int, int64, error) {
+	if len(recipients) == 0 {
+		return nil, -1, 0, fmt.Errorf("at least one recipient is required")
+	}
+	outputs := make([]*wire.TxOut, 0, len(recipients))
+	maxIndex := -1
+	var amount int64
+	for index, recipient := range recipients {
+		if recipient.Amount < 0 {
+			return nil, -1, 0, fmt.Errorf("recipient %d has negative amount %d", index, recipient.Amount)
+		}
+		if recipient.IsSendMax() {
+			if maxIndex >= 0 {
+				return nil, -1, 0, fmt.Errorf("at most one send max recipient allowed; found %d and %d", maxIndex, index)
+			}
+			maxIndex = index
+		}
+		script, err := txscript.PayToAddrScript(recipient.Address)
+		if err != nil {
+			return nil, -1, 0, err
+		}
+		outputs = append(outputs, wire.NewTxOut(recipient.Amount, script))
+		amount += recipient.Amount
+	}
+	return outputs, maxIndex, amount, nil
+}
+
+func hasSendMaxRecipient(recipients []Recipient) bool {
+	for _, recipient := range recipients {
+		if recipient.IsSendMax() {
+			return true
+		}
+	}
+	return false
+}
+
+// isDust returns true if 'output' is at most the dust amount of its script, P2trDustAmt for P2TR as with
+// TransactionInfo.IsChangeDust
+func isDust(output *wire.TxOut) bool {
+	return output.Value <= dustAmount(output.PkScript)
+}
+
+// dustAmount is the dust threshold of an output of 'script' per Bitcoin Core's default dust relay fee of 3 sat/vByte
+// for the output and a typical input spending it; e.g. 546 for P2PKH, 294 for P2WPKH and 330 for P2TR
+func dustAmount(script []byte) int64 {
+	size := int64(wire.NewTxOut(0, script).SerializeSize())
+	if txscript.IsWitnessProgram(script) {
+		// outpoint, script length and sequence plus a signature and public key in the witness
+		size += 32 + 4 + 1 + 4 + 107/blockchain.WitnessScaleFactor
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return 3 * size
+}
@@ -0,0 +1,121 @@
+package leafy_test
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestCreateAndSignBatchTransaction(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, changeAddress := createWalletUtxos(t, params, wallet, 10000, 20000, 30000)
+	one, two := createBatchAddresses(t, params)
+
+	recipients := []leafy.Recipient{{Address: one, Amount: 15000}, {Address: two, Amount: 16000}}
+	tx, err := leafy.CreateBatchTransaction(utxos, changeAddress, recipients, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(tx.MsgTx.TxIn))
+	require.Equal(t, 3, len(tx.MsgTx.TxOut))
+	for index, recipient := range recipients {
+		script, err := txscript.PayToAddrScript(recipient.Address)
+		require.NoError(t, err)
+		require.Equal(t, script, tx.MsgTx.TxOut[index].PkScript)
+		require.EqualValues(t, recipient.Amount, tx.MsgTx.TxOut[index].Value)
+	}
+	require.EqualValues(t, tx.TxChangeAmt, tx.MsgTx.TxOut[2].Value)
+	require.EqualValues(t, 31000, tx.TxDestAmt)
+	require.EqualValues(t, tx.TxInputAmt, tx.TxDestAmt+tx.TxFeeAmt+tx.TxChangeAmt)
+
+	signed, err := leafy.CreateAndSignBatchTransaction(params, wallet, utxos, changeAddress, recipients, 2, nil)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	requireEstimatedWeight(t, tx, signed, 2)
+
+	// with a coin selector
+	tx, err = leafy.CreateBatchTransaction(utxos, changeAddress, recipients, 2, &leafy.LargestFirstCoinSelector{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(tx.MsgTx.TxIn))
+	require.EqualValues(t, 50000, tx.TxInputAmt)
+
+	// recovery
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(wallet.GetFirstMnemonic(), descriptor)
+	recoveryTx, err := leafy.CreateBatchRecoveryTransaction(utxos, changeAddress, recipients, 2, nil)
+	require.NoError(t, err)
+	signed, err = leafy.CreateAndSignBatchRecoveryTransaction(params, recoveryWallet, utxos, changeAddress, recipients, 2, nil)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	requireEstimatedWeight(t, recoveryTx, signed, 2)
+}
+
+func TestCreateBatchTransactionSendMax(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	utxos := createSelectionUtxos(10000, 20000)
+	one, two := createBatchAddresses(t, params)
+
+	tx, err := leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: 0},
+		{Address: two, Amount: 5000}}, 1, &leafy.LargestFirstCoinSelector{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(tx.MsgTx.TxIn))
+	require.Equal(t, 2, len(tx.MsgTx.TxOut))
+	require.EqualValues(t, 0, tx.TxChangeAmt)
+	require.EqualValues(t, 30000-5000-tx.TxFeeAmt, tx.MsgTx.TxOut[0].Value)
+	require.EqualValues(t, 5000, tx.MsgTx.TxOut[1].Value)
+
+	// send max would be dust
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: 0},
+		{Address: two, Amount: 29700}}, 1, nil)
+	require.Error(t, err)
+}
+
+func TestCreateBatchTransactionInvalidRecipients(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	utxos := createSelectionUtxos(10000, 20000)
+	one, two := createBatchAddresses(t, params)
+
+	_, err := leafy.CreateBatchTransaction(utxos, one, nil, 1, nil)
+	require.Error(t, err)
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one}, {Address: two}}, 1, nil)
+	require.Error(t, err)
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: -1}}, 1, nil)
+	require.Error(t, err)
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: 1000},
+		{Address: two, Amount: 100}}, 1, nil)
+	require.Error(t, err)
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: two, Amount: 1000},
+		{Address: one, Amount: leafy.P2trDustAmt}}, 1, nil)
+	require.Error(t, err)
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: two, Amount: 1000},
+		{Address: one, Amount: leafy.P2trDustAmt + 1}}, 1, nil)
+	require.NoError(t, err)
+	// dust is by the recipient's script type; 294 for P2WPKH and 546 for P2PKH
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: 1000},
+		{Address: two, Amount: 295}}, 1, nil)
+	require.NoError(t, err)
+	p2pkh, err := btcutil.DecodeAddress("mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", params)
+	require.NoError(t, err)
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: 1000},
+		{Address: p2pkh, Amount: leafy.P2trDustAmt + 1}}, 1, nil)
+	require.ErrorContains(t, err, "recipient 1 amount 331 is dust")
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: 1000},
+		{Address: p2pkh, Amount: 547}}, 1, nil)
+	require.NoError(t, err)
+	_, err = leafy.CreateBatchTransaction(utxos, one, []leafy.Recipient{{Address: one, Amount: 20000},
+		{Address: two, Amount: 10000}}, 1, nil)
+	require.Error(t, err)
+}
+
+func createBatchAddresses(t *testing.T, params *chaincfg.Params) (btcutil.Address, btcutil.Address) {
+	t.Helper()
+	one, err := btcutil.DecodeAddress("bcrt1pkm32th8q6qhhnx5l5qmf7v3s29fsdsytl5h69c05chgz9mf4yl2qwnyzzk", params)
+	require.NoError(t, err)
+	two, err := btcutil.DecodeAddress("bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", params)
+	require.NoError(t, err)
+	return one, two
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
-	"strconv"
 	"strings"
 )
 
@@ -51,7 +50,16 @@ func isHardened(path uint32) bool {
 	return path >= hdkeychain.HardenedKeyStart
 }
 
+const (
+	// ExternalChain is the BIP-44 change level of receive addresses
+	ExternalChain uint32 = 0
+	// InternalChain is the BIP-44 change level of change addresses
+	InternalChain uint32 = 1
+)
+
 type Bip44Key struct {
+	// accountKey is nil if the key was imported from a change level descriptor
+	accountKey  *hdkeychain.ExtendedKey
 	changeKey   *hdkeychain.ExtendedKey
 	indexKey    *hdkeychain.ExtendedKey
 	fingerprint string
@@ -102,6 +110,7 @@ func CreateBip44Key(
 	}
 
 	return &Bip44Key{
+		accountKey:  accountKey,
 		changeKey:   changeKey,
 		indexKey:    indexKey,
 		fingerprint: fingerprint,
@@ -185,62 +194,105 @@ func (b *Bip44Key) GetFingerprint() string {
 	return b.fingerprint
 }
 
-func ImportFromTaprootDescriptorForParentWithoutChecksum(
+// ImportFromTaprootDescriptorForParent imports the BIP-44 change level key of a "tr([fingerprint/path]xpub/path)"
+// descriptor, with or without a checksum (which, if present, is validated), and derives 'index' from it. The key
+// origin path together with any derivations following the key must go up through the BIP-44 change level; e.g.
+// "tr([fp/44'/0'/0'/0]xpub)" or "tr([fp/44'/0'/0']xpub/0/*)". For a multipath descriptor, e.g.
+// "tr([fp/44'/0'/0']xpub/<0;1>/*)", the ExternalChain is imported. Parse errors are a *DescriptorError.
+func ImportFromTaprootDescriptorForParent(
 	descriptor string,
 	index *PathItem,
 ) (*Bip44Key, error) {
-	if !strings.HasPrefix(descriptor, "tr([") {
-		return nil, fmt.Errorf("invalid tr descriptor; expecting prefix 'tr([' but was %v", descriptor)
-	}
-	fingerprint := descriptor[4:12]
-	endIndex := strings.Index(descriptor, "]")
-	derivationPath := descriptor[13:endIndex]
-	derivations := strings.Split(derivationPath, "/")
-	if len(derivations) != 4 {
-		return nil, fmt.Errorf("invalid tr descriptor; expecting derivations up through bip-44 change but was %v", derivationPath)
-	}
-	purpose, err := parsePath(derivations[0], "purpose")
-	coin, err := parsePath(derivations[1], "coin")
-	account, err := parsePath(derivations[2], "account")
-	change, err := parsePath(derivations[3], "change")
+	return importTaprootDescriptor(descriptor, nil, index)
+}
+
+// ImportFromTaprootDescriptorForChain is like ImportFromTaprootDescriptorForParent but imports the key of 'chain'
+// (ExternalChain or InternalChain). The descriptor must either be a multipath descriptor including 'chain' or be
+// for 'chain'.
+func ImportFromTaprootDescriptorForChain(
+	descriptor string,
+	chain uint32,
+	index *PathItem,
+) (*Bip44Key, error) {
+	return importTaprootDescriptor(descriptor, &chain, index)
+}
 
-	changeEpub := descriptor[endIndex+1 : len(descriptor)-1]
-	changeKey, err := hdkeychain.NewKeyFromString(changeEpub)
+// importTaprootDescriptor imports the key of 'chain' or, if nil, of whichever chain the descriptor is for
+func importTaprootDescriptor(
+	descriptor string,
+	chain *uint32,
+	index *PathItem,
+) (*Bip44Key, error) {
+	parsed, err := ParseDescriptor(descriptor)
 	if err != nil {
 		return nil, err
 	}
+	if parsed.Type != DescriptorTypeTaproot {
+		return nil, &DescriptorError{Err: ErrDescriptorUnsupportedScript, Position: 0,
+			Detail: fmt.Sprintf("expecting '%s' but was '%s'", DescriptorTypeTaproot, parsed.Type)}
+	}
+	key := parsed.Key
+	if !key.HasOrigin() {
+		return nil, &DescriptorError{Err: ErrDescriptorInvalidFingerprint, Position: len(parsed.Type) + 1,
+			Detail: "expecting key origin"}
+	}
+	if key.ExtendedKey == nil {
+		return nil, &DescriptorError{Err: ErrDescriptorInvalidKey, Position: len(parsed.Type) + 1,
+			Detail: "expecting extended key"}
+	}
+	alternative := ExternalChain
+	if chain != nil {
+		alternative = *chain
+	}
+	childPath, err := key.ChildPathFor(alternative)
+	if err != nil {
+		return nil, &DescriptorError{Err: ErrDescriptorInvalidPath, Position: len(parsed.Type) + 1, Detail: err.Error()}
+	}
+	derivations := append(append([]*PathItem{}, key.OriginPath...), childPath...)
+	if len(derivations) != 4 {
+		return nil, &DescriptorError{Err: ErrDescriptorInvalidPath, Position: len(parsed.Type) + 1,
+			Detail: fmt.Sprintf("expecting derivations up through bip-44 change but was %d levels", len(derivations))}
+	}
+	if chain != nil && derivations[3].path != *chain {
+		return nil, &DescriptorError{Err: ErrDescriptorInvalidPath, Position: len(parsed.Type) + 1,
+			Detail: fmt.Sprintf("expecting chain %d but was %s", *chain, derivations[3].getDerivationValue())}
+	}
+	var accountKey *hdkeychain.ExtendedKey
+	if len(key.OriginPath) == 3 {
+		accountKey = key.ExtendedKey
+	}
+	changeKey := key.ExtendedKey
+	for _, child := range childPath {
+		if changeKey, err = changeKey.Derive(child.path); err != nil {
+			return nil, err
+		}
+	}
 	indexKey, err := changeKey.Derive(index.path)
 	if err != nil {
 		return nil, err
 	}
 	return &Bip44Key{
+		accountKey:  accountKey,
 		changeKey:   changeKey,
 		indexKey:    indexKey,
-		fingerprint: fingerprint,
-		purpose:     purpose,
-		coin:        coin,
-		account:     account,
-		change:      change,
+		fingerprint: key.Fingerprint,
+		purpose:     derivations[0],
+		coin:        derivations[1],
+		account:     derivations[2],
+		change:      derivations[3],
 		index:       index,
 	}, nil
 }
 
-func parsePath(pathDerivation string, derivationLevel string) (*PathItem, error) {
-	var path *PathItem
-	if strings.HasSuffix(pathDerivation, "'") {
-		pathVal, err := strconv.ParseUint(pathDerivation[0:len(pathDerivation)-1], 10, 32)
-		if err != nil {
-			return nil, fmt.Errorf("could not parse %s path: %w", derivationLevel, err)
-		}
-		path = PathHardened(uint32(pathVal))
-	} else {
-		pathVal, err := strconv.ParseUint(pathDerivation, 10, 32)
-		if err != nil {
-			return nil, fmt.Errorf("could not parse %s path: %w", derivationLevel, err)
-		}
-		path = Path(uint32(pathVal))
-	}
-	return path, nil
+// ImportFromTaprootDescriptorForParentWithoutChecksum is ImportFromTaprootDescriptorForParent and so, despite its
+// name, also accepts a checksum.
+//
+// Deprecated: use ImportFromTaprootDescriptorForParent.
+func ImportFromTaprootDescriptorForParentWithoutChecksum(
+	descriptor string,
+	index *PathItem,
+) (*Bip44Key, error) {
+	return ImportFromTaprootDescriptorForParent(descriptor, index)
 }
 
 func (b *Bip44Key) GetTaprootDescriptorForParentWithoutChecksum(suffixDerivation string) string {
@@ -276,6 +328,61 @@ func (b *Bip44Key) GetTaprootParentDescriptorWithoutChecksum(suffixDerivation st
 	return fmt.Sprintf("tr([%s/%s]%s%s)", b.GetFingerprint(), b.GetParentDerivation(), epub.String(), suffixDerivation)
 }
 
+// GetTaprootAccountDescriptorWithoutChecksum returns a multipath descriptor of the BIP-44 account level key covering
+// both the ExternalChain and InternalChain; i.e. "tr([fp/44'/0'/0']xpub/<0;1>/*)". It is an error if the key was
+// imported from a change level descriptor.
+func (b *Bip44Key) GetTaprootAccountDescriptorWithoutChecksum() (string, error) {
+	if b.accountKey == nil {
+		return "", fmt.Errorf("account key unavailable; imported from a change level descriptor")
+	}
+	epub, err := b.accountKey.Neuter()
+	if err != nil {
+		return "", err
+	}
+	return b.taprootAccountDescriptor(epub), nil
+}
+
+// GetTaprootAccountPrivateDescriptor is GetTaprootAccountDescriptor with the private account level key, for import
+// into a wallet which is to sign. It is an error if the key is public.
+func (b *Bip44Key) GetTaprootAccountPrivateDescriptor() (string, error) {
+	if b.accountKey == nil || !b.accountKey.IsPrivate() {
+		return "", fmt.Errorf("private account key unavailable")
+	}
+	return AddDescriptorChecksum(b.taprootAccountDescriptor(b.accountKey))
+}
+
+func (b *Bip44Key) taprootAccountDescriptor(accountKey *hdkeychain.ExtendedKey) string {
+	return fmt.Sprintf("tr([%s/%v/%v/%v]%s/<%d;%d>/*)", b.GetFingerprint(), b.purpose.getDerivationValue(),
+		b.coin.getDerivationValue(), b.account.getDerivationValue(), accountKey.String(), ExternalChain, InternalChain)
+}
+
+// GetTaprootAccountDescriptor is GetTaprootAccountDescriptorWithoutChecksum with a BIP-380 checksum
+func (b *Bip44Key) GetTaprootAccountDescriptor() (string, error) {
+	descriptor, err := b.GetTaprootAccountDescriptorWithoutChecksum()
+	if err != nil {
+		return "", err
+	}
+	return AddDescriptorChecksum(descriptor)
+}
+
+// GetTaprootDescriptorForParent is GetTaprootDescriptorForParentWithoutChecksum with a BIP-380 checksum. It is an
+// error if 'suffixDerivation' has a character outside the descriptor character set.
+func (b *Bip44Key) GetTaprootDescriptorForParent(suffixDerivation string) (string, error) {
+	return AddDescriptorChecksum(b.GetTaprootDescriptorForParentWithoutChecksum(suffixDerivation))
+}
+
+// GetTaprootDescriptor is GetTaprootDescriptorWithoutChecksum with a BIP-380 checksum; see
+// GetTaprootDescriptorForParent
+func (b *Bip44Key) GetTaprootDescriptor(suffixDerivation string) (string, error) {
+	return AddDescriptorChecksum(b.GetTaprootDescriptorWithoutChecksum(suffixDerivation))
+}
+
+// GetTaprootParentDescriptor is GetTaprootParentDescriptorWithoutChecksum with a BIP-380 checksum; see
+// GetTaprootDescriptorForParent
+func (b *Bip44Key) GetTaprootParentDescriptor(suffixDerivation string) (string, error) {
+	return AddDescriptorChecksum(b.GetTaprootParentDescriptorWithoutChecksum(suffixDerivation))
+}
+
 func (b *Bip44Key) GetDerivation() string {
 	return fmt.Sprintf("%v/%v", b.GetParentDerivation(), b.index.getDerivationValue())
 }
@@ -290,11 +397,17 @@ func (b *Bip44Key) DeriveNextSibling() (*Bip44Key, error) {
 	if isHardened(b.index.path) {
 		siblingIndex = PathHardened(b.index.path + 1)
 	}
+	return b.DeriveSibling(siblingIndex)
+}
+
+// DeriveSibling derives the key at 'siblingIndex' of the same change level key
+func (b *Bip44Key) DeriveSibling(siblingIndex *PathItem) (*Bip44Key, error) {
 	sibling, err := b.changeKey.Derive(siblingIndex.path)
 	if err != nil {
 		return nil, err
 	}
 	return &Bip44Key{
+		accountKey:  b.accountKey,
 		changeKey:   b.changeKey,
 		indexKey:    sibling,
 		fingerprint: b.fingerprint,
@@ -339,6 +452,7 @@ func (b *Bip44Key) CopyWithNewMaster(master *hdkeychain.ExtendedKey) (*Bip44Key,
 	}
 
 	return &Bip44Key{
+		accountKey:  accountKey,
 		changeKey:   changeKey,
 		indexKey:    indexKey,
 		fingerprint: fingerprint,
@@ -118,3 +118,92 @@ func TestImportFromTaprootDescriptorForParentWithoutChecksum(t *testing.T) {
 	serialChangeEpub := deserialBip44Key.GetTaprootParentDescriptorWithoutChecksum("")
 	require.Equal(t, changeEpub, serialChangeEpub)
 }
+
+func TestTaprootAccountDescriptor(t *testing.T) {
+	master, err := hdkeychain.NewKeyFromString(masterSeed)
+	require.NoError(t, err)
+	keys := make([]*leafy.Bip44Key, 2)
+	for _, chain := range []uint32{leafy.ExternalChain, leafy.InternalChain} {
+		keys[chain], err = leafy.CreateBip44Key(master,
+			leafy.PathHardened(44),
+			leafy.PathHardened(0),
+			leafy.PathHardened(0),
+			leafy.Path(chain),
+			leafy.Path(0))
+		require.NoError(t, err)
+	}
+	account, err := keys[leafy.ExternalChain].GetTaprootAccountDescriptorWithoutChecksum()
+	require.NoError(t, err)
+	require.Regexp(t, `^tr\(\[d33e9597/44'/0'/0'\]tpub[1-9A-HJ-NP-Za-km-z]+/<0;1>/\*\)$`, account)
+	internalAccount, err := keys[leafy.InternalChain].GetTaprootAccountDescriptorWithoutChecksum()
+	require.NoError(t, err)
+	require.Equal(t, account, internalAccount)
+	checksummed, err := keys[leafy.ExternalChain].GetTaprootAccountDescriptor()
+	require.NoError(t, err)
+	stripped, err := leafy.StripDescriptorChecksum(checksummed)
+	require.NoError(t, err)
+	require.Equal(t, account, stripped)
+
+	for _, descriptor := range []string{account, checksummed} {
+		for _, chain := range []uint32{leafy.ExternalChain, leafy.InternalChain} {
+			imported, err := leafy.ImportFromTaprootDescriptorForChain(descriptor, chain, leafy.Path(0))
+			require.NoError(t, err)
+			require.Equal(t, keys[chain].GetTaprootParentDescriptorWithoutChecksum(""),
+				imported.GetTaprootParentDescriptorWithoutChecksum(""))
+			reexported, err := imported.GetTaprootAccountDescriptorWithoutChecksum()
+			require.NoError(t, err)
+			require.Equal(t, account, reexported)
+		}
+		// the ExternalChain by default
+		imported, err := leafy.ImportFromTaprootDescriptorForParent(descriptor, leafy.Path(0))
+		require.NoError(t, err)
+		require.Equal(t, keys[leafy.ExternalChain].GetTaprootParentDescriptorWithoutChecksum(""),
+			imported.GetTaprootParentDescriptorWithoutChecksum(""))
+	}
+	_, err = leafy.ImportFromTaprootDescriptorForChain(account, 2, leafy.Path(0))
+	require.Error(t, err)
+
+	// a change level descriptor is of a single chain and has no account key
+	change := keys[leafy.ExternalChain].GetTaprootParentDescriptorWithoutChecksum("")
+	imported, err := leafy.ImportFromTaprootDescriptorForChain(change, leafy.ExternalChain, leafy.Path(0))
+	require.NoError(t, err)
+	_, err = imported.GetTaprootAccountDescriptorWithoutChecksum()
+	require.Error(t, err)
+	_, err = leafy.ImportFromTaprootDescriptorForChain(change, leafy.InternalChain, leafy.Path(0))
+	require.Error(t, err)
+}
+
+func TestBip86Derivation(t *testing.T) {
+	// test vectors of https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki
+	master, err := hdkeychain.NewKeyFromString("xprv9s21ZrQH143K3GJpoapnV8SFfukcVBSfeCficPSGfubmSFDxo1kuHnLisriDvSnRRuL2Qrg5ggqHKNVpxR86QEC8w35uxmGoggxtQTPvfUu")
+	require.NoError(t, err)
+	for _, vector := range []struct {
+		chain   uint32
+		index   uint32
+		address string
+	}{
+		{leafy.ExternalChain, 0, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{leafy.ExternalChain, 1, "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"},
+		{leafy.InternalChain, 0, "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7"},
+	} {
+		key, err := leafy.CreateBip44Key(master,
+			leafy.PathHardened(leafy.PurposeBip86),
+			leafy.PathHardened(0),
+			leafy.PathHardened(0),
+			leafy.Path(vector.chain),
+			leafy.Path(vector.index))
+		require.NoError(t, err)
+		publicKey, err := key.GetPublicKey()
+		require.NoError(t, err)
+		address, err := leafy.GetTaprootAddress(publicKey, &chaincfg.MainNetParams)
+		require.NoError(t, err)
+		require.Equal(t, vector.address, address.EncodeAddress())
+
+		descriptor, err := key.GetTaprootAccountDescriptorWithoutChecksum()
+		require.NoError(t, err)
+		require.Equal(t, "tr([73c5da0a/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/<0;1>/*)", descriptor)
+		private, err := key.GetTaprootAccountPrivateDescriptor()
+		require.NoError(t, err)
+		require.Contains(t, private, "[73c5da0a/86'/0'/0']xprv")
+	}
+}
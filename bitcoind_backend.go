@@ -0,0 +1,593 @@
+package leafy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"math"
+	"sort"
+)
+
+// bitcoindListTransactionsPage is the number of wallet transactions requested per listtransactions call
+const bitcoindListTransactionsPage = 1000
+
+// BitcoindConfig configures the Bitcoin Core RPC connection of a BitcoindClient
+type BitcoindConfig struct {
+	// Host is the host:port of the node's RPC server
+	Host string
+	User string
+	Pass string
+	// CookiePath, if set, is the node's .cookie file used rather than User and Pass
+	CookiePath string
+	// Wallet is, optionally, the node's (watch-only) wallet; required by AddressTransactions and WatchAddresses
+	Wallet string
+	// TLS connects via https, as when the node is behind a TLS terminating proxy
+	TLS bool
+}
+
+// BitcoindClient is a ChainBackend of a Bitcoin Core node's RPC.
+// As Bitcoin Core has no address index, AddressUtxos scans the UTXO set (so reports confirmed utxos only) and
+// AddressTransactions lists those of addresses watched by the configured wallet; see WatchAddresses.
+type BitcoindClient struct {
+	params *chaincfg.Params
+	wallet string
+	rpc    *rpcclient.Client
+}
+
+var _ ChainBackend = (*BitcoindClient)(nil)
+var _ CompactFilterSource = (*BitcoindClient)(nil)
+var _ HistoryLookup = (*BitcoindClient)(nil)
+
+// NewBitcoindClient creates a BitcoindClient of the 'params' network's node configured by 'config'
+func NewBitcoindClient(params *chaincfg.Params, config BitcoindConfig) (*BitcoindClient, error) {
+	host := config.Host
+	if config.Wallet != "" {
+		host = fmt.Sprintf("%v/wallet/%v", host, config.Wallet)
+	}
+	rpc, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         host,
+		User:         config.User,
+		Pass:         config.Pass,
+		CookiePath:   config.CookiePath,
+		Params:       params.Name,
+		DisableTLS:   !config.TLS,
+		HTTPPostMode: true,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to bitcoin node: %w", err)
+	}
+	return &BitcoindClient{params: params, wallet: config.Wallet, rpc: rpc}, nil
+}
+
+// RpcClient is the underlying RPC client, e.g. for calls not covered by ChainBackend
+func (c *BitcoindClient) RpcClient() *rpcclient.Client {
+	return c.rpc
+}
+
+func (c *BitcoindClient) AddressUtxos(address string) ([]Utxo, error) {
+	decoded, err := btcutil.DecodeAddress(address, c.params)
+	if err != nil {
+		return nil, err
+	}
+	if !decoded.IsForNet(c.params) {
+		return nil, fmt.Errorf("address %v is not for network %v", address, c.params.Name)
+	}
+	script, err := txscript.PayToAddrScript(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return c.ScanUtxos([][]byte{script})
+}
+
+// ScanUtxos returns the confirmed utxos of 'scripts', e.g. those of GetAddresses, via a single scantxoutset of the
+// node's UTXO set
+func (c *BitcoindClient) ScanUtxos(scripts [][]byte) ([]Utxo, error) {
+	if len(scripts) == 0 {
+		return nil, nil
+	}
+	descriptors := make([]string, len(scripts))
+	for i, script := range scripts {
+		descriptors[i] = fmt.Sprintf("raw(%x)", script)
+	}
+	var result struct {
+		Success  bool `json:"success"`
+		Unspents []struct {
+			TxId         string  `json:"txid"`
+			Vout         uint32  `json:"vout"`
+			ScriptPubKey string  `json:"scriptPubKey"`
+			Amount       float64 `json:"amount"`
+			Height       int64   `json:"height"`
+		} `json:"unspents"`
+	}
+	if err := c.call("scantxoutset", &result, "start", descriptors); err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("scantxoutset did not complete")
+	}
+	utxos := make([]Utxo, len(result.Unspents))
+	for i, unspent := range result.Unspents {
+		hash, err := chainhash.NewHashFromStr(unspent.TxId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid utxo txid: %w", err)
+		}
+		amount, err := btcutil.NewAmount(unspent.Amount)
+		if err != nil {
+			return nil, err
+		}
+		script, err := hex.DecodeString(unspent.ScriptPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid utxo script: %w", err)
+		}
+		utxos[i] = Utxo{
+			FromAddress: c.scriptAddress(script),
+			Outpoint:    wire.OutPoint{Hash: *hash, Index: unspent.Vout},
+			Amount:      int64(amount),
+			Script:      unspent.ScriptPubKey,
+			BlockHeight: unspent.Height,
+		}
+	}
+	return utxos, nil
+}
+
+// WatchAddresses imports 'addresses' into the configured wallet, which must be a descriptor wallet, for
+// AddressTransactions. The wallet rescans from 'timestamp', a unix time; zero rescans the whole chain.
+func (c *BitcoindClient) WatchAddresses(addresses []string, timestamp int64) error {
+	if c.wallet == "" {
+		return fmt.Errorf("watching addresses requires a wallet")
+	}
+	type importRequest struct {
+		Descriptor string `json:"desc"`
+		Timestamp  int64  `json:"timestamp"`
+	}
+	requests := make([]importRequest, len(addresses))
+	for i, address := range addresses {
+		descriptor, err := AddDescriptorChecksum(fmt.Sprintf("addr(%v)", address))
+		if err != nil {
+			return err
+		}
+		requests[i] = importRequest{Descriptor: descriptor, Timestamp: timestamp}
+	}
+	var results []struct {
+		Success bool              `json:"success"`
+		Error   *btcjson.RPCError `json:"error"`
+	}
+	if err := c.call("importdescriptors", &results, requests); err != nil {
+		return err
+	}
+	if len(results) != len(addresses) {
+		return fmt.Errorf("expecting %d import results but was %d", len(addresses), len(results))
+	}
+	for i, result := range results {
+		if result.Success {
+			continue
+		}
+		if result.Error != nil {
+			return fmt.Errorf("failed to watch address %v: %w", addresses[i], result.Error)
+		}
+		return fmt.Errorf("failed to watch address %v", addresses[i])
+	}
+	return nil
+}
+
+// AddressTransactions returns the transactions of 'address', which must be watched by the configured wallet (see
+// WatchAddresses), unconfirmed first and then confirmed from the newest. These are the wallet's transactions with an
+// output to the address or an input spending such an output.
+func (c *BitcoindClient) AddressTransactions(address string) ([]ChainTransaction, error) {
+	if c.wallet == "" {
+		return nil, fmt.Errorf("address transactions require a wallet")
+	}
+	decoded, err := btcutil.DecodeAddress(address, c.params)
+	if err != nil {
+		return nil, err
+	}
+	script, err := txscript.PayToAddrScript(decoded)
+	if err != nil {
+		return nil, err
+	}
+	var txids []string
+	seen := map[string]bool{}
+	for skip := 0; ; skip += bitcoindListTransactionsPage {
+		var entries []struct {
+			TxId string `json:"txid"`
+		}
+		if err := c.call("listtransactions", &entries, "*", bitcoindListTransactionsPage, skip, true); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !seen[entry.TxId] {
+				seen[entry.TxId] = true
+				txids = append(txids, entry.TxId)
+			}
+		}
+		if len(entries) < bitcoindListTransactionsPage {
+			break
+		}
+	}
+	// a "send" entry's address is that of its output, never that spent from, so the transactions spending the
+	// address are those with an input spending an output to it
+	msgTxs := make([]*wire.MsgTx, len(txids))
+	funded := map[wire.OutPoint]bool{}
+	for i, txid := range txids {
+		var result struct {
+			Hex string `json:"hex"`
+		}
+		if err := c.call("gettransaction", &result, txid, true); err != nil {
+			return nil, err
+		}
+		if msgTxs[i], err = decodeTransactionHex(result.Hex); err != nil {
+			return nil, err
+		}
+		hash := msgTxs[i].TxHash()
+		for index, txOut := range msgTxs[i].TxOut {
+			if bytes.Equal(txOut.PkScript, script) {
+				funded[wire.OutPoint{Hash: hash, Index: uint32(index)}] = true
+			}
+		}
+	}
+	var txs []ChainTransaction
+	for i, msgTx := range msgTxs {
+		if !involvesScript(msgTx, script, funded) {
+			continue
+		}
+		tx, err := c.chainTransaction(txids[i])
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].Status.Confirmed != txs[j].Status.Confirmed {
+			return !txs[i].Status.Confirmed
+		}
+		return txs[i].Status.BlockHeight > txs[j].Status.BlockHeight
+	})
+	return txs, nil
+}
+
+// involvesScript is whether 'msgTx' has an output to 'script' or an input spending one of 'funded'
+func involvesScript(msgTx *wire.MsgTx, script []byte, funded map[wire.OutPoint]bool) bool {
+	for _, txOut := range msgTx.TxOut {
+		if bytes.Equal(txOut.PkScript, script) {
+			return true
+		}
+	}
+	for _, txIn := range msgTx.TxIn {
+		if funded[txIn.PreviousOutPoint] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasHistory implements HistoryLookup via the transactions of the configured wallet, which must watch the scripts'
+// addresses (see WatchAddresses), paging only until every script is found
+func (c *BitcoindClient) HasHistory(scripts [][]byte) ([]bool, error) {
+	if c.wallet == "" {
+		return nil, fmt.Errorf("address history requires a wallet")
+	}
+	indices := make(map[string][]int, len(scripts))
+	for i, script := range scripts {
+		address, err := singleAddress(c.params, script)
+		if err != nil {
+			return nil, err
+		}
+		indices[address] = append(indices[address], i)
+	}
+	history := make([]bool, len(scripts))
+	for skip := 0; len(indices) > 0; skip += bitcoindListTransactionsPage {
+		var entries []struct {
+			Address string `json:"address"`
+		}
+		if err := c.call("listtransactions", &entries, "*", bitcoindListTransactionsPage, skip, true); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			for _, i := range indices[entry.Address] {
+				history[i] = true
+			}
+			delete(indices, entry.Address)
+		}
+		if len(entries) < bitcoindListTransactionsPage {
+			break
+		}
+	}
+	return history, nil
+}
+
+func (c *BitcoindClient) TipHeight() (int64, error) {
+	var height int64
+	if err := c.call("getblockcount", &height); err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+// RecommendedFees returns the node's estimatesmartfee of each target; a target without an estimate, e.g. on regtest
+// or a node just started, uses the minimum of the node's mempool
+func (c *BitcoindClient) RecommendedFees() (*RecommendedFees, error) {
+	var mempoolInfo struct {
+		MempoolMinFee float64 `json:"mempoolminfee"`
+		MinRelayTxFee float64 `json:"minrelaytxfee"`
+	}
+	if err := c.call("getmempoolinfo", &mempoolInfo); err != nil {
+		return nil, err
+	}
+	minimum := btcPerKvbToSatPerVb(math.Max(mempoolInfo.MempoolMinFee, mempoolInfo.MinRelayTxFee))
+	estimate := func(target int) (float64, error) {
+		var result struct {
+			FeeRate *float64 `json:"feerate"`
+		}
+		if err := c.call("estimatesmartfee", &result, target); err != nil {
+			return 0, err
+		}
+		if result.FeeRate == nil {
+			return minimum, nil
+		}
+		return math.Max(minimum, btcPerKvbToSatPerVb(*result.FeeRate)), nil
+	}
+	fees := &RecommendedFees{Minimum: minimum}
+	for _, target := range []struct {
+		blocks int
+		rate   *float64
+	}{{1, &fees.Fastest}, {3, &fees.HalfHour}, {6, &fees.Hour}, {144, &fees.Economy}} {
+		rate, err := estimate(target.blocks)
+		if err != nil {
+			return nil, err
+		}
+		*target.rate = rate
+	}
+	return fees, nil
+}
+
+// Broadcast submits 'tx' via sendrawtransaction once testmempoolaccept accepts it, so that a rejection carries
+// its reason
+func (c *BitcoindClient) Broadcast(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	serialized := hex.EncodeToString(buf.Bytes())
+	var results []struct {
+		TxId         string `json:"txid"`
+		Allowed      bool   `json:"allowed"`
+		RejectReason string `json:"reject-reason"`
+	}
+	if err := c.call("testmempoolaccept", &results, []string{serialized}); err != nil {
+		return "", err
+	}
+	if len(results) != 1 {
+		return "", fmt.Errorf("testmempoolaccept returned %d results", len(results))
+	}
+	if !results[0].Allowed {
+		return "", fmt.Errorf("transaction %v rejected: %v", results[0].TxId, results[0].RejectReason)
+	}
+	var txid string
+	if err := c.call("sendrawtransaction", &txid, serialized); err != nil {
+		return "", err
+	}
+	return txid, nil
+}
+
+// TransactionStatus returns the status of 'txid' if in the node's mempool, its transaction index (-txindex) or the
+// configured wallet
+func (c *BitcoindClient) TransactionStatus(txid string) (*TransactionStatus, error) {
+	var result struct {
+		BlockHash string `json:"blockhash"`
+		BlockTime int64  `json:"blocktime"`
+	}
+	err := c.call("getrawtransaction", &result, txid, true)
+	if isRpcNotFound(err) && c.wallet != "" {
+		err = c.call("gettransaction", &result, txid, true)
+	}
+	if isRpcNotFound(err) {
+		return nil, fmt.Errorf("%w: %v", ErrTransactionNotFound, txid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.transactionStatus(result.BlockHash, result.BlockTime)
+}
+
+func (c *BitcoindClient) transactionStatus(blockHash string, blockTime int64) (*TransactionStatus, error) {
+	if blockHash == "" {
+		return &TransactionStatus{}, nil
+	}
+	var header struct {
+		Height        int64 `json:"height"`
+		Confirmations int64 `json:"confirmations"`
+	}
+	if err := c.call("getblockheader", &header, blockHash, true); err != nil {
+		return nil, err
+	}
+	if header.Confirmations < 0 {
+		// the block was reorganized out; the transaction is unconfirmed
+		return &TransactionStatus{}, nil
+	}
+	return &TransactionStatus{Confirmed: true, BlockHeight: header.Height, BlockHash: blockHash,
+		BlockTime: blockTime}, nil
+}
+
+func (c *BitcoindClient) BlockHash(height int64) (*chainhash.Hash, error) {
+	var blockHash string
+	if err := c.call("getblockhash", &blockHash, height); err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(blockHash)
+}
+
+// BasicFilter returns the basic filter of 'blockHash', which requires the node's block filter index
+// (-blockfilterindex)
+func (c *BitcoindClient) BasicFilter(blockHash *chainhash.Hash) (*gcs.Filter, error) {
+	var result struct {
+		Filter string `json:"filter"`
+	}
+	if err := c.call("getblockfilter", &result, blockHash.String(), "basic"); err != nil {
+		return nil, err
+	}
+	serialized, err := hex.DecodeString(result.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return decodeBasicFilter(serialized)
+}
+
+func (c *BitcoindClient) Block(blockHash *chainhash.Hash) (*wire.MsgBlock, error) {
+	var serialized string
+	if err := c.call("getblock", &serialized, blockHash.String(), 0); err != nil {
+		return nil, err
+	}
+	decoded, err := hex.DecodeString(serialized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block hex: %w", err)
+	}
+	var block wire.MsgBlock
+	if err = block.Deserialize(bytes.NewReader(decoded)); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// chainTransaction returns the wallet transaction 'txid' along with the outputs it spends, where known to the node
+func (c *BitcoindClient) chainTransaction(txid string) (ChainTransaction, error) {
+	var result struct {
+		Hex       string `json:"hex"`
+		BlockHash string `json:"blockhash"`
+		BlockTime int64  `json:"blocktime"`
+	}
+	if err := c.call("gettransaction", &result, txid, true); err != nil {
+		return ChainTransaction{}, err
+	}
+	msgTx, err := decodeTransactionHex(result.Hex)
+	if err != nil {
+		return ChainTransaction{}, err
+	}
+	status, err := c.transactionStatus(result.BlockHash, result.BlockTime)
+	if err != nil {
+		return ChainTransaction{}, err
+	}
+	tx := ChainTransaction{
+		TxId:    txid,
+		Status:  *status,
+		Weight:  int64(msgTx.SerializeSizeStripped()*3 + msgTx.SerializeSize()),
+		Inputs:  make([]ChainTransactionInput, len(msgTx.TxIn)),
+		Outputs: make([]ChainTransactionOutput, len(msgTx.TxOut)),
+	}
+	var inputAmount, outputAmount int64
+	prevOutsKnown := true
+	coinbase := isCoinbase(msgTx)
+	for i, txIn := range msgTx.TxIn {
+		tx.Inputs[i] = ChainTransactionInput{Outpoint: txIn.PreviousOutPoint, Sequence: txIn.Sequence,
+			Coinbase: coinbase, Witness: witnessHex(txIn.Witness)}
+		if coinbase {
+			continue
+		}
+		prevOut, err := c.prevOut(txIn.PreviousOutPoint)
+		if err != nil {
+			return ChainTransaction{}, err
+		}
+		if prevOut == nil {
+			prevOutsKnown = false
+			continue
+		}
+		tx.Inputs[i].PrevOut = prevOut
+		inputAmount += prevOut.Amount
+	}
+	for i, txOut := range msgTx.TxOut {
+		tx.Outputs[i] = chainOutput(c.params, txOut)
+		outputAmount += txOut.Value
+	}
+	if prevOutsKnown && !coinbase {
+		tx.Fee = inputAmount - outputAmount
+	}
+	return tx, nil
+}
+
+// prevOut returns the output at 'outpoint' or nil if its transaction is unknown to the node
+func (c *BitcoindClient) prevOut(outpoint wire.OutPoint) (*ChainTransactionOutput, error) {
+	var serialized string
+	err := c.call("getrawtransaction", &serialized, outpoint.Hash.String(), false)
+	if isRpcNotFound(err) && c.wallet != "" {
+		var result struct {
+			Hex string `json:"hex"`
+		}
+		err = c.call("gettransaction", &result, outpoint.Hash.String(), true)
+		serialized = result.Hex
+	}
+	if isRpcNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgTx, err := decodeTransactionHex(serialized)
+	if err != nil {
+		return nil, err
+	}
+	if int(outpoint.Index) >= len(msgTx.TxOut) {
+		return nil, fmt.Errorf("invalid outpoint %v", outpoint)
+	}
+	output := chainOutput(c.params, msgTx.TxOut[outpoint.Index])
+	return &output, nil
+}
+
+// scriptAddress returns the address of 'script' or empty if it is not of a single address
+func (c *BitcoindClient) scriptAddress(script []byte) string {
+	_, addresses, _, err := txscript.ExtractPkScriptAddrs(script, c.params)
+	if err != nil || len(addresses) != 1 {
+		return ""
+	}
+	return addresses[0].EncodeAddress()
+}
+
+// call invokes the RPC 'method' with 'params', each serialized as JSON, and deserializes its result into 'result'
+func (c *BitcoindClient) call(method string, result any, params ...any) error {
+	rawParams := make([]json.RawMessage, len(params))
+	for i, param := range params {
+		rawParam, err := json.Marshal(param)
+		if err != nil {
+			return err
+		}
+		rawParams[i] = rawParam
+	}
+	rawResult, err := c.rpc.RawRequest(method, rawParams)
+	if err != nil {
+		return fmt.Errorf("%v: %w", method, err)
+	}
+	if err = json.Unmarshal(rawResult, result); err != nil {
+		return fmt.Errorf("%v: invalid response: %w", method, err)
+	}
+	return nil
+}
+
+func isRpcNotFound(err error) bool {
+	var rpcErr *btcjson.RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCInvalidAddressOrKey
+}
+
+func btcPerKvbToSatPerVb(feeRate float64) float64 {
+	satPerKvb := math.Round(feeRate * btcutil.SatoshiPerBitcoin)
+	return satPerKvb / 1000
+}
+
+func decodeTransactionHex(serialized string) (*wire.MsgTx, error) {
+	decoded, err := hex.DecodeString(serialized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hex: %w", err)
+	}
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if err = msgTx.Deserialize(bytes.NewReader(decoded)); err != nil {
+		return nil, err
+	}
+	return msgTx, nil
+}
@@ -0,0 +1,374 @@
+package leafy_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type fakeRpcMethod func(params []json.RawMessage) (any, *fakeRpcError)
+
+var rpcNotFound = &fakeRpcError{Code: -5, Message: "No such mempool or blockchain transaction"}
+
+// newFakeBitcoind serves 'methods' as a Bitcoin Core JSON-RPC server; 'wallet', if set, must be in the request path
+func newFakeBitcoind(t *testing.T, wallet string, methods map[string]fakeRpcMethod) *leafy.BitcoindClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wallet != "" {
+			require.Equal(t, "/wallet/"+wallet, r.URL.Path)
+		}
+		var request struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+			Id     json.RawMessage   `json:"id"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		method, ok := methods[request.Method]
+		require.True(t, ok, "unexpected method %v", request.Method)
+		result, rpcErr := method(request.Params)
+		if rpcErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"result": result, "error": rpcErr,
+			"id": request.Id}))
+	}))
+	t.Cleanup(server.Close)
+	client, err := leafy.NewBitcoindClient(&chaincfg.RegressionNetParams, leafy.BitcoindConfig{
+		Host:   strings.TrimPrefix(server.URL, "http://"),
+		User:   "user",
+		Pass:   "pass",
+		Wallet: wallet,
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.RpcClient().Shutdown)
+	return client
+}
+
+func unmarshalParam[T any](t *testing.T, param json.RawMessage) T {
+	var value T
+	require.NoError(t, json.Unmarshal(param, &value))
+	return value
+}
+
+func serializeTx(t *testing.T, tx *wire.MsgTx) string {
+	var buf bytes.Buffer
+	require.NoError(t, tx.Serialize(&buf))
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func TestBitcoindScanUtxos(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 2)
+	require.NoError(t, err)
+	scripts := make([][]byte, len(addresses))
+	for i, address := range addresses {
+		decoded, err := btcutil.DecodeAddress(address, params)
+		require.NoError(t, err)
+		scripts[i], err = txscript.PayToAddrScript(decoded)
+		require.NoError(t, err)
+	}
+	indices := map[string]int{}
+	for i, script := range scripts {
+		indices[fmt.Sprintf("raw(%x)", script)] = i
+	}
+	client := newFakeBitcoind(t, "", map[string]fakeRpcMethod{
+		"scantxoutset": func(rpcParams []json.RawMessage) (any, *fakeRpcError) {
+			require.Equal(t, "start", unmarshalParam[string](t, rpcParams[0]))
+			descriptors := unmarshalParam[[]string](t, rpcParams[1])
+			var unspents []any
+			for _, descriptor := range descriptors {
+				i, ok := indices[descriptor]
+				require.True(t, ok)
+				unspents = append(unspents, map[string]any{"txid": esploraTxId, "vout": i,
+					"scriptPubKey": hex.EncodeToString(scripts[i]), "amount": 0.0005 * float64(i+1), "height": 100 + i})
+			}
+			return map[string]any{"success": true, "height": 200, "unspents": unspents}, nil
+		},
+	})
+	utxos, err := client.ScanUtxos(scripts)
+	require.NoError(t, err)
+	require.Len(t, utxos, 2)
+	for i, utxo := range utxos {
+		require.Equal(t, addresses[i], utxo.FromAddress)
+		require.Equal(t, uint32(i), utxo.Outpoint.Index)
+		require.Equal(t, esploraTxId, utxo.Outpoint.Hash.String())
+		require.Equal(t, int64(50_000*(i+1)), utxo.Amount)
+		require.Equal(t, int64(100+i), utxo.BlockHeight)
+		require.Equal(t, hex.EncodeToString(scripts[i]), utxo.Script)
+	}
+
+	utxos, err = client.AddressUtxos(addresses[1])
+	require.NoError(t, err)
+	require.Len(t, utxos, 1)
+	require.Equal(t, addresses[1], utxos[0].FromAddress)
+}
+
+func TestBitcoindTipHeightAndFees(t *testing.T) {
+	client := newFakeBitcoind(t, "", map[string]fakeRpcMethod{
+		"getblockcount": func(params []json.RawMessage) (any, *fakeRpcError) {
+			return 840000, nil
+		},
+		"getmempoolinfo": func(params []json.RawMessage) (any, *fakeRpcError) {
+			return map[string]any{"mempoolminfee": 0.00002, "minrelaytxfee": 0.00001}, nil
+		},
+		"estimatesmartfee": func(params []json.RawMessage) (any, *fakeRpcError) {
+			switch unmarshalParam[int](t, params[0]) {
+			case 1:
+				return map[string]any{"feerate": 0.00025, "blocks": 1}, nil
+			case 3:
+				return map[string]any{"feerate": 0.0002, "blocks": 3}, nil
+			case 6:
+				return map[string]any{"errors": []string{"Insufficient data or no feerate found"}, "blocks": 0}, nil
+			default:
+				return map[string]any{"feerate": 0.00001, "blocks": 144}, nil
+			}
+		},
+	})
+	height, err := client.TipHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), height)
+
+	fees, err := client.RecommendedFees()
+	require.NoError(t, err)
+	require.Equal(t, &leafy.RecommendedFees{Fastest: 25, HalfHour: 20, Hour: 2, Economy: 2, Minimum: 2}, fees)
+}
+
+func TestBitcoindBroadcast(t *testing.T) {
+	msgTx := wire.NewMsgTx(2)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1_000, []byte{0x51}))
+	sent := 0
+	client := newFakeBitcoind(t, "", map[string]fakeRpcMethod{
+		"testmempoolaccept": func(params []json.RawMessage) (any, *fakeRpcError) {
+			rawTxs := unmarshalParam[[]string](t, params[0])
+			require.Equal(t, []string{serializeTx(t, msgTx)}, rawTxs)
+			result := map[string]any{"txid": msgTx.TxHash().String(), "allowed": msgTx.LockTime == 0}
+			if msgTx.LockTime != 0 {
+				result["reject-reason"] = "non-final"
+			}
+			return []any{result}, nil
+		},
+		"sendrawtransaction": func(params []json.RawMessage) (any, *fakeRpcError) {
+			sent++
+			require.Equal(t, serializeTx(t, msgTx), unmarshalParam[string](t, params[0]))
+			return msgTx.TxHash().String(), nil
+		},
+	})
+	msgTx.LockTime = 900000
+	_, err := client.Broadcast(msgTx)
+	require.ErrorContains(t, err, fmt.Sprintf("transaction %v rejected: non-final", msgTx.TxHash()))
+	require.Equal(t, 0, sent)
+
+	msgTx.LockTime = 0
+	txid, err := client.Broadcast(msgTx)
+	require.NoError(t, err)
+	require.Equal(t, msgTx.TxHash().String(), txid)
+	require.Equal(t, 1, sent)
+}
+
+func TestBitcoindTransactionStatus(t *testing.T) {
+	blockHash := strings.Repeat("ab", 32)
+	client := newFakeBitcoind(t, "watch", map[string]fakeRpcMethod{
+		"getrawtransaction": func(params []json.RawMessage) (any, *fakeRpcError) {
+			switch unmarshalParam[string](t, params[0]) {
+			case "mempool":
+				return map[string]any{"txid": "mempool"}, nil
+			case "confirmed":
+				return map[string]any{"txid": "confirmed", "blockhash": blockHash, "blocktime": 1700000000}, nil
+			}
+			return nil, rpcNotFound
+		},
+		"gettransaction": func(params []json.RawMessage) (any, *fakeRpcError) {
+			if unmarshalParam[string](t, params[0]) == "wallet" {
+				return map[string]any{"txid": "wallet", "blockhash": blockHash, "blocktime": 1700000000}, nil
+			}
+			return nil, &fakeRpcError{Code: -5, Message: "Invalid or non-wallet transaction id"}
+		},
+		"getblockheader": func(params []json.RawMessage) (any, *fakeRpcError) {
+			require.Equal(t, blockHash, unmarshalParam[string](t, params[0]))
+			return map[string]any{"hash": blockHash, "height": 120, "confirmations": 3}, nil
+		},
+	})
+	status, err := client.TransactionStatus("mempool")
+	require.NoError(t, err)
+	require.Equal(t, &leafy.TransactionStatus{}, status)
+	expected := &leafy.TransactionStatus{Confirmed: true, BlockHeight: 120, BlockHash: blockHash,
+		BlockTime: 1700000000}
+	for _, txid := range []string{"confirmed", "wallet"} {
+		status, err = client.TransactionStatus(txid)
+		require.NoError(t, err)
+		require.Equal(t, expected, status)
+	}
+	_, err = client.TransactionStatus("unknown")
+	require.ErrorIs(t, err, leafy.ErrTransactionNotFound)
+}
+
+func TestBitcoindAddressTransactions(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 2)
+	require.NoError(t, err)
+	pkScript := func(address string) []byte {
+		decoded, err := btcutil.DecodeAddress(address, params)
+		require.NoError(t, err)
+		script, err := txscript.PayToAddrScript(decoded)
+		require.NoError(t, err)
+		return script
+	}
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{9}, 0), nil, nil))
+	funding.AddTxOut(wire.NewTxOut(50_000, pkScript(addresses[0])))
+	spending := wire.NewMsgTx(2)
+	spending.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{8}, 0), nil, nil))
+	fundingHash := funding.TxHash()
+	spending.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, 0), nil, [][]byte{{0x01}}))
+	spending.AddTxOut(wire.NewTxOut(45_000, pkScript(addresses[1])))
+	fundingId, spendingId := funding.TxHash().String(), spending.TxHash().String()
+	blockHash := strings.Repeat("cd", 32)
+
+	var imported []map[string]any
+	client := newFakeBitcoind(t, "watch", map[string]fakeRpcMethod{
+		"importdescriptors": func(params []json.RawMessage) (any, *fakeRpcError) {
+			imported = unmarshalParam[[]map[string]any](t, params[0])
+			return []any{map[string]any{"success": true}, map[string]any{"success": true}}, nil
+		},
+		"listtransactions": func(params []json.RawMessage) (any, *fakeRpcError) {
+			require.Equal(t, "*", unmarshalParam[string](t, params[0]))
+			require.True(t, unmarshalParam[bool](t, params[3]))
+			// as Bitcoin Core lists them; the address of a send is that of its output, not that spent from
+			return []any{
+				map[string]any{"address": addresses[0], "txid": fundingId, "category": "receive"},
+				map[string]any{"address": addresses[1], "txid": spendingId, "category": "receive"},
+				map[string]any{"address": addresses[1], "txid": spendingId, "category": "send"},
+			}, nil
+		},
+		"gettransaction": func(params []json.RawMessage) (any, *fakeRpcError) {
+			switch unmarshalParam[string](t, params[0]) {
+			case fundingId:
+				return map[string]any{"hex": serializeTx(t, funding), "blockhash": blockHash,
+					"blocktime": 1700000000}, nil
+			case spendingId:
+				return map[string]any{"hex": serializeTx(t, spending)}, nil
+			}
+			return nil, &fakeRpcError{Code: -5, Message: "Invalid or non-wallet transaction id"}
+		},
+		"getrawtransaction": func(params []json.RawMessage) (any, *fakeRpcError) {
+			return nil, rpcNotFound
+		},
+		"getblockheader": func(params []json.RawMessage) (any, *fakeRpcError) {
+			return map[string]any{"hash": blockHash, "height": 150, "confirmations": 1}, nil
+		},
+	})
+	require.NoError(t, client.WatchAddresses(addresses, 0))
+	require.Len(t, imported, 2)
+	for i, request := range imported {
+		descriptor, err := leafy.AddDescriptorChecksum(fmt.Sprintf("addr(%v)", addresses[i]))
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"desc": descriptor, "timestamp": float64(0)}, request)
+	}
+
+	txs, err := client.AddressTransactions(addresses[0])
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	// unconfirmed first
+	require.Equal(t, spendingId, txs[0].TxId)
+	require.False(t, txs[0].Status.Confirmed)
+	require.Nil(t, txs[0].Inputs[0].PrevOut)
+	require.Nil(t, txs[0].Inputs[0].Witness)
+	require.Equal(t, []string{"01"}, txs[0].Inputs[1].Witness)
+	require.Equal(t, &leafy.ChainTransactionOutput{Script: hex.EncodeToString(pkScript(addresses[0])),
+		Address: addresses[0], Amount: 50_000}, txs[0].Inputs[1].PrevOut)
+	// a prevout is unknown so the fee is too
+	require.Equal(t, int64(0), txs[0].Fee)
+	require.Equal(t, []leafy.ChainTransactionOutput{{Script: hex.EncodeToString(pkScript(addresses[1])),
+		Address: addresses[1], Amount: 45_000}}, txs[0].Outputs)
+	require.Equal(t, fundingId, txs[1].TxId)
+	require.Equal(t, leafy.TransactionStatus{Confirmed: true, BlockHeight: 150, BlockHash: blockHash,
+		BlockTime: 1700000000}, txs[1].Status)
+
+	txs, err = client.AddressTransactions(addresses[1])
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	require.Equal(t, spendingId, txs[0].TxId)
+
+	unused, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 5, 1)
+	require.NoError(t, err)
+	history, err := client.HasHistory([][]byte{pkScript(addresses[1]), pkScript(unused[0]), pkScript(addresses[0])})
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, false, true}, history)
+
+	// an unsuccessful import is an error even without an error of its own
+	failing := newFakeBitcoind(t, "watch", map[string]fakeRpcMethod{
+		"importdescriptors": func(params []json.RawMessage) (any, *fakeRpcError) {
+			return []any{map[string]any{"success": true}, map[string]any{"success": false}}, nil
+		},
+	})
+	require.ErrorContains(t, failing.WatchAddresses(addresses, 0), "failed to watch address "+addresses[1])
+
+	noWallet := newFakeBitcoind(t, "", map[string]fakeRpcMethod{})
+	_, err = noWallet.AddressTransactions(addresses[0])
+	require.ErrorContains(t, err, "address transactions require a wallet")
+	require.ErrorContains(t, noWallet.WatchAddresses(addresses, 0), "watching addresses requires a wallet")
+}
+
+func TestBitcoindCompactFilterSource(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 1)
+	require.NoError(t, err)
+	source := newFixtureFilterSource(t)
+	source.addBlock()
+	source.addBlock(fixtureTx(wire.OutPoint{Hash: source.blocks[0].Transactions[0].TxHash()},
+		wire.NewTxOut(50_000, addressScript(t, params, addresses[0]))))
+	client := newFakeBitcoind(t, "", map[string]fakeRpcMethod{
+		"getblockhash": func(params []json.RawMessage) (any, *fakeRpcError) {
+			height := unmarshalParam[int](t, params[0])
+			if height >= len(source.blocks) {
+				return nil, &fakeRpcError{Code: -8, Message: "Block height out of range"}
+			}
+			return source.blocks[height].BlockHash().String(), nil
+		},
+		"getblockfilter": func(params []json.RawMessage) (any, *fakeRpcError) {
+			require.Equal(t, "basic", unmarshalParam[string](t, params[1]))
+			blockHash, err := chainhash.NewHashFromStr(unmarshalParam[string](t, params[0]))
+			require.NoError(t, err)
+			serialized, err := source.filters[source.height(blockHash)].NBytes()
+			require.NoError(t, err)
+			return map[string]any{"filter": hex.EncodeToString(serialized), "header": strings.Repeat("00", 32)}, nil
+		},
+		"getblock": func(params []json.RawMessage) (any, *fakeRpcError) {
+			require.Equal(t, 0, unmarshalParam[int](t, params[1]))
+			blockHash, err := chainhash.NewHashFromStr(unmarshalParam[string](t, params[0]))
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, source.blocks[source.height(blockHash)].Serialize(&buf))
+			return hex.EncodeToString(buf.Bytes()), nil
+		},
+	})
+
+	scanner := leafy.NewCompactFilterScanner(params, client)
+	require.NoError(t, scanner.AddAddress(addresses[0]))
+	fetched, err := scanner.Scan(0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, fetched)
+	utxos := scanner.Utxos()
+	require.Len(t, utxos, 1)
+	require.Equal(t, int64(50_000), utxos[0].Amount)
+
+	_, err = scanner.Scan(2, 2)
+	require.ErrorContains(t, err, "Block height out of range")
+}
@@ -85,6 +85,7 @@ func (c *LocalBitcoinClient) GetClient() *BitcoinClient {
 type BitcoinClient struct {
 	NetworkParams *chaincfg.Params
 	RpcClient     *rpcclient.Client
+	Backend       *leafy.BitcoindClient
 }
 
 type CreateWalletRequest struct {
@@ -119,21 +120,20 @@ func NewBitcoinClient(
 ) (*BitcoinClient, error) {
 	fmt.Printf("connecting to bitcoin node: %v:******@%v:%v/wallet/%v\n", user, host, port, walletName)
 
-	client, err := rpcclient.New(&rpcclient.ConnConfig{
-		Host:         fmt.Sprintf("%v:%d/wallet/%v", host, port, walletName),
-		User:         user,
-		Pass:         pwd,
-		Params:       networkParams.Name,
-		DisableTLS:   true,
-		HTTPPostMode: true,
-	}, nil)
+	backend, err := leafy.NewBitcoindClient(networkParams, leafy.BitcoindConfig{
+		Host:   fmt.Sprintf("%v:%d", host, port),
+		User:   user,
+		Pass:   pwd,
+		Wallet: walletName,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to bitcoin node: %w", err)
+		return nil, err
 	}
 
 	return &BitcoinClient{
 		NetworkParams: networkParams,
-		RpcClient:     client,
+		RpcClient:     backend.RpcClient(),
+		Backend:       backend,
 	}, nil
 }
 
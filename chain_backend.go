@@ -0,0 +1,150 @@
+package leafy
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ChainBackend is a source of blockchain state and the means to broadcast transactions, e.g. EsploraClient
+type ChainBackend interface {
+	// AddressUtxos returns the unspent outputs, confirmed and unconfirmed, of 'address'
+	AddressUtxos(address string) ([]Utxo, error)
+	// AddressTransactions returns the transactions, confirmed and unconfirmed, funding or spending 'address'
+	AddressTransactions(address string) ([]ChainTransaction, error)
+	// TipHeight returns the height of the best block
+	TipHeight() (int64, error)
+	// RecommendedFees returns the fee rates, in sat/vB, recommended for confirmation within various targets
+	RecommendedFees() (*RecommendedFees, error)
+	// Broadcast submits 'tx' to the network and returns its txid
+	Broadcast(tx *wire.MsgTx) (string, error)
+	// TransactionStatus returns the confirmation status of 'txid' or ErrTransactionNotFound if it is unknown
+	TransactionStatus(txid string) (*TransactionStatus, error)
+}
+
+// AddressStatusLookup is a ChainBackend which summarizes the history of an address by a status that changes whenever
+// its history does, e.g. EsploraClient and ElectrumClient; WalletSync.Resync then queries the transactions of only
+// the addresses whose status changed since its checkpoint
+type AddressStatusLookup interface {
+	// AddressStatus returns the status of 'address', empty if it has no history
+	AddressStatus(address string) (string, error)
+}
+
+// TransactionStatus is the confirmation status of a transaction; block fields are zero if unconfirmed
+type TransactionStatus struct {
+	Confirmed   bool
+	BlockHeight int64  `json:",omitempty"`
+	BlockHash   string `json:",omitempty"`
+	BlockTime   int64  `json:",omitempty"`
+}
+
+// ChainTransaction is a transaction as known by a ChainBackend
+type ChainTransaction struct {
+	TxId    string
+	Status  TransactionStatus
+	Fee     int64
+	Weight  int64
+	Inputs  []ChainTransactionInput
+	Outputs []ChainTransactionOutput
+}
+
+// ChainTransactionInput is an input of a ChainTransaction along with the output it spends, if known
+type ChainTransactionInput struct {
+	Outpoint wire.OutPoint
+	Sequence uint32
+	Coinbase bool
+	// Witness is the input's hex encoded witness stack
+	Witness []string `json:",omitempty"`
+	// PrevOut is the output spent, nil for coinbase inputs
+	PrevOut *ChainTransactionOutput `json:",omitempty"`
+}
+
+// ChainTransactionOutput is an output of a ChainTransaction; Address is empty for non-standard scripts
+type ChainTransactionOutput struct {
+	Script  string
+	Address string `json:",omitempty"`
+	Amount  int64
+}
+
+// RecommendedFees are fee rates, in sat/vB, by confirmation target
+type RecommendedFees struct {
+	// Fastest targets the next block
+	Fastest float64
+	// HalfHour targets three blocks
+	HalfHour float64
+	// Hour targets six blocks
+	Hour float64
+	// Economy targets a day
+	Economy float64
+	// Minimum is the minimum relayed
+	Minimum float64
+}
+
+// ChainBackendHistoryLookup is a HistoryLookup of scripts' addresses' transactions via 'backend'. A backend which is
+// itself a HistoryLookup, e.g. EsploraClient or ElectrumClient, is used as such so that an address' history need not
+// be fetched to find it is used.
+func ChainBackendHistoryLookup(params *chaincfg.Params, backend ChainBackend) HistoryLookup {
+	if lookup, ok := backend.(HistoryLookup); ok {
+		return lookup
+	}
+	return HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		history := make([]bool, len(scripts))
+		for i, script := range scripts {
+			address, err := singleAddress(params, script)
+			if err != nil {
+				return nil, err
+			}
+			txs, err := backend.AddressTransactions(address)
+			if err != nil {
+				return nil, err
+			}
+			history[i] = len(txs) > 0
+		}
+		return history, nil
+	})
+}
+
+// singleAddress is the address of 'script', which must be of a single address on 'params'
+func singleAddress(params *chaincfg.Params, script []byte) (string, error) {
+	_, addresses, _, err := txscript.ExtractPkScriptAddrs(script, params)
+	if err != nil {
+		return "", err
+	}
+	if len(addresses) != 1 {
+		return "", fmt.Errorf("script %x is not of a single address", script)
+	}
+	return addresses[0].EncodeAddress(), nil
+}
+
+// witnessHex hex encodes each item of 'witness'
+func witnessHex(witness wire.TxWitness) []string {
+	if len(witness) == 0 {
+		return nil
+	}
+	items := make([]string, len(witness))
+	for i, item := range witness {
+		items[i] = hex.EncodeToString(item)
+	}
+	return items
+}
+
+func isCoinbase(msgTx *wire.MsgTx) bool {
+	return len(msgTx.TxIn) == 1 && msgTx.TxIn[0].PreviousOutPoint.Index == wire.MaxPrevOutIndex &&
+		msgTx.TxIn[0].PreviousOutPoint.Hash == chainhash.Hash{}
+}
+
+// chainOutput is 'txOut' with its address, if of a single address on 'params'
+func chainOutput(params *chaincfg.Params, txOut *wire.TxOut) ChainTransactionOutput {
+	output := ChainTransactionOutput{Script: hex.EncodeToString(txOut.PkScript), Amount: txOut.Value}
+	_, addresses, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, params)
+	if err == nil && len(addresses) == 1 {
+		output.Address = addresses[0].EncodeAddress()
+	}
+	return output
+}
@@ -0,0 +1,447 @@
+package leafy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	CoinSelectionBranchAndBound   = "bnb"
+	CoinSelectionKnapsack         = "knapsack"
+	CoinSelectionLargestFirst     = "largest-first"
+	CoinSelectionOldestFirst      = "oldest-first"
+	CoinSelectionSingleRandomDraw = "single-random-draw"
+)
+
+// DefaultLongTermFeeRate is the fee rate (in sat/vByte) expected to be paid, in the future, to spend a utxo. It is
+// used by the waste metric to decide whether consolidating inputs now is cheaper than later.
+const DefaultLongTermFeeRate = 10
+
+// bnbMaxTries bounds the depth-first search of BranchAndBoundCoinSelector; see Bitcoin Core's coinselection.cpp
+const bnbMaxTries = 100000
+
+// knapsackIterations is the number of random subsets tried by KnapsackCoinSelector
+const knapsackIterations = 1000
+
+// CoinSelector chooses which utxos fund a transaction
+type CoinSelector interface {
+	// Select returns the subset of 'utxos' which funds 'request'
+	Select(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error)
+}
+
+// CoinSelectionRequest describes the transaction being funded
+type CoinSelectionRequest struct {
+	// Target is the amount, in sats, sent to the non-change outputs
+	Target int64
+	// FeeRate is the fee rate, in sat/vByte, of the transaction
+	FeeRate float64
+	// LongTermFeeRate is the fee rate, in sat/vByte, expected to be paid to spend change in the future
+	LongTermFeeRate float64
+	// BaseWeight is the weight of the transaction without any inputs and without change
+	BaseWeight int64
+	// InputWeight is the weight of a single input, including its witness
+	InputWeight int64
+	// ChangeOutputWeight is the weight of the change output
+	ChangeOutputWeight int64
+}
+
+// NewCoinSelectionRequest creates a CoinSelectionRequest for key path spends paying 'outputsWeight' worth of
+// outputs (excluding change) and using DefaultLongTermFeeRate
+func NewCoinSelectionRequest(target int64, feeRate float64, outputsWeight int64) *CoinSelectionRequest {
+	return &CoinSelectionRequest{
+		Target:             target,
+		FeeRate:            feeRate,
+		LongTermFeeRate:    DefaultLongTermFeeRate,
+		BaseWeight:         txOverheadWeight + outputsWeight,
+		InputWeight:        p2trKeyPathInputWeight,
+		ChangeOutputWeight: p2trOutputWeight,
+	}
+}
+
+func (r *CoinSelectionRequest) inputFee() int64 {
+	return feeForWeight(r.InputWeight, r.FeeRate)
+}
+
+func (r *CoinSelectionRequest) inputLongTermFee() int64 {
+	return feeForWeight(r.InputWeight, r.LongTermFeeRate)
+}
+
+func (r *CoinSelectionRequest) effectiveValue(utxo Utxo) int64 {
+	return utxo.Amount - r.inputFee()
+}
+
+// selectionTarget is the sum of effective values needed to fund the request without change
+func (r *CoinSelectionRequest) selectionTarget() int64 {
+	return r.Target + feeForWeight(r.BaseWeight, r.FeeRate)
+}
+
+// costOfChange is the fee to create a change output now plus the fee to spend it later
+func (r *CoinSelectionRequest) costOfChange() int64 {
+	return feeForWeight(r.ChangeOutputWeight, r.FeeRate) + r.inputLongTermFee()
+}
+
+// minViableChange is the smallest change worth creating; below it the change is added to the fee
+func (r *CoinSelectionRequest) minViableChange() int64 {
+	if spendFee := r.inputLongTermFee(); spendFee > P2trDustAmt {
+		return spendFee + 1
+	}
+	return P2trDustAmt + 1
+}
+
+// CoinSelection is the result of a CoinSelector
+type CoinSelection struct {
+	Utxos []Utxo
+	// Fee is the fee, in sats, paid (includes any change deemed not viable)
+	Fee int64
+	// Change is the change, in sats, or zero if no change output is needed
+	Change int64
+	// Waste is the cost of this selection relative to an ideal one; lower is better. It is the sum of the
+	// difference between the fee paid for each input now and its fee at the long-term fee rate, plus either the
+	// cost of change (if there is change) or the excess given to fees (if there is not).
+	Waste int64
+}
+
+func (c *CoinSelection) GetInputAmount() int64 {
+	var amount int64
+	for _, utxo := range c.Utxos {
+		amount += utxo.Amount
+	}
+	return amount
+}
+
+// newCoinSelection determines the fee, change and waste of spending 'utxos' for 'request'
+func newCoinSelection(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	var amount int64
+	for _, utxo := range utxos {
+		amount += utxo.Amount
+	}
+	inputsWeight := int64(len(utxos)) * request.InputWeight
+	feeWithoutChange := feeForWeight(request.BaseWeight+inputsWeight, request.FeeRate)
+	excess := amount - request.Target - feeWithoutChange
+	if excess < 0 {
+		return nil, fmt.Errorf("insufficient funds; need %d have %d", request.Target+feeWithoutChange, amount)
+	}
+	inputsWaste := int64(len(utxos)) * (request.inputFee() - request.inputLongTermFee())
+	feeWithChange := feeForWeight(request.BaseWeight+inputsWeight+request.ChangeOutputWeight, request.FeeRate)
+	change := amount - request.Target - feeWithChange
+	if change >= request.minViableChange() {
+		return &CoinSelection{
+			Utxos:  utxos,
+			Fee:    feeWithChange,
+			Change: change,
+			Waste:  inputsWaste + request.costOfChange(),
+		}, nil
+	}
+	return &CoinSelection{
+		Utxos:  utxos,
+		Fee:    amount - request.Target,
+		Change: 0,
+		Waste:  inputsWaste + excess,
+	}, nil
+}
+
+// selectInOrder accumulates 'utxos', in order, until 'request' is funded with viable change (or exactly without)
+func selectInOrder(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	selected := make([]Utxo, 0)
+	var effective int64
+	withChangeTarget := request.selectionTarget() + feeForWeight(request.ChangeOutputWeight, request.FeeRate) +
+		request.minViableChange()
+	for _, utxo := range utxos {
+		if request.effectiveValue(utxo) <= 0 {
+			continue
+		}
+		selected = append(selected, utxo)
+		effective += request.effectiveValue(utxo)
+		if effective == request.selectionTarget() || effective >= withChangeTarget {
+			break
+		}
+	}
+	return newCoinSelection(selected, request)
+}
+
+// BranchAndBoundCoinSelector searches for a changeless selection whose excess is below the cost of change,
+// minimizing waste; see [Murch's thesis](https://murch.one/erhardt2016coinselection.pdf). If none is found, the
+// Fallback (if any) is used.
+type BranchAndBoundCoinSelector struct {
+	Fallback CoinSelector
+}
+
+func (b *BranchAndBoundCoinSelector) Select(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	pool := make([]Utxo, 0, len(utxos))
+	var available int64
+	for _, utxo := range utxos {
+		if request.effectiveValue(utxo) > 0 {
+			pool = append(pool, utxo)
+			available += request.effectiveValue(utxo)
+		}
+	}
+	sort.SliceStable(pool, func(i, j int) bool {
+		return pool[i].Amount > pool[j].Amount
+	})
+	target := request.selectionTarget()
+	upperBound := target + request.costOfChange()
+	inputWaste := request.inputFee() - request.inputLongTermFee()
+
+	var value, waste int64
+	bestWaste := int64(math.MaxInt64)
+	var best []int
+	selected := make([]int, 0)
+	index := 0
+	for try := 0; try < bnbMaxTries; try, index = try+1, index+1 {
+		backtrack := false
+		if value+available < target || value > upperBound || (waste > bestWaste && inputWaste > 0) {
+			backtrack = true
+		} else if value >= target {
+			if waste+(value-target) <= bestWaste {
+				best = append([]int{}, selected...)
+				bestWaste = waste + (value - target)
+			}
+			backtrack = true
+		}
+		if backtrack {
+			if len(selected) == 0 {
+				break
+			}
+			// add back the omitted utxos before trying the omission branch of the last included utxo
+			for index--; index > selected[len(selected)-1]; index-- {
+				available += request.effectiveValue(pool[index])
+			}
+			value -= request.effectiveValue(pool[index])
+			waste -= inputWaste
+			selected = selected[:len(selected)-1]
+		} else {
+			utxo := pool[index]
+			available -= request.effectiveValue(utxo)
+			// skip equivalent utxos whose predecessor was omitted, the branch would be a duplicate
+			if len(selected) == 0 || index-1 == selected[len(selected)-1] || utxo.Amount != pool[index-1].Amount {
+				selected = append(selected, index)
+				value += request.effectiveValue(utxo)
+				waste += inputWaste
+			}
+		}
+	}
+	if best == nil {
+		if b.Fallback != nil {
+			return b.Fallback.Select(utxos, request)
+		}
+		return nil, fmt.Errorf("no changeless selection found for %d", request.Target)
+	}
+	selection := make([]Utxo, 0, len(best))
+	for _, index := range best {
+		selection = append(selection, pool[index])
+	}
+	return newCoinSelection(selection, request)
+}
+
+// KnapsackCoinSelector randomly searches for the subset of utxos closest to funding the request with viable
+// change, as Bitcoin Core did prior to BranchAndBoundCoinSelector
+type KnapsackCoinSelector struct {
+	Random *rand.Rand
+}
+
+func (k *KnapsackCoinSelector) Select(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	random := randomOrDefault(k.Random)
+	target := request.selectionTarget()
+	withChangeTarget := target + feeForWeight(request.ChangeOutputWeight, request.FeeRate) + request.minViableChange()
+	shuffled := shuffleUtxos(utxos, random)
+	applicable := make([]Utxo, 0)
+	var applicableValue int64
+	var lowestLarger *Utxo
+	for i := range shuffled {
+		utxo := shuffled[i]
+		value := request.effectiveValue(utxo)
+		if value <= 0 {
+			continue
+		}
+		if value == target {
+			return newCoinSelection([]Utxo{utxo}, request)
+		}
+		if value < withChangeTarget {
+			applicable = append(applicable, utxo)
+			applicableValue += value
+		} else if lowestLarger == nil || value < request.effectiveValue(*lowestLarger) {
+			lowestLarger = &shuffled[i]
+		}
+	}
+	if applicableValue == target {
+		return newCoinSelection(applicable, request)
+	}
+	if applicableValue < target {
+		if lowestLarger == nil {
+			return newCoinSelection(applicable, request)
+		}
+		return newCoinSelection([]Utxo{*lowestLarger}, request)
+	}
+	sort.SliceStable(applicable, func(i, j int) bool {
+		return applicable[i].Amount > applicable[j].Amount
+	})
+	best, bestValue := approximateBestSubset(applicable, request, target, random)
+	if bestValue != target && applicableValue >= withChangeTarget {
+		best, bestValue = approximateBestSubset(applicable, request, withChangeTarget, random)
+	}
+	// the next larger utxo is preferred if the subset is not exact and has no viable change or if it is closer
+	if lowestLarger != nil && ((bestValue != target && bestValue < withChangeTarget) ||
+		request.effectiveValue(*lowestLarger) <= bestValue) {
+		return newCoinSelection([]Utxo{*lowestLarger}, request)
+	}
+	return newCoinSelection(best, request)
+}
+
+func approximateBestSubset(utxos []Utxo, request *CoinSelectionRequest, target int64, random *rand.Rand) ([]Utxo, int64) {
+	best := make([]bool, len(utxos))
+	var bestValue int64
+	for i := range utxos {
+		best[i] = true
+		bestValue += request.effectiveValue(utxos[i])
+	}
+	for iteration := 0; iteration < knapsackIterations && bestValue != target; iteration++ {
+		included := make([]bool, len(utxos))
+		var total int64
+		reachedTarget := false
+		for pass := 0; pass < 2 && !reachedTarget; pass++ {
+			for i := range utxos {
+				include := !included[i]
+				if pass == 0 {
+					include = random.Intn(2) == 1
+				}
+				if !include {
+					continue
+				}
+				total += request.effectiveValue(utxos[i])
+				included[i] = true
+				if total >= target {
+					reachedTarget = true
+					if total < bestValue {
+						bestValue = total
+						copy(best, included)
+					}
+					total -= request.effectiveValue(utxos[i])
+					included[i] = false
+				}
+			}
+		}
+	}
+	subset := make([]Utxo, 0)
+	for i := range utxos {
+		if best[i] {
+			subset = append(subset, utxos[i])
+		}
+	}
+	return subset, bestValue
+}
+
+// LeastWasteCoinSelector selects via each of its Candidates and returns the selection of least Waste, as does
+// Bitcoin Core; ties go to the earlier candidate. Candidates unable to fund the request are skipped.
+type LeastWasteCoinSelector struct {
+	Candidates []CoinSelector
+}
+
+func (l *LeastWasteCoinSelector) Select(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	var best *CoinSelection
+	var errs []error
+	for _, candidate := range l.Candidates {
+		selection, err := candidate.Select(utxos, request)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if best == nil || selection.Waste < best.Waste {
+			best = selection
+		}
+	}
+	if best == nil {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("no coin selection candidates")
+		}
+		return nil, errors.Join(errs...)
+	}
+	return best, nil
+}
+
+// LargestFirstCoinSelector spends the largest utxos first, minimizing the number of inputs
+type LargestFirstCoinSelector struct{}
+
+func (l *LargestFirstCoinSelector) Select(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	sorted := make([]Utxo, len(utxos))
+	copy(sorted, utxos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Amount > sorted[j].Amount
+	})
+	return selectInOrder(sorted, request)
+}
+
+// OldestFirstCoinSelector spends the utxos with the lowest Utxo.BlockHeight first; unconfirmed utxos are spent last
+type OldestFirstCoinSelector struct{}
+
+func (o *OldestFirstCoinSelector) Select(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	sorted := make([]Utxo, len(utxos))
+	copy(sorted, utxos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].BlockHeight == 0 || sorted[j].BlockHeight == 0 {
+			return sorted[j].BlockHeight == 0 && sorted[i].BlockHeight != 0
+		}
+		return sorted[i].BlockHeight < sorted[j].BlockHeight
+	})
+	return selectInOrder(sorted, request)
+}
+
+// SingleRandomDrawCoinSelector spends randomly chosen utxos until the request is funded
+type SingleRandomDrawCoinSelector struct {
+	Random *rand.Rand
+}
+
+func (s *SingleRandomDrawCoinSelector) Select(utxos []Utxo, request *CoinSelectionRequest) (*CoinSelection, error) {
+	return selectInOrder(shuffleUtxos(utxos, randomOrDefault(s.Random)), request)
+}
+
+// GetCoinSelector returns the CoinSelector for 'name' (one of the CoinSelection* constants). An empty 'name'
+// returns nil, which denotes the in-order selection of CreateTransaction. CoinSelectionBranchAndBound is the least
+// waste of branch and bound, knapsack and single random draw selection.
+func GetCoinSelector(name string) (CoinSelector, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return nil, nil
+	case CoinSelectionBranchAndBound:
+		return &LeastWasteCoinSelector{Candidates: []CoinSelector{
+			&BranchAndBoundCoinSelector{},
+			&KnapsackCoinSelector{},
+			&SingleRandomDrawCoinSelector{},
+		}}, nil
+	case CoinSelectionKnapsack:
+		return &KnapsackCoinSelector{}, nil
+	case CoinSelectionLargestFirst:
+		return &LargestFirstCoinSelector{}, nil
+	case CoinSelectionOldestFirst:
+		return &OldestFirstCoinSelector{}, nil
+	case CoinSelectionSingleRandomDraw:
+		return &SingleRandomDrawCoinSelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown coin selection: %v", name)
+	}
+}
+
+func randomOrDefault(random *rand.Rand) *rand.Rand {
+	if random != nil {
+		return random
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+func shuffleUtxos(utxos []Utxo, random *rand.Rand) []Utxo {
+	shuffled := make([]Utxo, len(utxos))
+	copy(shuffled, utxos)
+	random.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+func feeForWeight(weight int64, feeRate float64) int64 {
+	vSize := (weight + 3) / 4
+	return int64(math.Ceil(feeRate * float64(vSize)))
+}
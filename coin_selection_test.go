@@ -0,0 +1,175 @@
+package leafy_test
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"math/rand"
+	"testing"
+)
+
+// at 1 sat/vByte, each key path input costs 58 sats and the base transaction (one P2TR output) costs 54 sats
+const (
+	selectionInputFee = 58
+	selectionBaseFee  = 54
+)
+
+func TestBranchAndBoundCoinSelector(t *testing.T) {
+	utxos := createSelectionUtxos(100000, 50058, 30058, 20058)
+	request := leafy.NewCoinSelectionRequest(80000-selectionBaseFee, 1, 172)
+
+	selector := &leafy.BranchAndBoundCoinSelector{}
+	selection, err := selector.Select(utxos, request)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(selection.Utxos))
+	require.EqualValues(t, 50058, selection.Utxos[0].Amount)
+	require.EqualValues(t, 30058, selection.Utxos[1].Amount)
+	require.EqualValues(t, 0, selection.Change)
+	require.EqualValues(t, selection.GetInputAmount()-request.Target, selection.Fee)
+	// inputs are cheaper now than at the long-term fee rate and there is 1 sat of excess
+	require.EqualValues(t, 2*(selectionInputFee-580)+1, selection.Waste)
+
+	// no changeless solution
+	request = leafy.NewCoinSelectionRequest(10000, 1, 172)
+	_, err = selector.Select(utxos, request)
+	require.Error(t, err)
+	selector.Fallback = &leafy.LargestFirstCoinSelector{}
+	selection, err = selector.Select(utxos, request)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(selection.Utxos))
+	require.EqualValues(t, 100000, selection.Utxos[0].Amount)
+	require.True(t, selection.Change > 0)
+}
+
+func TestLeastWasteCoinSelector(t *testing.T) {
+	utxos := createSelectionUtxos(100000, 50058, 30058, 20058)
+	request := leafy.NewCoinSelectionRequest(80000-selectionBaseFee, 1, 172)
+	largestFirst, err := (&leafy.LargestFirstCoinSelector{}).Select(utxos, request)
+	require.NoError(t, err)
+	changeless, err := (&leafy.BranchAndBoundCoinSelector{}).Select(utxos, request)
+	require.NoError(t, err)
+	require.Less(t, changeless.Waste, largestFirst.Waste)
+
+	// the least waste is chosen regardless of order and failing candidates are skipped
+	selector := &leafy.LeastWasteCoinSelector{Candidates: []leafy.CoinSelector{
+		&leafy.LargestFirstCoinSelector{},
+		&leafy.BranchAndBoundCoinSelector{},
+	}}
+	selection, err := selector.Select(utxos, request)
+	require.NoError(t, err)
+	require.Equal(t, changeless, selection)
+	request = leafy.NewCoinSelectionRequest(10000, 1, 172)
+	selection, err = selector.Select(utxos, request)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(selection.Utxos))
+	require.EqualValues(t, 100000, selection.Utxos[0].Amount)
+
+	_, err = selector.Select(utxos, leafy.NewCoinSelectionRequest(1000000, 1, 172))
+	require.Error(t, err)
+	_, err = (&leafy.LeastWasteCoinSelector{}).Select(utxos, request)
+	require.Error(t, err)
+}
+
+func TestLargestFirstCoinSelector(t *testing.T) {
+	utxos := createSelectionUtxos(1000, 100000, 5000)
+	selection, err := (&leafy.LargestFirstCoinSelector{}).Select(utxos, leafy.NewCoinSelectionRequest(50000, 1, 172))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(selection.Utxos))
+	require.EqualValues(t, 100000, selection.Utxos[0].Amount)
+	require.EqualValues(t, 100000-50000-selection.Fee, selection.Change)
+
+	// insufficient
+	_, err = (&leafy.LargestFirstCoinSelector{}).Select(utxos, leafy.NewCoinSelectionRequest(106000, 1, 172))
+	require.Error(t, err)
+}
+
+func TestOldestFirstCoinSelector(t *testing.T) {
+	utxos := createSelectionUtxos(40000, 40000, 40000)
+	utxos[0].BlockHeight = 0 // unconfirmed
+	utxos[1].BlockHeight = 200
+	utxos[2].BlockHeight = 100
+	selection, err := (&leafy.OldestFirstCoinSelector{}).Select(utxos, leafy.NewCoinSelectionRequest(50000, 1, 172))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(selection.Utxos))
+	require.EqualValues(t, 100, selection.Utxos[0].BlockHeight)
+	require.EqualValues(t, 200, selection.Utxos[1].BlockHeight)
+}
+
+func TestRandomCoinSelectors(t *testing.T) {
+	utxos := createSelectionUtxos(1000, 2000, 3000, 4000, 5000, 6000, 7000, 8000, 9000, 10000)
+	request := leafy.NewCoinSelectionRequest(20000, 2, 172)
+	selectors := []leafy.CoinSelector{
+		&leafy.KnapsackCoinSelector{Random: rand.New(rand.NewSource(1))},
+		&leafy.SingleRandomDrawCoinSelector{Random: rand.New(rand.NewSource(1))},
+	}
+	for _, selector := range selectors {
+		selection, err := selector.Select(utxos, request)
+		require.NoError(t, err)
+		require.EqualValues(t, selection.GetInputAmount(), request.Target+selection.Fee+selection.Change)
+		require.True(t, selection.Change == 0 || selection.Change > leafy.P2trDustAmt)
+	}
+	// exact match is found
+	utxos = createSelectionUtxos(1000, 20000+selectionInputFee+selectionBaseFee, 30000)
+	selection, err := (&leafy.KnapsackCoinSelector{}).Select(utxos, leafy.NewCoinSelectionRequest(20000, 1, 172))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(selection.Utxos))
+	require.EqualValues(t, 0, selection.Change)
+}
+
+func TestGetCoinSelector(t *testing.T) {
+	selector, err := leafy.GetCoinSelector("")
+	require.NoError(t, err)
+	require.Nil(t, selector)
+	for _, name := range []string{leafy.CoinSelectionBranchAndBound, leafy.CoinSelectionKnapsack,
+		leafy.CoinSelectionLargestFirst, leafy.CoinSelectionOldestFirst, leafy.CoinSelectionSingleRandomDraw} {
+		selector, err = leafy.GetCoinSelector(name)
+		require.NoError(t, err)
+		require.NotNil(t, selector)
+	}
+	_, err = leafy.GetCoinSelector("foo")
+	require.Error(t, err)
+}
+
+func TestCreateTransactionWithCoinSelector(t *testing.T) {
+	addr, err := btcutil.DecodeAddress("bcrt1pkm32th8q6qhhnx5l5qmf7v3s29fsdsytl5h69c05chgz9mf4yl2qwnyzzk", &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	utxos := createSelectionUtxos(100000, 50058, 30058, 20058)
+
+	tx, err := leafy.CreateTransactionWithCoinSelector(utxos, addr, addr, 80000-selectionBaseFee, 1,
+		&leafy.BranchAndBoundCoinSelector{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(tx.MsgTx.TxIn))
+	require.Equal(t, 1, len(tx.MsgTx.TxOut))
+	require.EqualValues(t, 80116, tx.TxInputAmt)
+	require.EqualValues(t, 170, tx.TxFeeAmt)
+	require.EqualValues(t, 0, tx.TxChangeAmt)
+
+	tx, err = leafy.CreateTransactionWithCoinSelector(utxos, addr, addr, 10000, 1, &leafy.LargestFirstCoinSelector{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(tx.MsgTx.TxIn))
+	require.Equal(t, 2, len(tx.MsgTx.TxOut))
+	require.EqualValues(t, tx.TxInputAmt-10000-tx.TxFeeAmt, tx.TxChangeAmt)
+	require.EqualValues(t, tx.TxChangeAmt, tx.MsgTx.TxOut[1].Value)
+
+	_, err = leafy.CreateTransactionWithCoinSelector(utxos, addr, addr, 1000000, 1, &leafy.LargestFirstCoinSelector{})
+	require.Error(t, err)
+	_, err = leafy.CreateTransactionWithCoinSelector(utxos, addr, addr, 1000, 0, &leafy.LargestFirstCoinSelector{})
+	require.Error(t, err)
+}
+
+func createSelectionUtxos(amounts ...int64) []leafy.Utxo {
+	utxos := make([]leafy.Utxo, 0, len(amounts))
+	for index, amount := range amounts {
+		utxos = append(utxos, leafy.Utxo{
+			Outpoint: wire.OutPoint{
+				Hash:  chainhash.DoubleHashH([]byte("foo bar")),
+				Index: uint32(index),
+			},
+			Amount: amount,
+		})
+	}
+	return utxos
+}
@@ -0,0 +1,182 @@
+package leafy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"sort"
+)
+
+// CompactFilterSource serves a chain's blocks and their BIP-158 basic filters, e.g. a BIP-157 peer or a node with
+// a block filter index (see BitcoindClient)
+type CompactFilterSource interface {
+	// BlockHash returns the hash of the block at 'height'
+	BlockHash(height int64) (*chainhash.Hash, error)
+	// BasicFilter returns the basic filter of the block 'blockHash'
+	BasicFilter(blockHash *chainhash.Hash) (*gcs.Filter, error)
+	// Block returns the block 'blockHash'
+	Block(blockHash *chainhash.Hash) (*wire.MsgBlock, error)
+}
+
+// CompactFilterScanner finds the utxos of scripts, e.g. the addresses of a Leafy wallet, by matching them against
+// blocks' BIP-158 filters and fetching only the matching blocks, so that the scripts are not revealed to the
+// source. Scans accumulate; a scan's utxos spent in later scanned blocks are removed.
+type CompactFilterScanner struct {
+	params  *chaincfg.Params
+	source  CompactFilterSource
+	scripts map[string]*scannedScript
+	utxos   map[wire.OutPoint]Utxo
+}
+
+type scannedScript struct {
+	address    string
+	derivation *AddressDerivation
+}
+
+// NewCompactFilterScanner creates a CompactFilterScanner of the 'params' network's blocks and filters of 'source'
+func NewCompactFilterScanner(params *chaincfg.Params, source CompactFilterSource) *CompactFilterScanner {
+	return &CompactFilterScanner{
+		params:  params,
+		source:  source,
+		scripts: map[string]*scannedScript{},
+		utxos:   map[wire.OutPoint]Utxo{},
+	}
+}
+
+// AddWalletAddresses adds the 'num' addresses of 'wallet' on 'chain', from 'startIndex', as per GetChainAddresses.
+// Their utxos carry their derivation; see Utxo.WithChainDerivation.
+func (s *CompactFilterScanner) AddWalletAddresses(wallet RecoveryWallet, chain uint32, startIndex uint32, num uint8) error {
+	addresses, err := GetChainAddresses(s.params, wallet, chain, startIndex, num)
+	if err != nil {
+		return err
+	}
+	for i, address := range addresses {
+		derivation := AddressDerivation{Chain: chain, Index: startIndex + uint32(i)}
+		if err = s.addAddress(address, &derivation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddAddress adds 'address', whose utxos carry no derivation
+func (s *CompactFilterScanner) AddAddress(address string) error {
+	return s.addAddress(address, nil)
+}
+
+func (s *CompactFilterScanner) addAddress(address string, derivation *AddressDerivation) error {
+	decoded, err := btcutil.DecodeAddress(address, s.params)
+	if err != nil {
+		return err
+	}
+	if !decoded.IsForNet(s.params) {
+		return fmt.Errorf("address %v is not for network %v", address, s.params.Name)
+	}
+	script, err := txscript.PayToAddrScript(decoded)
+	if err != nil {
+		return err
+	}
+	s.scripts[string(script)] = &scannedScript{address: address, derivation: derivation}
+	return nil
+}
+
+// Scan matches the blocks from 'startHeight' to 'endHeight', inclusive and in order, and returns the heights of
+// those fetched; a filter's false positives are fetched too
+func (s *CompactFilterScanner) Scan(startHeight int64, endHeight int64) ([]int64, error) {
+	if startHeight < 0 || endHeight < startHeight {
+		return nil, fmt.Errorf("invalid scan range [%d, %d]", startHeight, endHeight)
+	}
+	scripts := make([][]byte, 0, len(s.scripts))
+	for script := range s.scripts {
+		scripts = append(scripts, []byte(script))
+	}
+	if len(scripts) == 0 {
+		return nil, nil
+	}
+	var fetched []int64
+	for height := startHeight; height <= endHeight; height++ {
+		blockHash, err := s.source.BlockHash(height)
+		if err != nil {
+			return nil, fmt.Errorf("block hash at height %d: %w", height, err)
+		}
+		filter, err := s.source.BasicFilter(blockHash)
+		if err != nil {
+			return nil, fmt.Errorf("filter of block %v: %w", blockHash, err)
+		}
+		matched, err := filter.MatchAny(builder.DeriveKey(blockHash), scripts)
+		if err != nil {
+			return nil, fmt.Errorf("filter of block %v: %w", blockHash, err)
+		}
+		if !matched {
+			continue
+		}
+		block, err := s.source.Block(blockHash)
+		if err != nil {
+			return nil, fmt.Errorf("block %v: %w", blockHash, err)
+		}
+		if block.BlockHash() != *blockHash {
+			return nil, fmt.Errorf("block %v served for %v", block.BlockHash(), blockHash)
+		}
+		s.scanBlock(block, height)
+		fetched = append(fetched, height)
+	}
+	return fetched, nil
+}
+
+func (s *CompactFilterScanner) scanBlock(block *wire.MsgBlock, height int64) {
+	for _, tx := range block.Transactions {
+		for _, txIn := range tx.TxIn {
+			delete(s.utxos, txIn.PreviousOutPoint)
+		}
+		txHash := tx.TxHash()
+		for index, txOut := range tx.TxOut {
+			scanned, ok := s.scripts[string(txOut.PkScript)]
+			if !ok {
+				continue
+			}
+			utxo := Utxo{
+				FromAddress: scanned.address,
+				Outpoint:    wire.OutPoint{Hash: txHash, Index: uint32(index)},
+				Amount:      txOut.Value,
+				Script:      hex.EncodeToString(txOut.PkScript),
+				BlockHeight: height,
+			}
+			if scanned.derivation != nil {
+				index := scanned.derivation.Index
+				utxo.DerivationChain = scanned.derivation.Chain
+				utxo.DerivationIndex = &index
+			}
+			s.utxos[utxo.Outpoint] = utxo
+		}
+	}
+}
+
+// Utxos returns the utxos found by the scans, ordered by height and then outpoint
+func (s *CompactFilterScanner) Utxos() []Utxo {
+	utxos := make([]Utxo, 0, len(s.utxos))
+	for _, utxo := range s.utxos {
+		utxos = append(utxos, utxo)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].BlockHeight != utxos[j].BlockHeight {
+			return utxos[i].BlockHeight < utxos[j].BlockHeight
+		}
+		if c := bytes.Compare(utxos[i].Outpoint.Hash[:], utxos[j].Outpoint.Hash[:]); c != 0 {
+			return c < 0
+		}
+		return utxos[i].Outpoint.Index < utxos[j].Outpoint.Index
+	})
+	return utxos
+}
+
+// decodeBasicFilter decodes the serialization of a BIP-158 basic filter, i.e. N followed by the filter's bits
+func decodeBasicFilter(serialized []byte) (*gcs.Filter, error) {
+	return gcs.FromNBytes(builder.DefaultP, builder.DefaultM, serialized)
+}
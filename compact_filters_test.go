@@ -0,0 +1,180 @@
+package leafy_test
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+	"time"
+)
+
+// fixtureFilterSource is a CompactFilterSource of blocks built by the test, along with their basic filters
+type fixtureFilterSource struct {
+	t         *testing.T
+	blocks    []*wire.MsgBlock
+	filters   []*gcs.Filter
+	prevOuts  map[wire.OutPoint][]byte
+	requested []chainhash.Hash
+}
+
+func newFixtureFilterSource(t *testing.T) *fixtureFilterSource {
+	return &fixtureFilterSource{t: t, prevOuts: map[wire.OutPoint][]byte{}}
+}
+
+// addBlock appends a block of a coinbase and 'txs'
+func (f *fixtureFilterSource) addBlock(txs ...*wire.MsgTx) {
+	height := len(f.blocks)
+	coinbase := wire.NewMsgTx(2)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+		[]byte{byte(height), 0x51}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(50_0000_0000, []byte{txscript.OP_TRUE}))
+	var prevBlock chainhash.Hash
+	if height > 0 {
+		prevBlock = f.blocks[height-1].BlockHash()
+	}
+	block := wire.NewMsgBlock(wire.NewBlockHeader(0x20000000, &prevBlock, &chainhash.Hash{}, 0x207fffff,
+		uint32(height)))
+	block.Header.Timestamp = time.Unix(1700000000+int64(height)*600, 0)
+	var prevOutScripts [][]byte
+	for _, tx := range append([]*wire.MsgTx{coinbase}, txs...) {
+		require.NoError(f.t, block.AddTransaction(tx))
+		for _, txIn := range tx.TxIn {
+			if script, ok := f.prevOuts[txIn.PreviousOutPoint]; ok {
+				prevOutScripts = append(prevOutScripts, script)
+			}
+		}
+		for index, txOut := range tx.TxOut {
+			f.prevOuts[wire.OutPoint{Hash: tx.TxHash(), Index: uint32(index)}] = txOut.PkScript
+		}
+	}
+	filter, err := builder.BuildBasicFilter(block, prevOutScripts)
+	require.NoError(f.t, err)
+	f.blocks = append(f.blocks, block)
+	f.filters = append(f.filters, filter)
+}
+
+func (f *fixtureFilterSource) height(blockHash *chainhash.Hash) int {
+	for height, block := range f.blocks {
+		if block.BlockHash() == *blockHash {
+			return height
+		}
+	}
+	require.Fail(f.t, "unknown block", blockHash.String())
+	return -1
+}
+
+func (f *fixtureFilterSource) BlockHash(height int64) (*chainhash.Hash, error) {
+	if height >= int64(len(f.blocks)) {
+		return nil, fmt.Errorf("block height out of range")
+	}
+	blockHash := f.blocks[height].BlockHash()
+	return &blockHash, nil
+}
+
+func (f *fixtureFilterSource) BasicFilter(blockHash *chainhash.Hash) (*gcs.Filter, error) {
+	return f.filters[f.height(blockHash)], nil
+}
+
+func (f *fixtureFilterSource) Block(blockHash *chainhash.Hash) (*wire.MsgBlock, error) {
+	f.requested = append(f.requested, *blockHash)
+	return f.blocks[f.height(blockHash)], nil
+}
+
+func fixtureTx(prevOut wire.OutPoint, outputs ...*wire.TxOut) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&prevOut, nil, [][]byte{make([]byte, 64)}))
+	for _, output := range outputs {
+		tx.AddTxOut(output)
+	}
+	return tx
+}
+
+func TestCompactFilterScanner(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	external, err := leafy.GetAddresses(params, wallet, 0, 5)
+	require.NoError(t, err)
+	internal, err := leafy.GetChainAddresses(params, wallet, leafy.InternalChain, 0, 2)
+	require.NoError(t, err)
+	otherMnemonic, err := leafy.GenerateMnemonic()
+	require.NoError(t, err)
+	otherAddresses, err := leafy.GetAddresses(params, leafy.NewWallet(otherMnemonic, otherMnemonic), 0, 1)
+	require.NoError(t, err)
+	other := addressScript(t, params, otherAddresses[0])
+
+	source := newFixtureFilterSource(t)
+	source.addBlock()
+	funding := fixtureTx(wire.OutPoint{Hash: source.blocks[0].Transactions[0].TxHash()},
+		wire.NewTxOut(50_000, addressScript(t, params, external[0])),
+		wire.NewTxOut(70_000, addressScript(t, params, external[4])),
+		wire.NewTxOut(1_000_000, other))
+	source.addBlock(funding)
+	source.addBlock(fixtureTx(wire.OutPoint{Hash: funding.TxHash(), Index: 2}, wire.NewTxOut(990_000, other)))
+	spending := fixtureTx(wire.OutPoint{Hash: funding.TxHash(), Index: 0},
+		wire.NewTxOut(20_000, addressScript(t, params, otherAddresses[0])),
+		wire.NewTxOut(29_000, addressScript(t, params, internal[1])))
+	source.addBlock(spending)
+	source.addBlock()
+
+	scanner := leafy.NewCompactFilterScanner(params, source)
+	fetched, err := scanner.Scan(0, 4)
+	require.NoError(t, err)
+	require.Empty(t, fetched)
+
+	require.NoError(t, scanner.AddWalletAddresses(wallet, leafy.ExternalChain, 0, 5))
+	require.NoError(t, scanner.AddWalletAddresses(wallet, leafy.InternalChain, 0, 2))
+	fetched, err = scanner.Scan(0, 2)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, fetched)
+	utxos := scanner.Utxos()
+	require.Len(t, utxos, 2)
+	require.Equal(t, external[0], utxos[0].FromAddress)
+	require.Equal(t, wire.OutPoint{Hash: funding.TxHash(), Index: 0}, utxos[0].Outpoint)
+	require.Equal(t, int64(50_000), utxos[0].Amount)
+	require.Equal(t, int64(1), utxos[0].BlockHeight)
+	require.Equal(t, uint32(0), *utxos[0].DerivationIndex)
+	require.Equal(t, external[4], utxos[1].FromAddress)
+	require.Equal(t, uint32(4), *utxos[1].DerivationIndex)
+
+	// the next scan removes the spent utxo and adds the change
+	fetched, err = scanner.Scan(3, 4)
+	require.NoError(t, err)
+	require.Equal(t, []int64{3}, fetched)
+	utxos = scanner.Utxos()
+	require.Len(t, utxos, 2)
+	require.Equal(t, external[4], utxos[0].FromAddress)
+	require.Equal(t, internal[1], utxos[1].FromAddress)
+	require.Equal(t, wire.OutPoint{Hash: spending.TxHash(), Index: 1}, utxos[1].Outpoint)
+	require.Equal(t, int64(3), utxos[1].BlockHeight)
+	require.Equal(t, leafy.InternalChain, utxos[1].DerivationChain)
+	require.Equal(t, uint32(1), *utxos[1].DerivationIndex)
+	script, err := utxos[1].DecodeScript()
+	require.NoError(t, err)
+	require.Equal(t, addressScript(t, params, internal[1]), script)
+	// only the matching blocks were requested
+	require.Equal(t, []chainhash.Hash{source.blocks[1].BlockHash(), source.blocks[3].BlockHash()}, source.requested)
+
+	// addresses without derivation
+	plain := leafy.NewCompactFilterScanner(params, source)
+	require.NoError(t, plain.AddAddress(otherAddresses[0]))
+	fetched, err = plain.Scan(0, 4)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 3}, fetched)
+	utxos = plain.Utxos()
+	require.Len(t, utxos, 2)
+	require.Nil(t, utxos[0].DerivationIndex)
+	require.Equal(t, int64(990_000), utxos[0].Amount)
+	require.Equal(t, int64(20_000), utxos[1].Amount)
+
+	_, err = scanner.Scan(3, 2)
+	require.ErrorContains(t, err, "invalid scan range [3, 2]")
+	_, err = scanner.Scan(4, 5)
+	require.ErrorContains(t, err, "block hash at height 5")
+	require.Error(t, scanner.AddAddress("bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"))
+}
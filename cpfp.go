@@ -0,0 +1,101 @@
+package leafy
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"math"
+)
+
+// CpfpParent is an unconfirmed transaction whose fee rate is raised by a child-pays-for-parent transaction
+type CpfpParent struct {
+	// Fee is the fee, in sats, paid by the parent
+	Fee int64
+	// VSize is the virtual size, in vBytes, of the parent
+	VSize int64
+}
+
+// NewCpfpParent creates a CpfpParent for the signed 'tx' which paid 'fee'
+func NewCpfpParent(tx *wire.MsgTx, fee int64) CpfpParent {
+	weight := blockchain.GetTransactionWeight(btcutil.NewTx(tx))
+	return CpfpParent{
+		Fee:   fee,
+		VSize: (weight + (blockchain.WitnessScaleFactor - 1)) / blockchain.WitnessScaleFactor,
+	}
+}
+
+// CpfpChildFee is the fee, in sats, a child of 'childVSize' vBytes must pay for the package of it and 'parents'
+// to pay 'feeRate' (in sat/vByte). The child always pays, at least, 'feeRate' for itself.
+func CpfpChildFee(parents []CpfpParent, childVSize int64, feeRate float64) int64 {
+	packageFee := int64(0)
+	packageVSize := childVSize
+	for _, parent := range parents {
+		packageFee += parent.Fee
+		packageVSize += parent.VSize
+	}
+	childFee := int64(math.Ceil(feeRate*float64(packageVSize))) - packageFee
+	if ownFee := int64(math.Ceil(feeRate * float64(childVSize))); ownFee > childFee {
+		return ownFee
+	}
+	return childFee
+}
+
+// Cpfp creates a child of 'parents' spending the Leafy 'outputs' (of the parents) to 'destAddr' such that the
+// package pays 'feeRate' and signs it via the key path. See CreateCpfpTransaction.
+func Cpfp(
+	params *chaincfg.Params,
+	wallet Wallet,
+	parents []CpfpParent,
+	outputs []Utxo,
+	destAddr btcutil.Address,
+	feeRate float64,
+) (*SignedMsg, error) {
+	tx, err := CreateCpfpTransaction(parents, outputs, destAddr, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	return SignTransaction(params, wallet, tx)
+}
+
+// CreateCpfpTransaction constructs a child transaction spending all of the 'outputs' (owned by the Leafy wallet)
+// of the unconfirmed 'parents' to 'destAddr'. The child fee, estimated for signing via the key path, is such that the
+// package of the 'parents' and the child pays 'feeRate' (in sat/vByte); see CpfpChildFee.
+//
+// There is no recovery path child as it would only be valid once each of the 'outputs' has the wallet's timelock of
+// confirmations (BIP-68), i.e. never while the 'parents' are unconfirmed.
+func CreateCpfpTransaction(
+	parents []CpfpParent,
+	outputs []Utxo,
+	destAddr btcutil.Address,
+	feeRate float64,
+) (*TransactionInfo, error) {
+	if feeRate <= 0 {
+		return nil, fmt.Errorf("invalid fee rate; should be >= 0")
+	}
+	if len(parents) == 0 {
+		return nil, fmt.Errorf("at least one parent is required")
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("at least one parent output is required")
+	}
+	destScript, err := txscript.PayToAddrScript(destAddr)
+	if err != nil {
+		return nil, err
+	}
+	estimator := &WeightEstimator{}
+	estimator.AddOutput(destScript)
+	var amount int64
+	for _, output := range outputs {
+		estimator.AddLeafyInput(KeyPathSpend)
+		amount += output.Amount
+	}
+	fee := CpfpChildFee(parents, estimator.VSize(), feeRate)
+	destOutput := wire.NewTxOut(amount-fee, destScript)
+	if amount-fee <= 0 || isDust(destOutput) {
+		return nil, fmt.Errorf("insufficient funds for child fee; need %d have %d", fee, amount)
+	}
+	return newTransactionInfo(outputs, []*wire.TxOut{destOutput}, fee, 0, KeyPathSpend, 0)
+}
@@ -0,0 +1,78 @@
+package leafy_test
+
+import (
+	"encoding/hex"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestCpfpChildFee(t *testing.T) {
+	// package of 300 vBytes at 5 sat/vByte less what the parent paid
+	require.EqualValues(t, 1400, leafy.CpfpChildFee([]leafy.CpfpParent{{Fee: 100, VSize: 200}}, 100, 5))
+	require.EqualValues(t, 2400, leafy.CpfpChildFee([]leafy.CpfpParent{{Fee: 100, VSize: 200},
+		{Fee: 0, VSize: 200}}, 100, 5))
+	// parent already pays more than the target; the child pays for itself
+	require.EqualValues(t, 200, leafy.CpfpChildFee([]leafy.CpfpParent{{Fee: 10000, VSize: 100}}, 100, 2))
+}
+
+func TestCpfp(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, ownAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+
+	// a stuck parent paying (with change) back to the wallet
+	parentTx, err := leafy.CreateAndSignTransaction(params, wallet, utxos, ownAddress, ownAddress, 25000, 1)
+	require.NoError(t, err)
+	parent := leafy.NewCpfpParent(parentTx.Msg, requireFee(t, parentTx.Msg, utxos))
+	outputs := parentOutputs(t, parentTx.Msg, ownAddress)
+	require.Equal(t, 2, len(outputs))
+
+	destination, _ := createBatchAddresses(t, params)
+	child, err := leafy.Cpfp(params, wallet, []leafy.CpfpParent{parent}, outputs, destination, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(child.Msg.TxIn))
+	require.Equal(t, 1, len(child.Msg.TxOut))
+	requireValidWitnesses(t, child.Msg, outputs)
+	requirePackageFeeRate(t, parent, child.Msg, outputs, 10)
+
+	// outputs cannot pay for the package
+	_, err = leafy.Cpfp(params, wallet, []leafy.CpfpParent{parent}, outputs, destination, 1000)
+	require.Error(t, err)
+	_, err = leafy.Cpfp(params, wallet, nil, outputs, destination, 10)
+	require.Error(t, err)
+}
+
+// parentOutputs returns the outputs of 'msgTx' paying to 'address' as utxos
+func parentOutputs(t *testing.T, msgTx *wire.MsgTx, address btcutil.Address) []leafy.Utxo {
+	t.Helper()
+	script, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	outputs := make([]leafy.Utxo, 0)
+	for index, txout := range msgTx.TxOut {
+		if string(txout.PkScript) != string(script) {
+			continue
+		}
+		outputs = append(outputs, leafy.Utxo{
+			FromAddress: address.EncodeAddress(),
+			Outpoint:    wire.OutPoint{Hash: msgTx.TxHash(), Index: uint32(index)},
+			Amount:      txout.Value,
+			Script:      hex.EncodeToString(txout.PkScript),
+		})
+	}
+	return outputs
+}
+
+func requirePackageFeeRate(t *testing.T, parent leafy.CpfpParent, child *wire.MsgTx, outputs []leafy.Utxo, feeRate int64) {
+	t.Helper()
+	childFee := requireFee(t, child, outputs)
+	childVSize := (blockchain.GetTransactionWeight(btcutil.NewTx(child)) + 3) / 4
+	require.True(t, parent.Fee+childFee >= feeRate*(parent.VSize+childVSize))
+	require.True(t, parent.Fee+childFee < feeRate*(parent.VSize+childVSize+1))
+}
@@ -0,0 +1,418 @@
+package leafy
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"strconv"
+	"strings"
+)
+
+const (
+	DescriptorTypeTaproot = "tr"
+	DescriptorTypeWpkh    = "wpkh"
+)
+
+var (
+	ErrDescriptorUnexpectedEnd       = errors.New("unexpected end of descriptor")
+	ErrDescriptorUnexpectedCharacter = errors.New("unexpected character")
+	ErrDescriptorUnsupportedScript   = errors.New("unsupported script")
+	ErrDescriptorInvalidFingerprint  = errors.New("invalid fingerprint")
+	ErrDescriptorInvalidPath         = errors.New("invalid derivation path")
+	ErrDescriptorInvalidKey          = errors.New("invalid key")
+	ErrDescriptorInvalidChecksum     = errors.New("invalid checksum")
+)
+
+// DescriptorError is a descriptor parse error at 'Position' (the byte offset into the descriptor). 'Err' is one of
+// the ErrDescriptor* errors, see errors.Is.
+type DescriptorError struct {
+	Err      error
+	Position int
+	Detail   string
+}
+
+func (e *DescriptorError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%v at position %d", e.Err, e.Position)
+	}
+	return fmt.Sprintf("%v at position %d: %s", e.Err, e.Position, e.Detail)
+}
+
+func (e *DescriptorError) Unwrap() error {
+	return e.Err
+}
+
+// Descriptor is a parsed single key output descriptor; i.e. "tr(KEY)" or "wpkh(KEY)"
+type Descriptor struct {
+	// Type is either DescriptorTypeTaproot or DescriptorTypeWpkh
+	Type string
+	Key  *DescriptorKey
+	// Checksum is the (validated) checksum, empty if the descriptor had none
+	Checksum string
+}
+
+// DescriptorKey is a key expression, see [BIP-380](https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki#key-expressions)
+type DescriptorKey struct {
+	// Fingerprint is the lower-case hex master key fingerprint of the key origin, empty if there is no key origin
+	Fingerprint string
+	// OriginPath is the derivation path of the key origin, of any depth
+	OriginPath []*PathItem
+	// ExtendedKey is set if the key is an extended key (in which case PublicKey is nil)
+	ExtendedKey *hdkeychain.ExtendedKey
+	// PublicKey is set if the key is a hex encoded public key
+	PublicKey *btcec.PublicKey
+	// ChildPath is the derivation path following an extended key, excluding any multipath element and wildcard
+	ChildPath []*PathItem
+	// Multipath is the alternatives of a [BIP-389](https://github.com/bitcoin/bips/blob/master/bip-0389.mediawiki)
+	// "<NUM;NUM>" element, if any, which follows the first MultipathPosition elements of ChildPath
+	Multipath         []*PathItem
+	MultipathPosition int
+	// Wildcard is true if the ChildPath is followed by "/*" (or WildcardHardened if by "/*'")
+	Wildcard         bool
+	WildcardHardened bool
+	raw              string
+}
+
+// HasOrigin returns true if the key has a key origin
+func (k *DescriptorKey) HasOrigin() bool {
+	return k.Fingerprint != ""
+}
+
+// String serializes the key expression (with "'" as the hardened marker)
+func (k *DescriptorKey) String() string {
+	var builder strings.Builder
+	if k.HasOrigin() {
+		builder.WriteString("[")
+		builder.WriteString(k.Fingerprint)
+		builder.WriteString(serializePath(k.OriginPath))
+		builder.WriteString("]")
+	}
+	builder.WriteString(k.raw)
+	if len(k.Multipath) > 0 {
+		builder.WriteString(serializePath(k.ChildPath[:k.MultipathPosition]))
+		builder.WriteString("/<")
+		for i, item := range k.Multipath {
+			if i > 0 {
+				builder.WriteString(";")
+			}
+			builder.WriteString(item.getDerivationValue())
+		}
+		builder.WriteString(">")
+		builder.WriteString(serializePath(k.ChildPath[k.MultipathPosition:]))
+	} else {
+		builder.WriteString(serializePath(k.ChildPath))
+	}
+	if k.Wildcard {
+		builder.WriteString("/*")
+		if k.WildcardHardened {
+			builder.WriteString("'")
+		}
+	}
+	return builder.String()
+}
+
+// ChildPathFor returns the ChildPath with the Multipath element, if any, replaced by 'alternative'. It is an error if
+// there is a Multipath element not including 'alternative'.
+func (k *DescriptorKey) ChildPathFor(alternative uint32) ([]*PathItem, error) {
+	if len(k.Multipath) == 0 {
+		return k.ChildPath, nil
+	}
+	for _, item := range k.Multipath {
+		if item.path == alternative {
+			path := make([]*PathItem, 0, len(k.ChildPath)+1)
+			path = append(path, k.ChildPath[:k.MultipathPosition]...)
+			path = append(path, item)
+			return append(path, k.ChildPath[k.MultipathPosition:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("multipath derivation does not include %s", (&PathItem{path: alternative}).getDerivationValue())
+}
+
+// String serializes the descriptor, without a checksum
+func (d *Descriptor) String() string {
+	return fmt.Sprintf("%s(%s)", d.Type, d.Key.String())
+}
+
+func serializePath(path []*PathItem) string {
+	var builder strings.Builder
+	for _, item := range path {
+		builder.WriteString("/")
+		builder.WriteString(item.getDerivationValue())
+	}
+	return builder.String()
+}
+
+// ParseDescriptor parses a "tr(KEY)" or "wpkh(KEY)" descriptor, with or without a checksum. Any error is a
+// *DescriptorError.
+func ParseDescriptor(descriptor string) (*Descriptor, error) {
+	parser := &descriptorParser{input: descriptor}
+	checksum := ""
+	if separator := strings.LastIndex(descriptor, "#"); separator >= 0 {
+		checksum = descriptor[separator+1:]
+		parser.input = descriptor[:separator]
+		if len(checksum) != descriptorChecksumLen {
+			return nil, &DescriptorError{Err: ErrDescriptorInvalidChecksum, Position: separator + 1,
+				Detail: fmt.Sprintf("expecting %d characters but was %d", descriptorChecksumLen, len(checksum))}
+		}
+		for index, character := range parser.input {
+			if !strings.ContainsRune(descriptorInputCharset, character) {
+				return nil, &DescriptorError{Err: ErrDescriptorUnexpectedCharacter, Position: index,
+					Detail: fmt.Sprintf("%q is not a descriptor character", character)}
+			}
+		}
+		expected, err := DescriptorChecksum(parser.input)
+		if err != nil {
+			return nil, &DescriptorError{Err: ErrDescriptorInvalidChecksum, Position: separator + 1, Detail: err.Error()}
+		}
+		if checksum != expected {
+			return nil, &DescriptorError{Err: ErrDescriptorInvalidChecksum, Position: separator + 1,
+				Detail: fmt.Sprintf("expecting %s but was %s", expected, checksum)}
+		}
+	}
+	parsed, err := parser.parseDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	parsed.Checksum = checksum
+	return parsed, nil
+}
+
+type descriptorParser struct {
+	input string
+	pos   int
+}
+
+func (p *descriptorParser) errorf(err error, position int, format string, args ...any) error {
+	return &DescriptorError{Err: err, Position: position, Detail: fmt.Sprintf(format, args...)}
+}
+
+func (p *descriptorParser) atEnd() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *descriptorParser) peek() byte {
+	if p.atEnd() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *descriptorParser) expect(expected byte) error {
+	if p.atEnd() {
+		return p.errorf(ErrDescriptorUnexpectedEnd, p.pos, "expecting '%c'", expected)
+	}
+	if actual := p.input[p.pos]; actual != expected {
+		return p.errorf(ErrDescriptorUnexpectedCharacter, p.pos, "expecting '%c' but was '%c'", expected, actual)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *descriptorParser) readWhile(predicate func(byte) bool) string {
+	start := p.pos
+	for !p.atEnd() && predicate(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *descriptorParser) parseDescriptor() (*Descriptor, error) {
+	scriptType := p.readWhile(func(c byte) bool { return c >= 'a' && c <= 'z' })
+	if scriptType != DescriptorTypeTaproot && scriptType != DescriptorTypeWpkh {
+		return nil, p.errorf(ErrDescriptorUnsupportedScript, 0, "expecting '%s' or '%s' but was '%s'",
+			DescriptorTypeTaproot, DescriptorTypeWpkh, scriptType)
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	key, err := p.parseKey(scriptType)
+	if err != nil {
+		return nil, err
+	}
+	if scriptType == DescriptorTypeTaproot && p.peek() == ',' {
+		return nil, p.errorf(ErrDescriptorUnsupportedScript, p.pos, "script trees are not supported")
+	}
+	if err = p.expect(')'); err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, p.errorf(ErrDescriptorUnexpectedCharacter, p.pos, "expecting end but was '%c'", p.peek())
+	}
+	return &Descriptor{Type: scriptType, Key: key}, nil
+}
+
+func (p *descriptorParser) parseKey(scriptType string) (*DescriptorKey, error) {
+	key := &DescriptorKey{}
+	if p.peek() == '[' {
+		p.pos++
+		start := p.pos
+		fingerprint := p.readWhile(isHexCharacter)
+		if len(fingerprint) != 8 {
+			return nil, p.errorf(ErrDescriptorInvalidFingerprint, start,
+				"expecting 8 hex characters but was '%s'", fingerprint)
+		}
+		key.Fingerprint = strings.ToLower(fingerprint)
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		key.OriginPath = path
+		if err = p.expect(']'); err != nil {
+			return nil, err
+		}
+	}
+	start := p.pos
+	// keys are base58 or hex, and base58 decoding panics on non-ASCII input
+	key.raw = p.readWhile(isAlphanumeric)
+	if key.raw == "" {
+		if p.atEnd() {
+			return nil, p.errorf(ErrDescriptorUnexpectedEnd, start, "expecting key")
+		}
+		return nil, p.errorf(ErrDescriptorInvalidKey, start, "expecting key but was '%c'", p.peek())
+	}
+	if publicKey, err := parseHexPublicKey(key.raw, scriptType); err == nil {
+		key.PublicKey = publicKey
+		if p.peek() == '/' {
+			return nil, p.errorf(ErrDescriptorInvalidPath, p.pos, "derivation requires an extended key")
+		}
+		return key, nil
+	}
+	extendedKey, err := hdkeychain.NewKeyFromString(key.raw)
+	if err != nil {
+		return nil, p.errorf(ErrDescriptorInvalidKey, start, "%v", err)
+	}
+	key.ExtendedKey = extendedKey
+	if err = p.parseChildPath(key); err != nil {
+		return nil, err
+	}
+	if p.peek() == '*' {
+		p.pos++
+		key.Wildcard = true
+		if isHardenedMarker(p.peek()) {
+			p.pos++
+			key.WildcardHardened = true
+		}
+	}
+	if !extendedKey.IsPrivate() {
+		for _, item := range append(append([]*PathItem{}, key.ChildPath...), key.Multipath...) {
+			if isHardened(item.path) {
+				return nil, p.errorf(ErrDescriptorInvalidPath, start, "hardened derivation from a public key")
+			}
+		}
+		if key.WildcardHardened {
+			return nil, p.errorf(ErrDescriptorInvalidPath, start, "hardened derivation from a public key")
+		}
+	}
+	return key, nil
+}
+
+// parsePath parses "/NUM['|h]" elements of a key origin
+func (p *descriptorParser) parsePath() ([]*PathItem, error) {
+	path := make([]*PathItem, 0)
+	for p.peek() == '/' {
+		p.pos++
+		item, err := p.parsePathItem()
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, item)
+	}
+	return path, nil
+}
+
+// parseChildPath parses the "/NUM['|h]" and (at most one) "/<NUM;NUM>" elements following an extended key; a
+// trailing "/" followed by "*" is left for the caller
+func (p *descriptorParser) parseChildPath(key *DescriptorKey) error {
+	key.ChildPath = make([]*PathItem, 0)
+	for p.peek() == '/' {
+		p.pos++
+		if p.peek() == '*' {
+			return nil
+		}
+		if p.peek() != '<' {
+			item, err := p.parsePathItem()
+			if err != nil {
+				return err
+			}
+			key.ChildPath = append(key.ChildPath, item)
+			continue
+		}
+		if len(key.Multipath) > 0 {
+			return p.errorf(ErrDescriptorInvalidPath, p.pos, "at most one multipath element is supported")
+		}
+		p.pos++
+		key.MultipathPosition = len(key.ChildPath)
+		for {
+			item, err := p.parsePathItem()
+			if err != nil {
+				return err
+			}
+			for _, existing := range key.Multipath {
+				if existing.path == item.path {
+					return p.errorf(ErrDescriptorInvalidPath, p.pos, "duplicate multipath derivation")
+				}
+			}
+			key.Multipath = append(key.Multipath, item)
+			if p.peek() != ';' {
+				break
+			}
+			p.pos++
+		}
+		if err := p.expect('>'); err != nil {
+			return err
+		}
+		if len(key.Multipath) < 2 {
+			return p.errorf(ErrDescriptorInvalidPath, p.pos, "multipath element requires at least two derivations")
+		}
+	}
+	return nil
+}
+
+func (p *descriptorParser) parsePathItem() (*PathItem, error) {
+	start := p.pos
+	digits := p.readWhile(func(c byte) bool { return c >= '0' && c <= '9' })
+	if digits == "" {
+		if p.atEnd() {
+			return nil, p.errorf(ErrDescriptorUnexpectedEnd, start, "expecting derivation index")
+		}
+		return nil, p.errorf(ErrDescriptorInvalidPath, start, "expecting derivation index but was '%c'", p.peek())
+	}
+	value, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil || value >= hdkeychain.HardenedKeyStart {
+		return nil, p.errorf(ErrDescriptorInvalidPath, start, "derivation index '%s' out of range", digits)
+	}
+	if isHardenedMarker(p.peek()) {
+		p.pos++
+		return PathHardened(uint32(value)), nil
+	}
+	return Path(uint32(value)), nil
+}
+
+func parseHexPublicKey(raw string, scriptType string) (*btcec.PublicKey, error) {
+	serialized, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(serialized) == schnorr.PubKeyBytesLen && scriptType == DescriptorTypeTaproot {
+		return schnorr.ParsePubKey(serialized)
+	}
+	if len(serialized) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("invalid public key length %d", len(serialized))
+	}
+	return btcec.ParsePubKey(serialized)
+}
+
+func isHexCharacter(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHardenedMarker(c byte) bool {
+	return c == '\'' || c == 'h' || c == 'H'
+}
@@ -0,0 +1,108 @@
+package leafy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// see [BIP-380 checksum](https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki#checksum)
+
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	descriptorChecksumLen     = 8
+)
+
+func descriptorPolymod(c uint64, value int) uint64 {
+	c0 := c >> 35
+	c = ((c & 0x7ffffffff) << 5) ^ uint64(value)
+	if c0&1 != 0 {
+		c ^= 0xf5dee51989
+	}
+	if c0&2 != 0 {
+		c ^= 0xa9fdca3312
+	}
+	if c0&4 != 0 {
+		c ^= 0x1bab10e32d
+	}
+	if c0&8 != 0 {
+		c ^= 0x3706b1677a
+	}
+	if c0&16 != 0 {
+		c ^= 0x644d626ffd
+	}
+	return c
+}
+
+// DescriptorChecksum computes the BIP-380 checksum of 'descriptor' (which must not itself include a checksum)
+func DescriptorChecksum(descriptor string) (string, error) {
+	c := uint64(1)
+	class := 0
+	classCount := 0
+	for index, character := range descriptor {
+		position := strings.IndexRune(descriptorInputCharset, character)
+		if position < 0 {
+			return "", fmt.Errorf("invalid descriptor character %q at position %d", character, index)
+		}
+		// emit a symbol for the position inside the group, for every character
+		c = descriptorPolymod(c, position&31)
+		// accumulate the group numbers
+		class = class*3 + (position >> 5)
+		classCount++
+		if classCount == 3 {
+			// emit an extra symbol representing the group numbers, for every 3 characters
+			c = descriptorPolymod(c, class)
+			class = 0
+			classCount = 0
+		}
+	}
+	if classCount > 0 {
+		c = descriptorPolymod(c, class)
+	}
+	// shift further to determine the checksum
+	for i := 0; i < descriptorChecksumLen; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	// prevent appending zeroes from not affecting the checksum
+	c ^= 1
+	checksum := make([]byte, descriptorChecksumLen)
+	for i := 0; i < descriptorChecksumLen; i++ {
+		checksum[i] = descriptorChecksumCharset[(c>>(5*(7-i)))&31]
+	}
+	return string(checksum), nil
+}
+
+// AddDescriptorChecksum returns 'descriptor' suffixed with '#' and its BIP-380 checksum. If 'descriptor' already
+// has a checksum, it is validated and 'descriptor' is returned as is.
+func AddDescriptorChecksum(descriptor string) (string, error) {
+	stripped, err := StripDescriptorChecksum(descriptor)
+	if err != nil {
+		return "", err
+	}
+	checksum, err := DescriptorChecksum(stripped)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s#%s", stripped, checksum), nil
+}
+
+// StripDescriptorChecksum returns 'descriptor' without its checksum, if any. A present checksum must be valid.
+func StripDescriptorChecksum(descriptor string) (string, error) {
+	separator := strings.LastIndex(descriptor, "#")
+	if separator < 0 {
+		return descriptor, nil
+	}
+	stripped, checksum := descriptor[:separator], descriptor[separator+1:]
+	if len(checksum) != descriptorChecksumLen {
+		return "", fmt.Errorf("invalid descriptor checksum length %d at position %d; expecting %d", len(checksum),
+			separator+1, descriptorChecksumLen)
+	}
+	expected, err := DescriptorChecksum(stripped)
+	if err != nil {
+		return "", err
+	}
+	if checksum != expected {
+		return "", fmt.Errorf("invalid descriptor checksum %s; expecting %s", checksum, expected)
+	}
+	return stripped, nil
+}
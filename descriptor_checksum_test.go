@@ -0,0 +1,98 @@
+package leafy_test
+
+import (
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestDescriptorChecksum(t *testing.T) {
+	// see BIP-380 test vectors
+	checksum, err := leafy.DescriptorChecksum("raw(deadbeef)")
+	require.NoError(t, err)
+	require.Equal(t, "89f8spxm", checksum)
+
+	stripped, err := leafy.StripDescriptorChecksum("raw(deadbeef)#89f8spxm")
+	require.NoError(t, err)
+	require.Equal(t, "raw(deadbeef)", stripped)
+	stripped, err = leafy.StripDescriptorChecksum("raw(deadbeef)")
+	require.NoError(t, err)
+	require.Equal(t, "raw(deadbeef)", stripped)
+
+	for _, invalid := range []string{
+		"raw(deadbeef)#",          // missing checksum
+		"raw(deadbeef)#89f8spxmx", // too long
+		"raw(deadbeef)#89f8spx",   // too short
+		"raw(deedbeef)#89f8spxm",  // error in payload
+		"raw(deedbeef)##9f8spxm",  // error in checksum
+		"raw(Ü)#00000000",         // invalid characters in payload
+	} {
+		_, err = leafy.StripDescriptorChecksum(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	checksummed, err := leafy.AddDescriptorChecksum("raw(deadbeef)")
+	require.NoError(t, err)
+	require.Equal(t, "raw(deadbeef)#89f8spxm", checksummed)
+	checksummed, err = leafy.AddDescriptorChecksum(checksummed)
+	require.NoError(t, err)
+	require.Equal(t, "raw(deadbeef)#89f8spxm", checksummed)
+}
+
+func TestImportFromTaprootDescriptorForParent(t *testing.T) {
+	master, err := hdkeychain.NewKeyFromString(masterSeed)
+	require.NoError(t, err)
+	bip44Key, err := leafy.CreateBip44Key(master,
+		leafy.PathHardened(44),
+		leafy.PathHardened(0),
+		leafy.PathHardened(0),
+		leafy.Path(0),
+		leafy.Path(0))
+	require.NoError(t, err)
+
+	withoutChecksum := bip44Key.GetTaprootParentDescriptorWithoutChecksum("")
+	withChecksum, err := bip44Key.GetTaprootParentDescriptor("")
+	require.NoError(t, err)
+	checksum, err := leafy.DescriptorChecksum(withoutChecksum)
+	require.NoError(t, err)
+	require.Equal(t, withoutChecksum+"#"+checksum, withChecksum)
+	wildcard, err := bip44Key.GetTaprootDescriptor("*")
+	require.NoError(t, err)
+	require.Equal(t, bip44Key.GetTaprootDescriptorWithoutChecksum("*"), wildcard[:len(wildcard)-9])
+	// a suffix outside the descriptor character set is an error rather than a panic
+	for _, get := range []func(string) (string, error){bip44Key.GetTaprootDescriptor,
+		bip44Key.GetTaprootParentDescriptor} {
+		_, err = get("/é")
+		require.Error(t, err)
+	}
+
+	for _, descriptor := range []string{withoutChecksum, withChecksum} {
+		imported, err := leafy.ImportFromTaprootDescriptorForParent(descriptor, leafy.Path(0))
+		require.NoError(t, err)
+		reexported, err := imported.GetTaprootParentDescriptor("")
+		require.NoError(t, err)
+		require.Equal(t, withChecksum, reexported)
+	}
+	_, err = leafy.ImportFromTaprootDescriptorForParent(withoutChecksum+"#aaaaaaaa", leafy.Path(0))
+	require.Error(t, err)
+}
+
+func TestGetDescriptorWithChecksum(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	descriptor, err := leafy.GetDescriptor(params, seedMnemonic)
+	require.NoError(t, err)
+	checksummed, err := leafy.GetDescriptorWithChecksum(params, seedMnemonic)
+	require.NoError(t, err)
+	stripped, err := leafy.StripDescriptorChecksum(checksummed)
+	require.NoError(t, err)
+	require.Equal(t, descriptor, stripped)
+
+	// recovery wallets accept checksummed descriptors
+	addresses, err := leafy.GetAddresses(params, leafy.NewRecoveryWallet(seedMnemonic, descriptor), 0, 2)
+	require.NoError(t, err)
+	checksummedAddresses, err := leafy.GetAddresses(params, leafy.NewRecoveryWallet(seedMnemonic, checksummed), 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, addresses, checksummedAddresses)
+}
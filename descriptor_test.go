@@ -0,0 +1,187 @@
+package leafy_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+const changeTpub = "tpubDFaA4bycWtPHMKZMdF85Pr1tK1m7fft4B6B8LtbVUWSAZnvYXL4pvsyKT1e8TXyduZR1tpjLJBsPRgia6YmQA95D25a6ptyNq9kKqHVNXFp"
+
+func TestParseDescriptor(t *testing.T) {
+	for _, valid := range []string{
+		fmt.Sprintf("tr([d33e9597/44'/0'/0'/0]%s)", changeTpub),
+		fmt.Sprintf("tr([d33e9597/44'/0'/0'/0]%s/*)", changeTpub),
+		fmt.Sprintf("tr([d33e9597]%s/0/1/2/3/*)", changeTpub),
+		fmt.Sprintf("wpkh([d33e9597/84'/1'/0'/0/5/7/9]%s)", changeTpub),
+		fmt.Sprintf("wpkh(%s/0)", changeTpub),
+		fmt.Sprintf("tr([d33e9597/44'/0'/0']%s/<0;1>/*)", changeTpub),
+		fmt.Sprintf("wpkh(%s/2/<0;1;5>/3)", changeTpub),
+		"wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)",
+		"tr(f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)",
+	} {
+		parsed, err := leafy.ParseDescriptor(valid)
+		require.NoError(t, err, valid)
+		require.Equal(t, valid, parsed.String())
+		require.Equal(t, "", parsed.Checksum)
+
+		checksummed, err := leafy.AddDescriptorChecksum(valid)
+		require.NoError(t, err)
+		parsed, err = leafy.ParseDescriptor(checksummed)
+		require.NoError(t, err, checksummed)
+		require.Equal(t, valid, parsed.String())
+		require.Equal(t, checksummed[len(checksummed)-8:], parsed.Checksum)
+	}
+
+	parsed, err := leafy.ParseDescriptor(fmt.Sprintf("tr([D33E9597/44h/0H/0'/0]%s/*)", changeTpub))
+	require.NoError(t, err)
+	require.Equal(t, leafy.DescriptorTypeTaproot, parsed.Type)
+	require.Equal(t, "d33e9597", parsed.Key.Fingerprint)
+	require.Equal(t, 4, len(parsed.Key.OriginPath))
+	require.Equal(t, 0, len(parsed.Key.ChildPath))
+	require.True(t, parsed.Key.Wildcard)
+	require.NotNil(t, parsed.Key.ExtendedKey)
+	require.Equal(t, fmt.Sprintf("tr([d33e9597/44'/0'/0'/0]%s/*)", changeTpub), parsed.String())
+
+	for _, invalid := range []struct {
+		descriptor string
+		err        error
+		position   int
+	}{
+		{"", leafy.ErrDescriptorUnsupportedScript, 0},
+		{"tr", leafy.ErrDescriptorUnexpectedEnd, 2},
+		{"sh(" + changeTpub + ")", leafy.ErrDescriptorUnsupportedScript, 0},
+		{"tr(", leafy.ErrDescriptorUnexpectedEnd, 3},
+		{"tr([", leafy.ErrDescriptorInvalidFingerprint, 4},
+		{"tr([d33e959]" + changeTpub + ")", leafy.ErrDescriptorInvalidFingerprint, 4},
+		{"tr([d33e95971]" + changeTpub + ")", leafy.ErrDescriptorInvalidFingerprint, 4},
+		{"tr([d33e959g]" + changeTpub + ")", leafy.ErrDescriptorInvalidFingerprint, 4},
+		{"tr([d33e9597/44'/0'", leafy.ErrDescriptorUnexpectedEnd, 19},
+		{"tr([d33e9597/44'/]" + changeTpub + ")", leafy.ErrDescriptorInvalidPath, 17},
+		{"tr([d33e9597/4294967296]" + changeTpub + ")", leafy.ErrDescriptorInvalidPath, 13},
+		{"tr([d33e9597/2147483648]" + changeTpub + ")", leafy.ErrDescriptorInvalidPath, 13},
+		{"tr([d33e9597/x]" + changeTpub + ")", leafy.ErrDescriptorInvalidPath, 13},
+		{"tr([d33e9597]" + changeTpub, leafy.ErrDescriptorUnexpectedEnd, 124},
+		{"tr([d33e9597])", leafy.ErrDescriptorInvalidKey, 13},
+		{"tr([d33e9597]tpubinvalid)", leafy.ErrDescriptorInvalidKey, 13},
+		{"tr(" + changeTpub + "/0')", leafy.ErrDescriptorInvalidPath, 3},
+		{"tr(" + changeTpub + "/*')", leafy.ErrDescriptorInvalidPath, 3},
+		{"tr(" + changeTpub + "/*/0)", leafy.ErrDescriptorUnexpectedCharacter, 116},
+		{"tr(" + changeTpub + ")x", leafy.ErrDescriptorUnexpectedCharacter, 115},
+		{"tr(" + changeTpub + ",pk(" + changeTpub + "))", leafy.ErrDescriptorUnsupportedScript, 114},
+		{"tr(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9/0)", leafy.ErrDescriptorInvalidPath, 69},
+		{"wpkh(f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)", leafy.ErrDescriptorInvalidKey, 5},
+		{"tr(" + changeTpub + "/<0>/*)", leafy.ErrDescriptorInvalidPath, 118},
+		{"tr(" + changeTpub + "/<0;0>/*)", leafy.ErrDescriptorInvalidPath, 119},
+		{"tr(" + changeTpub + "/<0;1>/<0;1>/*)", leafy.ErrDescriptorInvalidPath, 121},
+		{"tr(" + changeTpub + "/<0;1'>/*)", leafy.ErrDescriptorInvalidPath, 3},
+		{"tr(" + changeTpub + "/<;1>/*)", leafy.ErrDescriptorInvalidPath, 116},
+		{"tr(" + changeTpub + "/<0;1", leafy.ErrDescriptorUnexpectedEnd, 119},
+		{"tr(" + changeTpub + ")#", leafy.ErrDescriptorInvalidChecksum, 116},
+		{"tr(" + changeTpub + ")#aaaaaaaa", leafy.ErrDescriptorInvalidChecksum, 116},
+		{"tr(Ü)#aaaaaaaa", leafy.ErrDescriptorUnexpectedCharacter, 3},
+	} {
+		_, err := leafy.ParseDescriptor(invalid.descriptor)
+		require.Error(t, err, invalid.descriptor)
+		require.True(t, errors.Is(err, invalid.err), "%s: %v", invalid.descriptor, err)
+		var descriptorErr *leafy.DescriptorError
+		require.True(t, errors.As(err, &descriptorErr))
+		require.Equal(t, invalid.position, descriptorErr.Position, "%s: %v", invalid.descriptor, err)
+	}
+}
+
+func TestParseMultipathDescriptor(t *testing.T) {
+	parsed, err := leafy.ParseDescriptor(fmt.Sprintf("tr([d33e9597/44'/0'/0']%s/2/<0;1>/3/*)", changeTpub))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(parsed.Key.Multipath))
+	require.Equal(t, 1, parsed.Key.MultipathPosition)
+	require.Equal(t, 2, len(parsed.Key.ChildPath))
+	for _, alternative := range []uint32{0, 1} {
+		path, err := parsed.Key.ChildPathFor(alternative)
+		require.NoError(t, err)
+		require.Equal(t, []*leafy.PathItem{leafy.Path(2), leafy.Path(alternative), leafy.Path(3)}, path)
+	}
+	_, err = parsed.Key.ChildPathFor(2)
+	require.Error(t, err)
+
+	// without a multipath element, the child path
+	parsed, err = leafy.ParseDescriptor(fmt.Sprintf("tr(%s/0/*)", changeTpub))
+	require.NoError(t, err)
+	path, err := parsed.Key.ChildPathFor(1)
+	require.NoError(t, err)
+	require.Equal(t, []*leafy.PathItem{leafy.Path(0)}, path)
+}
+
+func TestImportFromTaprootDescriptorForParentDepth(t *testing.T) {
+	master, err := hdkeychain.NewKeyFromString(masterSeed)
+	require.NoError(t, err)
+	account := master
+	for _, path := range []uint32{44, 0, 0} {
+		account, err = account.Derive(hdkeychain.HardenedKeyStart + path)
+		require.NoError(t, err)
+	}
+	accountTpub, err := account.Neuter()
+	require.NoError(t, err)
+
+	expected := fmt.Sprintf("tr([%s/44'/0'/0'/0]%s)", masterSeedFingerprint, changeTpub)
+	for _, descriptor := range []string{
+		expected,
+		fmt.Sprintf("tr([%s/44'/0'/0'/0]%s/*)", masterSeedFingerprint, changeTpub),
+		fmt.Sprintf("tr([%s/44'/0'/0']%s/0/*)", masterSeedFingerprint, accountTpub.String()),
+		fmt.Sprintf("tr([%s/44'/0'/0']%s/0)", masterSeedFingerprint, accountTpub.String()),
+	} {
+		imported, err := leafy.ImportFromTaprootDescriptorForParent(descriptor, leafy.Path(0))
+		require.NoError(t, err, descriptor)
+		require.Equal(t, expected, imported.GetTaprootParentDescriptorWithoutChecksum(""))
+	}
+
+	for _, invalid := range []string{
+		fmt.Sprintf("tr([%s/44'/0'/0']%s)", masterSeedFingerprint, accountTpub.String()),
+		fmt.Sprintf("tr([%s/44'/0'/0'/0/0]%s)", masterSeedFingerprint, changeTpub),
+		fmt.Sprintf("wpkh([%s/44'/0'/0'/0]%s)", masterSeedFingerprint, changeTpub),
+		fmt.Sprintf("tr(%s)", changeTpub),
+		"tr([d33e9597/44'/0'/0'/0]f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)",
+		"tr([",
+		"tr([d33e9597",
+		"tr([d33e9597]",
+	} {
+		_, err = leafy.ImportFromTaprootDescriptorForParent(invalid, leafy.Path(0))
+		require.Error(t, err, invalid)
+		var descriptorErr *leafy.DescriptorError
+		require.True(t, errors.As(err, &descriptorErr), invalid)
+	}
+}
+
+func FuzzParseDescriptor(f *testing.F) {
+	for _, seed := range []string{
+		fmt.Sprintf("tr([d33e9597/44'/0'/0'/0]%s)", changeTpub),
+		fmt.Sprintf("tr([d33e9597/44h/0h/0h]%s/0/*)#abcdefgh", changeTpub),
+		fmt.Sprintf("wpkh(%s/0/*')", changeTpub),
+		"tr(f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)",
+		"tr([",
+		"tr([d33e9597/",
+		"tr([]])",
+		"tr(,)",
+		"#",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, descriptor string) {
+		parsed, err := leafy.ParseDescriptor(descriptor)
+		if err != nil {
+			var descriptorErr *leafy.DescriptorError
+			require.True(t, errors.As(err, &descriptorErr))
+			require.True(t, descriptorErr.Position >= 0 && descriptorErr.Position <= len(descriptor))
+			return
+		}
+		// a valid descriptor re-parses to the same descriptor
+		reparsed, err := leafy.ParseDescriptor(parsed.String())
+		require.NoError(t, err)
+		require.Equal(t, parsed.String(), reparsed.String())
+		_, _ = leafy.ImportFromTaprootDescriptorForParent(descriptor, leafy.Path(0))
+	})
+}
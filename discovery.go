@@ -0,0 +1,455 @@
+package leafy
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// DefaultGapLimit is the number of consecutive unused addresses after which discovery stops, as in BIP-44
+const DefaultGapLimit = 20
+
+const (
+	// maxAddressScan is the number of addresses derived when signing inputs without an AddressIndexer
+	maxAddressScan = 1000
+	// scanAddressBatch is the initial number of addresses derived when scanning, doubling thereafter
+	scanAddressBatch = 100
+)
+
+// ErrChainNotCovered is returned for addresses of a chain which the second descriptor of a RecoveryWallet does not
+// cover; e.g. the InternalChain of a descriptor of the ExternalChain alone, as exported prior to multipath descriptors
+var ErrChainNotCovered = errors.New("second descriptor does not cover the chain")
+
+// HistoryLookup reports, for each of 'scripts', whether it has any transaction history
+type HistoryLookup interface {
+	HasHistory(scripts [][]byte) ([]bool, error)
+}
+
+// HistoryLookupFunc adapts a function to a HistoryLookup
+type HistoryLookupFunc func(scripts [][]byte) ([]bool, error)
+
+func (f HistoryLookupFunc) HasHistory(scripts [][]byte) ([]bool, error) {
+	return f(scripts)
+}
+
+// AddressDerivation locates a Leafy address within a wallet
+type AddressDerivation struct {
+	// Chain is ExternalChain or InternalChain
+	Chain uint32
+	Index uint32
+	// Legacy is true for an address of the legacy coin type 0' on a test network; see WalletConfig.LegacyCoinType
+	Legacy bool
+}
+
+// AddressIndexer maps the script of a Leafy address to its derivation
+type AddressIndexer interface {
+	IndexOf(script []byte) (AddressDerivation, bool)
+}
+
+// AddressIndexers is an AddressIndexer consulting each of its indexers in turn
+type AddressIndexers []AddressIndexer
+
+func (i AddressIndexers) IndexOf(script []byte) (AddressDerivation, bool) {
+	for _, indexer := range i {
+		if derivation, found := indexer.IndexOf(script); found {
+			return derivation, true
+		}
+	}
+	return AddressDerivation{}, false
+}
+
+// DiscoveryResult is the outcome of DiscoverAddresses for a single chain
+type DiscoveryResult struct {
+	Chain uint32
+	// Legacy is true if the addresses are of the legacy coin type 0' on a test network
+	Legacy bool
+	// Used is true if any address has history, in which case HighestUsedIndex is the highest such index
+	Used             bool
+	HighestUsedIndex uint32
+	// ScriptIndices maps the hex encoded script of every derived address, through the gap, to its index
+	ScriptIndices map[string]uint32
+}
+
+// IndexOf implements AddressIndexer
+func (r *DiscoveryResult) IndexOf(script []byte) (AddressDerivation, bool) {
+	index, found := r.ScriptIndices[hex.EncodeToString(script)]
+	return AddressDerivation{Chain: r.Chain, Index: index, Legacy: r.Legacy}, found
+}
+
+// NextUnusedIndex is the index following HighestUsedIndex, or 0 if no address has history
+func (r *DiscoveryResult) NextUnusedIndex() uint32 {
+	if !r.Used {
+		return 0
+	}
+	return r.HighestUsedIndex + 1
+}
+
+// DiscoverAddresses walks the ExternalChain addresses of 'wallet' from index 0, querying 'lookup' for their history,
+// until 'gapLimit' consecutive addresses have none.
+func DiscoverAddresses(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	gapLimit uint32,
+	lookup HistoryLookup,
+) (*DiscoveryResult, error) {
+	return DiscoverChainAddresses(params, wallet, ExternalChain, gapLimit, lookup)
+}
+
+// DiscoverChainAddresses is DiscoverAddresses for the addresses of 'chain'
+func DiscoverChainAddresses(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	chain uint32,
+	gapLimit uint32,
+	lookup HistoryLookup,
+) (*DiscoveryResult, error) {
+	if gapLimit < 1 {
+		return nil, fmt.Errorf("invalid gap limit [%d], must be greater than 0", gapLimit)
+	}
+	return discoverBranchAddresses(params, wallet, addressBranch{chain: chain}, gapLimit, lookup)
+}
+
+func discoverBranchAddresses(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	branch addressBranch,
+	gapLimit uint32,
+	lookup HistoryLookup,
+) (*DiscoveryResult, error) {
+	deriver, err := newAddressDeriver(params, wallet, branch)
+	if err != nil {
+		return nil, err
+	}
+	result := &DiscoveryResult{Chain: deriver.chain, Legacy: deriver.legacy, ScriptIndices: make(map[string]uint32)}
+	next := uint32(0)
+	unused := uint32(0)
+	for unused < gapLimit {
+		// only as many as could close the gap
+		batch := gapLimit - unused
+		if next+batch > hdkeychain.HardenedKeyStart || next+batch < next {
+			return nil, fmt.Errorf("exhausted address indices at %d", next)
+		}
+		scripts := make([][]byte, batch)
+		for i := range scripts {
+			if scripts[i], err = deriver.scriptAt(next + uint32(i)); err != nil {
+				return nil, err
+			}
+			result.ScriptIndices[hex.EncodeToString(scripts[i])] = next + uint32(i)
+		}
+		history, err := lookup.HasHistory(scripts)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) != len(scripts) {
+			return nil, fmt.Errorf("history lookup returned %d results for %d scripts", len(history), len(scripts))
+		}
+		for i, used := range history {
+			if used {
+				result.Used = true
+				result.HighestUsedIndex = next + uint32(i)
+				unused = 0
+			} else {
+				unused++
+			}
+		}
+		next += batch
+	}
+	return result, nil
+}
+
+// NextUnusedChangeAddress discovers the InternalChain addresses of 'wallet', with DefaultGapLimit, and returns the
+// first one without history (and its index) for use as the change address of CreateTransaction. It returns
+// ErrChainNotCovered if the second descriptor of 'wallet' does not cover the InternalChain, as change sent there
+// could not be recovered from it.
+func NextUnusedChangeAddress(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	lookup HistoryLookup,
+) (btcutil.Address, uint32, error) {
+	result, err := DiscoverChainAddresses(params, wallet, InternalChain, DefaultGapLimit, lookup)
+	if err != nil {
+		return nil, 0, err
+	}
+	index := result.NextUnusedIndex()
+	addresses, err := GetChainAddresses(params, wallet, InternalChain, index, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	address, err := btcutil.DecodeAddress(addresses[0], params)
+	if err != nil {
+		return nil, 0, err
+	}
+	return address, index, nil
+}
+
+// LegacyCoinTypeDiscovery is the outcome of DiscoverLegacyCoinType
+type LegacyCoinTypeDiscovery struct {
+	// Wallet is the discovered wallet configured with LegacyCoinType, with which to sign for its funds
+	Wallet   Wallet
+	External *DiscoveryResult
+	Internal *DiscoveryResult
+}
+
+// Used is true if any address of the legacy coin type has history, in which case its funds should be swept to
+// addresses of the network's coin type
+func (d *LegacyCoinTypeDiscovery) Used() bool {
+	return d.External.Used || d.Internal.Used
+}
+
+// DiscoverLegacyCoinType discovers, as DiscoverChainAddresses, the addresses of both chains of 'wallet' of the
+// legacy coin type 0'. It is for migrating wallets created on a test network before the coin type was derived from
+// the network and so is an error on networks whose coin type is 0'.
+func DiscoverLegacyCoinType(
+	params *chaincfg.Params,
+	wallet Wallet,
+	gapLimit uint32,
+	lookup HistoryLookup,
+) (*LegacyCoinTypeDiscovery, error) {
+	if params.HDCoinType == legacyCoinType {
+		return nil, fmt.Errorf("network %s has no legacy coin type", params.Name)
+	}
+	legacyWallet, err := LegacyCoinTypeWallet(wallet)
+	if err != nil {
+		return nil, err
+	}
+	discovery := &LegacyCoinTypeDiscovery{Wallet: legacyWallet}
+	if discovery.External, err = DiscoverChainAddresses(params, legacyWallet, ExternalChain, gapLimit, lookup); err != nil {
+		return nil, err
+	}
+	if discovery.Internal, err = DiscoverChainAddresses(params, legacyWallet, InternalChain, gapLimit, lookup); err != nil {
+		return nil, err
+	}
+	return discovery, nil
+}
+
+// scanAddressIndices derives, in parallel, the addresses of both chains of 'wallet' from index 0 until each of
+// 'scripts' is found, up to maxAddressScan addresses per chain. On a test network, the addresses of the legacy coin
+// type are also derived so that wallets created before SLIP-44 coin types can still sign for their funds.
+func scanAddressIndices(params *chaincfg.Params, wallet RecoveryWallet, scripts [][]byte) (AddressIndexer, error) {
+	external, err := NewAddressCache(params, wallet)
+	if err != nil {
+		return nil, err
+	}
+	caches := []*AddressCache{external}
+	branches := []addressBranch{{chain: InternalChain}}
+	if params.HDCoinType != legacyCoinType {
+		branches = append(branches, addressBranch{chain: ExternalChain, legacy: true},
+			addressBranch{chain: InternalChain, legacy: true})
+	}
+	for _, branch := range branches {
+		// a recovery wallet's second descriptor may be of neither the InternalChain nor the legacy coin type
+		deriver, err := newAddressDeriver(params, wallet, branch)
+		if err != nil || scannedBranch(caches, deriver) {
+			continue
+		}
+		caches = append(caches, newAddressCache(params, deriver))
+	}
+	indexers := make(AddressIndexers, len(caches))
+	for i, cache := range caches {
+		indexers[i] = cache
+	}
+	for batch := uint32(scanAddressBatch); external.Len() < maxAddressScan; batch *= 2 {
+		num := min(batch, maxAddressScan-external.Len())
+		for _, cache := range caches {
+			if err = cache.Extend(num); err != nil {
+				return nil, err
+			}
+		}
+		if allIndexed(indexers, scripts) {
+			break
+		}
+	}
+	return indexers, nil
+}
+
+// scannedBranch is true if one of 'caches' derives the same addresses as 'deriver'
+func scannedBranch(caches []*AddressCache, deriver *addressDeriver) bool {
+	for _, cache := range caches {
+		if cache.deriver.branch() == deriver.branch() {
+			return true
+		}
+	}
+	return false
+}
+
+func allIndexed(indexer AddressIndexer, scripts [][]byte) bool {
+	for _, script := range scripts {
+		if _, found := indexer.IndexOf(script); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// addressBranch identifies the addresses of a chain, of the network's or legacy coin type, of a wallet
+type addressBranch struct {
+	chain  uint32
+	legacy bool
+}
+
+// addressDeriver derives the Leafy addresses of a chain of a wallet by index
+type addressDeriver struct {
+	params   *chaincfg.Params
+	timelock uint32
+	chain    uint32
+	// legacy is true if the addresses are of the legacy coin type on a test network
+	legacy   bool
+	firstKey *Bip44Key
+	// secondKey is private if the wallet is a Wallet
+	secondKey *Bip44Key
+}
+
+// newAddressDeriver creates an addressDeriver of 'branch' of 'wallet'. The addresses are of the legacy coin type if
+// 'branch' is legacy, the wallet is configured with LegacyCoinType or the wallet's second descriptor is of it.
+func newAddressDeriver(params *chaincfg.Params, wallet RecoveryWallet, branch addressBranch) (*addressDeriver, error) {
+	config := GetWalletConfig(wallet)
+	legacy := (branch.legacy || config.LegacyCoinType) && params.HDCoinType != legacyCoinType
+	secondKey, legacy, err := getSecondChainKey(params, wallet, branch.chain, legacy)
+	if err != nil {
+		return nil, err
+	}
+	firstKey, err := getBip44AccountKey(wallet.GetFirstMnemonic(), params, config.accountPath(params, legacy),
+		branch.chain, 0)
+	if err != nil {
+		return nil, err
+	}
+	// a private extended key memoizes its public key on first derivation; do so now so that concurrent
+	// derivations only read
+	for _, key := range []*Bip44Key{firstKey, secondKey} {
+		if _, err = key.changeKey.ECPubKey(); err != nil {
+			return nil, err
+		}
+	}
+	return &addressDeriver{
+		params:    params,
+		timelock:  config.Timelock,
+		chain:     branch.chain,
+		legacy:    legacy,
+		firstKey:  firstKey,
+		secondKey: secondKey,
+	}, nil
+}
+
+// getSecondChainKey returns the second seed key of index 0 of 'chain', from the second mnemonic if 'wallet' is a
+// Wallet and otherwise from its second descriptor, which must be of the wallet's purpose and account. A second
+// descriptor of the legacy coin type, on a test network, was exported before SLIP-44 coin types and so implies
+// 'legacy', which is returned.
+func getSecondChainKey(params *chaincfg.Params, wallet RecoveryWallet, chain uint32, legacy bool) (*Bip44Key, bool, error) {
+	config := GetWalletConfig(wallet)
+	if fullWallet, ok := wallet.(Wallet); ok {
+		secondKey, err := getBip44AccountKey(fullWallet.GetSecondMnemonic(), params, config.accountPath(params, legacy),
+			chain, 0)
+		return secondKey, legacy, err
+	}
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	if err != nil {
+		return nil, false, err
+	}
+	var secondKey *Bip44Key
+	if chain == ExternalChain {
+		secondKey, err = ImportFromTaprootDescriptorForParent(descriptor, Path(0))
+	} else {
+		secondKey, err = ImportFromTaprootDescriptorForChain(descriptor, chain, Path(0))
+		if errors.Is(err, ErrDescriptorInvalidPath) {
+			return nil, false, fmt.Errorf("%w %d: %w", ErrChainNotCovered, chain, err)
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if secondKey.GetPurposeRaw() != PathHardened(config.Purpose()).path {
+		return nil, false, fmt.Errorf("second descriptor is of purpose %s but the wallet is of purpose %d'",
+			secondKey.purpose.getDerivationValue(), config.Purpose())
+	}
+	if secondKey.GetAccountRaw() != PathHardened(config.Account).path {
+		return nil, false, fmt.Errorf("second descriptor is of account %s but the wallet is of account %d'",
+			secondKey.account.getDerivationValue(), config.Account)
+	}
+	switch secondKey.GetCoinRaw() {
+	case PathHardened(coinType(params, legacy)).path:
+	case PathHardened(legacyCoinType).path:
+		legacy = true
+	default:
+		return nil, false, fmt.Errorf("second descriptor is of coin type %s but the wallet is of coin type %d'",
+			secondKey.coin.getDerivationValue(), coinType(params, legacy))
+	}
+	return secondKey, legacy, nil
+}
+
+// branch is the addressBranch of the derived addresses
+func (d *addressDeriver) branch() addressBranch {
+	return addressBranch{chain: d.chain, legacy: d.legacy}
+}
+
+// bip44KeysAt returns the first and second seed keys of address 'index'
+func (d *addressDeriver) bip44KeysAt(index uint32) (*Bip44Key, *Bip44Key, error) {
+	firstKey, err := d.firstKey.DeriveSibling(Path(index))
+	if err != nil {
+		return nil, nil, err
+	}
+	secondKey, err := d.secondKey.DeriveSibling(Path(index))
+	if err != nil {
+		return nil, nil, err
+	}
+	return firstKey, secondKey, nil
+}
+
+// keysAt returns the first seed private key and second seed public key of address 'index'
+func (d *addressDeriver) keysAt(index uint32) (*btcec.PrivateKey, *btcec.PublicKey, error) {
+	firstKey, secondKey, err := d.bip44KeysAt(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	firstPrivateKey, err := firstKey.GetPrivateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	secondPublicKey, err := secondKey.GetPublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	return firstPrivateKey, secondPublicKey, nil
+}
+
+// scriptAt returns the output script of address 'index'
+func (d *addressDeriver) scriptAt(index uint32) ([]byte, error) {
+	firstPrivateKey, secondPublicKey, err := d.keysAt(index)
+	if err != nil {
+		return nil, err
+	}
+	address, _, _, _, err := createTweakedAddressFromPublicKey(d.params, d.timelock, secondPublicKey, firstPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(address)
+}
+
+// addressDerivers lazily creates an addressDeriver per addressBranch
+type addressDerivers struct {
+	params   *chaincfg.Params
+	wallet   RecoveryWallet
+	derivers map[addressBranch]*addressDeriver
+}
+
+func newAddressDerivers(params *chaincfg.Params, wallet RecoveryWallet) *addressDerivers {
+	return &addressDerivers{params: params, wallet: wallet, derivers: make(map[addressBranch]*addressDeriver)}
+}
+
+// forDerivation returns the addressDeriver of the chain and coin type of 'derivation'
+func (d *addressDerivers) forDerivation(derivation AddressDerivation) (*addressDeriver, error) {
+	branch := addressBranch{chain: derivation.Chain, legacy: derivation.Legacy}
+	if deriver, found := d.derivers[branch]; found {
+		return deriver, nil
+	}
+	deriver, err := newAddressDeriver(d.params, d.wallet, branch)
+	if err != nil {
+		return nil, err
+	}
+	d.derivers[branch] = deriver
+	return deriver, nil
+}
@@ -0,0 +1,315 @@
+package leafy_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestDiscoverAddresses(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	addresses, err := leafy.GetAddresses(params, wallet, 0, 50)
+	require.NoError(t, err)
+	used := map[string]bool{addresses[0]: true, addresses[3]: true, addresses[22]: true, addresses[45]: true}
+	lookups := 0
+	lookup := leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		lookups++
+		history := make([]bool, len(scripts))
+		for i, script := range scripts {
+			_, scriptAddresses, _, err := txscript.ExtractPkScriptAddrs(script, params)
+			require.NoError(t, err)
+			history[i] = used[scriptAddresses[0].EncodeAddress()]
+		}
+		return history, nil
+	})
+
+	result, err := leafy.DiscoverAddresses(params, wallet, leafy.DefaultGapLimit, lookup)
+	require.NoError(t, err)
+	require.True(t, result.Used)
+	// 45 is beyond the gap following 22
+	require.EqualValues(t, 22, result.HighestUsedIndex)
+	require.EqualValues(t, 23, result.NextUnusedIndex())
+	require.Equal(t, 43, len(result.ScriptIndices))
+	for index, address := range addresses[:43] {
+		script := addressScript(t, params, address)
+		found, ok := result.IndexOf(script)
+		require.True(t, ok)
+		require.Equal(t, leafy.AddressDerivation{Chain: leafy.ExternalChain, Index: uint32(index)}, found)
+	}
+	_, ok := result.IndexOf(addressScript(t, params, addresses[43]))
+	require.False(t, ok)
+	require.True(t, lookups > 1)
+
+	// a larger gap limit finds 45
+	result, err = leafy.DiscoverAddresses(params, wallet, 25, lookup)
+	require.NoError(t, err)
+	require.EqualValues(t, 45, result.HighestUsedIndex)
+
+	// unused wallet
+	used = map[string]bool{}
+	result, err = leafy.DiscoverAddresses(params, wallet, 5, lookup)
+	require.NoError(t, err)
+	require.False(t, result.Used)
+	require.EqualValues(t, 0, result.NextUnusedIndex())
+	require.Equal(t, 5, len(result.ScriptIndices))
+
+	// invalid
+	_, err = leafy.DiscoverAddresses(params, wallet, 0, lookup)
+	require.Error(t, err)
+	_, err = leafy.DiscoverAddresses(params, wallet, 5, leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		return make([]bool, 1), nil
+	}))
+	require.Error(t, err)
+	_, err = leafy.DiscoverAddresses(params, wallet, 5, leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		return nil, fmt.Errorf("unavailable")
+	}))
+	require.Error(t, err)
+}
+
+func TestSignTransactionWithIndexer(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(seedMnemonic, descriptor)
+	// indices beyond 255 (which previously wrapped)
+	utxos := []leafy.Utxo{indexedUtxo(t, params, wallet, 2, 10000), indexedUtxo(t, params, wallet, 300, 20000)}
+	destAddress, err := btcutil.DecodeAddress(utxos[0].FromAddress, params)
+	require.NoError(t, err)
+	tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 25000, 2)
+	require.NoError(t, err)
+	recoveryTx, err := leafy.CreateRecoveryTransaction(utxos, destAddress, destAddress, 25000, 2)
+	require.NoError(t, err)
+
+	// without an indexer, the first 1000 addresses are derived
+	signed, err := leafy.SignTransaction(params, wallet, tx)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	recoverySigned, err := leafy.SignRecoveryTransaction(params, recoveryWallet, recoveryTx)
+	require.NoError(t, err)
+	requireValidWitnesses(t, recoverySigned.Msg, utxos)
+
+	indexer := &leafy.DiscoveryResult{ScriptIndices: map[string]uint32{utxos[0].Script: 2, utxos[1].Script: 300}}
+	indexedSigned, err := leafy.SignTransactionWithIndexer(params, wallet, tx, indexer)
+	require.NoError(t, err)
+	require.Equal(t, signed.Hex, indexedSigned.Hex)
+	indexedRecoverySigned, err := leafy.SignRecoveryTransactionWithIndexer(params, recoveryWallet, recoveryTx, indexer)
+	require.NoError(t, err)
+	requireValidWitnesses(t, indexedRecoverySigned.Msg, utxos)
+
+	// beyond the scan limit requires an indexer
+	utxos = []leafy.Utxo{indexedUtxo(t, params, wallet, 1500, 10000)}
+	tx, err = leafy.CreateTransaction(utxos, destAddress, destAddress, 0, 2)
+	require.NoError(t, err)
+	_, err = leafy.SignTransaction(params, wallet, tx)
+	require.Error(t, err)
+	indexer = &leafy.DiscoveryResult{ScriptIndices: map[string]uint32{utxos[0].Script: 1500}}
+	signed, err = leafy.SignTransactionWithIndexer(params, wallet, tx, indexer)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+
+	// an incorrect index
+	indexer = &leafy.DiscoveryResult{ScriptIndices: map[string]uint32{utxos[0].Script: 1501}}
+	_, err = leafy.SignTransactionWithIndexer(params, wallet, tx, indexer)
+	require.Error(t, err)
+}
+
+func TestChangeAddresses(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	external, err := leafy.GetAddresses(params, wallet, 0, 30)
+	require.NoError(t, err)
+	internal, err := leafy.GetChainAddresses(params, wallet, leafy.InternalChain, 0, 30)
+	require.NoError(t, err)
+	for _, address := range internal {
+		require.NotContains(t, external, address)
+	}
+	offset, err := leafy.GetChainAddresses(params, wallet, leafy.InternalChain, 10, 5)
+	require.NoError(t, err)
+	require.Equal(t, internal[10:15], offset)
+	_, err = leafy.GetChainAddresses(params, wallet, leafy.InternalChain, 0, 0)
+	require.Error(t, err)
+
+	// a recovery wallet of the account descriptor derives both chains
+	accountDescriptor, err := leafy.GetAccountDescriptor(params, seedMnemonic)
+	require.NoError(t, err)
+	accountWallet := leafy.NewRecoveryWallet(seedMnemonic, accountDescriptor)
+	addresses, err := leafy.GetAddresses(params, accountWallet, 0, 30)
+	require.NoError(t, err)
+	require.Equal(t, external, addresses)
+	addresses, err = leafy.GetChainAddresses(params, accountWallet, leafy.InternalChain, 0, 30)
+	require.NoError(t, err)
+	require.Equal(t, internal, addresses)
+	// as does one of the exported second descriptor
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	addresses, err = leafy.GetChainAddresses(params, leafy.NewRecoveryWallet(seedMnemonic, descriptor), leafy.InternalChain, 0, 30)
+	require.NoError(t, err)
+	require.Equal(t, internal, addresses)
+	// but one of an ExternalChain descriptor only the ExternalChain
+	changeWallet := leafy.NewRecoveryWallet(seedMnemonic, externalChainDescriptor(t, descriptor))
+	_, err = leafy.GetChainAddresses(params, changeWallet, leafy.InternalChain, 0, 1)
+	require.ErrorIs(t, err, leafy.ErrChainNotCovered)
+	_, _, err = leafy.NextUnusedChangeAddress(params, changeWallet, leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		return make([]bool, len(scripts)), nil
+	}))
+	require.ErrorIs(t, err, leafy.ErrChainNotCovered)
+
+	used := map[string]bool{internal[0]: true, internal[2]: true}
+	lookup := leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		history := make([]bool, len(scripts))
+		for i, script := range scripts {
+			_, scriptAddresses, _, err := txscript.ExtractPkScriptAddrs(script, params)
+			require.NoError(t, err)
+			history[i] = used[scriptAddresses[0].EncodeAddress()]
+		}
+		return history, nil
+	})
+	result, err := leafy.DiscoverChainAddresses(params, wallet, leafy.InternalChain, leafy.DefaultGapLimit, lookup)
+	require.NoError(t, err)
+	require.EqualValues(t, leafy.InternalChain, result.Chain)
+	require.EqualValues(t, 2, result.HighestUsedIndex)
+	found, ok := result.IndexOf(addressScript(t, params, internal[2]))
+	require.True(t, ok)
+	require.Equal(t, leafy.AddressDerivation{Chain: leafy.InternalChain, Index: 2}, found)
+	change, index, err := leafy.NextUnusedChangeAddress(params, accountWallet, lookup)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, index)
+	require.Equal(t, internal[3], change.EncodeAddress())
+}
+
+func TestSignChangeOutputs(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	accountDescriptor, err := leafy.GetAccountDescriptor(params, seedMnemonic)
+	require.NoError(t, err)
+	accountWallet := leafy.NewRecoveryWallet(seedMnemonic, accountDescriptor)
+	utxos := []leafy.Utxo{
+		indexedUtxo(t, params, wallet, 4, 10000),
+		chainUtxo(t, params, wallet, leafy.InternalChain, 5, 20000),
+	}
+	change, _, err := leafy.NextUnusedChangeAddress(params, wallet, leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		return make([]bool, len(scripts)), nil
+	}))
+	require.NoError(t, err)
+	destAddress, err := btcutil.DecodeAddress(utxos[0].FromAddress, params)
+	require.NoError(t, err)
+	tx, err := leafy.CreateTransaction(utxos, change, destAddress, 25000, 2)
+	require.NoError(t, err)
+	recoveryTx, err := leafy.CreateRecoveryTransaction(utxos, change, destAddress, 25000, 2)
+	require.NoError(t, err)
+
+	// both chains are searched
+	signed, err := leafy.SignTransaction(params, wallet, tx)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	recoverySigned, err := leafy.SignRecoveryTransaction(params, accountWallet, recoveryTx)
+	require.NoError(t, err)
+	requireValidWitnesses(t, recoverySigned.Msg, utxos)
+
+	// via indexers and derivations
+	internal, err := leafy.NewChainAddressCache(params, wallet, leafy.InternalChain)
+	require.NoError(t, err)
+	require.NoError(t, internal.EnsureIndex(5))
+	external, err := leafy.NewAddressCache(params, wallet)
+	require.NoError(t, err)
+	require.NoError(t, external.EnsureIndex(4))
+	indexedSigned, err := leafy.SignTransactionWithIndexer(params, wallet, tx, leafy.AddressIndexers{external, internal})
+	require.NoError(t, err)
+	require.Equal(t, signed.Hex, indexedSigned.Hex)
+	derived := []leafy.Utxo{
+		utxos[0].WithDerivation(4, leafy.KeyPathSpend),
+		utxos[1].WithChainDerivation(leafy.InternalChain, 5, leafy.KeyPathSpend),
+	}
+	tx, err = leafy.CreateTransaction(derived, change, destAddress, 25000, 2)
+	require.NoError(t, err)
+	derivedSigned, err := leafy.SignTransactionWithIndexer(params, wallet, tx, &leafy.DiscoveryResult{})
+	require.NoError(t, err)
+	require.Equal(t, signed.Hex, derivedSigned.Hex)
+	// of the wrong chain
+	derived[1] = utxos[1].WithDerivation(5, leafy.KeyPathSpend)
+	tx, err = leafy.CreateTransaction(derived, change, destAddress, 25000, 2)
+	require.NoError(t, err)
+	_, err = leafy.SignTransactionWithIndexer(params, wallet, tx, &leafy.DiscoveryResult{})
+	require.Error(t, err)
+
+	// a recovery wallet of an ExternalChain descriptor cannot derive the InternalChain
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	_, err = leafy.SignRecoveryTransaction(params, leafy.NewRecoveryWallet(seedMnemonic, externalChainDescriptor(t, descriptor)),
+		recoveryTx)
+	require.Error(t, err)
+}
+
+func TestRecoverChangeWithExportedDescriptor(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	// the first mnemonic and the exported descriptor alone, as backed up
+	recoveryWallet := leafy.NewRecoveryWallet(wallet.GetFirstMnemonic(), descriptor)
+	unused := leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		return make([]bool, len(scripts)), nil
+	})
+	change, index, err := leafy.NextUnusedChangeAddress(params, wallet, unused)
+	require.NoError(t, err)
+	recoveryChange, recoveryIndex, err := leafy.NextUnusedChangeAddress(params, recoveryWallet, unused)
+	require.NoError(t, err)
+	require.Equal(t, change.EncodeAddress(), recoveryChange.EncodeAddress())
+	require.Equal(t, index, recoveryIndex)
+
+	utxos := []leafy.Utxo{chainUtxo(t, params, wallet, leafy.InternalChain, index, 20000)}
+	require.Equal(t, change.EncodeAddress(), utxos[0].FromAddress)
+	signed, err := leafy.CreateAndSignRecoveryTransaction(params, recoveryWallet, utxos, change, change, 0, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+}
+
+// externalChainDescriptor is the ExternalChain descriptor of the multipath 'descriptor', as second descriptors were
+// exported prior to multipath descriptors
+func externalChainDescriptor(t *testing.T, descriptor string) string {
+	t.Helper()
+	key, err := leafy.ImportFromTaprootDescriptorForParent(descriptor, leafy.Path(0))
+	require.NoError(t, err)
+	return key.GetTaprootParentDescriptorWithoutChecksum("")
+}
+
+// indexedUtxo creates a Utxo of 'amount' for the address at 'index' of 'wallet'
+func indexedUtxo(t *testing.T, params *chaincfg.Params, wallet leafy.RecoveryWallet, index uint32, amount int64) leafy.Utxo {
+	t.Helper()
+	return chainUtxo(t, params, wallet, leafy.ExternalChain, index, amount)
+}
+
+// chainUtxo creates a Utxo of 'amount' for the address at 'index' of 'chain' of 'wallet'
+func chainUtxo(t *testing.T, params *chaincfg.Params, wallet leafy.RecoveryWallet, chain uint32, index uint32, amount int64) leafy.Utxo {
+	t.Helper()
+	addresses, err := leafy.GetChainAddresses(params, wallet, chain, index, 1)
+	require.NoError(t, err)
+	return leafy.Utxo{
+		FromAddress: addresses[0],
+		Outpoint: wire.OutPoint{
+			Hash:  chainhash.DoubleHashH([]byte(addresses[0])),
+			Index: index,
+		},
+		Amount: amount,
+		Script: hex.EncodeToString(addressScript(t, params, addresses[0])),
+	}
+}
+
+func addressScript(t *testing.T, params *chaincfg.Params, encoded string) []byte {
+	t.Helper()
+	address, err := btcutil.DecodeAddress(encoded, params)
+	require.NoError(t, err)
+	script, err := txscript.PayToAddrScript(address)
+	require.NoError(t, err)
+	return script
+}
@@ -0,0 +1,618 @@
+package leafy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// electrumProtocolVersion is the minimum Electrum protocol version required of servers
+	electrumProtocolVersion = "1.4"
+	electrumClientName      = "leafy"
+)
+
+// ElectrumConfig configures the connection of an ElectrumClient
+type ElectrumConfig struct {
+	// Address is the host:port of the Electrum server, e.g. an electrs or Fulcrum instance
+	Address string
+	// TLS connects via TLS, configured by TLSConfig if set
+	TLS       bool
+	TLSConfig *tls.Config
+	// Timeout bounds the connection and each request; defaults to 30 seconds
+	Timeout time.Duration
+}
+
+// ScriptStatus is a notification that the history of a subscribed script changed; see ElectrumClient.SubscribeScript
+type ScriptStatus struct {
+	Script []byte
+	// Status is the Electrum status of the script's history, empty if it has none
+	Status string
+}
+
+// ElectrumClient is a ChainBackend of an Electrum protocol server. Its requests may be made concurrently.
+type ElectrumClient struct {
+	params  *chaincfg.Params
+	timeout time.Duration
+	conn    net.Conn
+
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	nextId    uint64
+	pending   map[uint64]chan electrumResponse
+	scripts   map[string][]byte
+	closed    error
+
+	statuses chan ScriptStatus
+	// undelivered are the latest notified statuses, by script hash in notification order, not yet sent to statuses
+	undelivered      map[string]ScriptStatus
+	undeliveredOrder []string
+	notified         chan struct{}
+	done             chan struct{}
+}
+
+var _ ChainBackend = (*ElectrumClient)(nil)
+var _ HistoryLookup = (*ElectrumClient)(nil)
+
+type electrumRequest struct {
+	JsonRpc string `json:"jsonrpc"`
+	Id      uint64 `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type electrumResponse struct {
+	Id     *uint64           `json:"id"`
+	Result json.RawMessage   `json:"result"`
+	Error  *ElectrumError    `json:"error"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// ElectrumError is an error returned by an Electrum server
+type ElectrumError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ElectrumError) Error() string {
+	return fmt.Sprintf("electrum error %d: %v", e.Code, e.Message)
+}
+
+// DialElectrum connects to the 'params' network's Electrum server configured by 'config' and negotiates the
+// protocol version
+func DialElectrum(params *chaincfg.Params, config ElectrumConfig) (*ElectrumClient, error) {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if config.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", config.Address, config.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", config.Address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to electrum server: %w", err)
+	}
+	client := &ElectrumClient{
+		params:      params,
+		timeout:     timeout,
+		conn:        conn,
+		pending:     map[uint64]chan electrumResponse{},
+		scripts:     map[string][]byte{},
+		statuses:    make(chan ScriptStatus, 100),
+		undelivered: map[string]ScriptStatus{},
+		notified:    make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	go client.read()
+	go client.deliver()
+	var version []string
+	if err = client.call("server.version", &version, electrumClientName, electrumProtocolVersion); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// Close closes the connection to the server, failing outstanding requests and closing ScriptStatuses
+func (c *ElectrumClient) Close() error {
+	return c.conn.Close()
+}
+
+// ScriptStatuses are the notifications of scripts subscribed to via SubscribeScript. Notifications of a script which
+// are not yet received are coalesced into its latest status, so a slow receiver misses only intermediate statuses.
+func (c *ElectrumClient) ScriptStatuses() <-chan ScriptStatus {
+	return c.statuses
+}
+
+// ElectrumScriptHash is the Electrum script hash of 'script', the reversed sha256 of the script in hex
+func ElectrumScriptHash(script []byte) string {
+	hash := sha256.Sum256(script)
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+// SubscribeScript subscribes to changes of the history of 'script', e.g. that of a Leafy address, which are then
+// delivered via ScriptStatuses. It returns the current status, empty if the script has no history.
+func (c *ElectrumClient) SubscribeScript(script []byte) (string, error) {
+	scriptHash := ElectrumScriptHash(script)
+	c.lock.Lock()
+	c.scripts[scriptHash] = script
+	c.lock.Unlock()
+	var status *string
+	if err := c.call("blockchain.scripthash.subscribe", &status, scriptHash); err != nil {
+		return "", err
+	}
+	if status == nil {
+		return "", nil
+	}
+	return *status, nil
+}
+
+// HasHistory implements HistoryLookup via each script's history
+func (c *ElectrumClient) HasHistory(scripts [][]byte) ([]bool, error) {
+	history := make([]bool, len(scripts))
+	for i, script := range scripts {
+		entries, err := c.scriptHistory(script)
+		if err != nil {
+			return nil, err
+		}
+		history[i] = len(entries) > 0
+	}
+	return history, nil
+}
+
+// AddressStatus implements AddressStatusLookup via the Electrum status of the address' history, the sha256 of the
+// concatenated "txid:height:" of its entries
+func (c *ElectrumClient) AddressStatus(address string) (string, error) {
+	script, err := c.addressScript(address)
+	if err != nil {
+		return "", err
+	}
+	history, err := c.scriptHistory(script)
+	if err != nil || len(history) == 0 {
+		return "", err
+	}
+	hash := sha256.New()
+	for _, entry := range history {
+		_, _ = fmt.Fprintf(hash, "%s:%d:", entry.TxHash, entry.Height)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (c *ElectrumClient) AddressUtxos(address string) ([]Utxo, error) {
+	script, err := c.addressScript(address)
+	if err != nil {
+		return nil, err
+	}
+	return c.ScriptUtxos(script, address)
+}
+
+// ScriptUtxos returns the utxos of 'script', whose address is 'address'
+func (c *ElectrumClient) ScriptUtxos(script []byte, address string) ([]Utxo, error) {
+	var unspents []struct {
+		TxHash string `json:"tx_hash"`
+		TxPos  uint32 `json:"tx_pos"`
+		Height int64  `json:"height"`
+		Value  int64  `json:"value"`
+	}
+	if err := c.call("blockchain.scripthash.listunspent", &unspents, ElectrumScriptHash(script)); err != nil {
+		return nil, err
+	}
+	utxos := make([]Utxo, len(unspents))
+	for i, unspent := range unspents {
+		hash, err := chainhash.NewHashFromStr(unspent.TxHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid utxo txid: %w", err)
+		}
+		utxos[i] = Utxo{
+			FromAddress: address,
+			Outpoint:    wire.OutPoint{Hash: *hash, Index: unspent.TxPos},
+			Amount:      unspent.Value,
+			Script:      hex.EncodeToString(script),
+			BlockHeight: max(unspent.Height, 0),
+		}
+	}
+	return utxos, nil
+}
+
+type electrumHistoryEntry struct {
+	TxHash string `json:"tx_hash"`
+	// Height is that of the confirming block; 0 if unconfirmed or -1 if unconfirmed with unconfirmed inputs
+	Height int64 `json:"height"`
+}
+
+func (c *ElectrumClient) scriptHistory(script []byte) ([]electrumHistoryEntry, error) {
+	var history []electrumHistoryEntry
+	if err := c.call("blockchain.scripthash.get_history", &history, ElectrumScriptHash(script)); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// AddressTransactions returns the transactions of 'address', unconfirmed first and then confirmed from the newest
+func (c *ElectrumClient) AddressTransactions(address string) ([]ChainTransaction, error) {
+	script, err := c.addressScript(address)
+	if err != nil {
+		return nil, err
+	}
+	history, err := c.scriptHistory(script)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]ChainTransaction, 0, len(history))
+	headers := map[int64]*wire.BlockHeader{}
+	for _, entry := range history {
+		tx, err := c.chainTransaction(entry, headers)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].Status.Confirmed != txs[j].Status.Confirmed {
+			return !txs[i].Status.Confirmed
+		}
+		return txs[i].Status.BlockHeight > txs[j].Status.BlockHeight
+	})
+	return txs, nil
+}
+
+func (c *ElectrumClient) chainTransaction(entry electrumHistoryEntry, headers map[int64]*wire.BlockHeader) (
+	ChainTransaction, error) {
+	msgTx, err := c.transaction(entry.TxHash)
+	if err != nil {
+		return ChainTransaction{}, err
+	}
+	tx := ChainTransaction{
+		TxId:    entry.TxHash,
+		Weight:  int64(msgTx.SerializeSizeStripped()*3 + msgTx.SerializeSize()),
+		Inputs:  make([]ChainTransactionInput, len(msgTx.TxIn)),
+		Outputs: make([]ChainTransactionOutput, len(msgTx.TxOut)),
+	}
+	if entry.Height > 0 {
+		header, ok := headers[entry.Height]
+		if !ok {
+			if header, err = c.blockHeader(entry.Height); err != nil {
+				return ChainTransaction{}, err
+			}
+			headers[entry.Height] = header
+		}
+		tx.Status = TransactionStatus{Confirmed: true, BlockHeight: entry.Height,
+			BlockHash: header.BlockHash().String(), BlockTime: header.Timestamp.Unix()}
+	}
+	coinbase := isCoinbase(msgTx)
+	var inputAmount, outputAmount int64
+	prevTxs := map[chainhash.Hash]*wire.MsgTx{}
+	for i, txIn := range msgTx.TxIn {
+		tx.Inputs[i] = ChainTransactionInput{Outpoint: txIn.PreviousOutPoint, Sequence: txIn.Sequence,
+			Coinbase: coinbase, Witness: witnessHex(txIn.Witness)}
+		if coinbase {
+			continue
+		}
+		prevTx, ok := prevTxs[txIn.PreviousOutPoint.Hash]
+		if !ok {
+			if prevTx, err = c.transaction(txIn.PreviousOutPoint.Hash.String()); err != nil {
+				return ChainTransaction{}, err
+			}
+			prevTxs[txIn.PreviousOutPoint.Hash] = prevTx
+		}
+		if int(txIn.PreviousOutPoint.Index) >= len(prevTx.TxOut) {
+			return ChainTransaction{}, fmt.Errorf("invalid outpoint %v", txIn.PreviousOutPoint)
+		}
+		prevOut := chainOutput(c.params, prevTx.TxOut[txIn.PreviousOutPoint.Index])
+		tx.Inputs[i].PrevOut = &prevOut
+		inputAmount += prevOut.Amount
+	}
+	for i, txOut := range msgTx.TxOut {
+		tx.Outputs[i] = chainOutput(c.params, txOut)
+		outputAmount += txOut.Value
+	}
+	if !coinbase {
+		tx.Fee = inputAmount - outputAmount
+	}
+	return tx, nil
+}
+
+func (c *ElectrumClient) transaction(txid string) (*wire.MsgTx, error) {
+	var serialized string
+	if err := c.call("blockchain.transaction.get", &serialized, txid); err != nil {
+		if isElectrumNotFound(err) {
+			return nil, fmt.Errorf("%w: %v", ErrTransactionNotFound, txid)
+		}
+		return nil, err
+	}
+	return decodeTransactionHex(serialized)
+}
+
+func (c *ElectrumClient) blockHeader(height int64) (*wire.BlockHeader, error) {
+	var serialized string
+	if err := c.call("blockchain.block.header", &serialized, height); err != nil {
+		return nil, err
+	}
+	decoded, err := hex.DecodeString(serialized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block header: %w", err)
+	}
+	var header wire.BlockHeader
+	if err = header.Deserialize(bytes.NewReader(decoded)); err != nil {
+		return nil, fmt.Errorf("invalid block header: %w", err)
+	}
+	return &header, nil
+}
+
+func (c *ElectrumClient) TipHeight() (int64, error) {
+	var tip struct {
+		Height int64 `json:"height"`
+	}
+	if err := c.call("blockchain.headers.subscribe", &tip); err != nil {
+		return 0, err
+	}
+	return tip.Height, nil
+}
+
+// RecommendedFees returns the server's estimatefee of each target; a target without an estimate uses the server's
+// relay fee
+func (c *ElectrumClient) RecommendedFees() (*RecommendedFees, error) {
+	var relayFee float64
+	if err := c.call("blockchain.relayfee", &relayFee); err != nil {
+		return nil, err
+	}
+	minimum := btcPerKvbToSatPerVb(relayFee)
+	fees := &RecommendedFees{Minimum: minimum}
+	for _, target := range []struct {
+		blocks int
+		rate   *float64
+	}{{1, &fees.Fastest}, {3, &fees.HalfHour}, {6, &fees.Hour}, {144, &fees.Economy}} {
+		var estimate float64
+		if err := c.call("blockchain.estimatefee", &estimate, target.blocks); err != nil {
+			return nil, err
+		}
+		// -1 if the server has no estimate
+		*target.rate = math.Max(minimum, btcPerKvbToSatPerVb(estimate))
+	}
+	return fees, nil
+}
+
+func (c *ElectrumClient) Broadcast(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	var txid string
+	if err := c.call("blockchain.transaction.broadcast", &txid, hex.EncodeToString(buf.Bytes())); err != nil {
+		return "", err
+	}
+	return txid, nil
+}
+
+// TransactionStatus returns the status of 'txid' per the histories of its outputs' scripts, as the Electrum protocol
+// serves transactions' heights only by script. Unspendable outputs, e.g. OP_RETURN, are not indexed and so skipped.
+func (c *ElectrumClient) TransactionStatus(txid string) (*TransactionStatus, error) {
+	msgTx, err := c.transaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	searched := map[string]bool{}
+	for _, txOut := range msgTx.TxOut {
+		if txscript.IsUnspendable(txOut.PkScript) || searched[string(txOut.PkScript)] {
+			continue
+		}
+		searched[string(txOut.PkScript)] = true
+		history, err := c.scriptHistory(txOut.PkScript)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range history {
+			if entry.TxHash != txid {
+				continue
+			}
+			if entry.Height <= 0 {
+				return &TransactionStatus{}, nil
+			}
+			header, err := c.blockHeader(entry.Height)
+			if err != nil {
+				return nil, err
+			}
+			return &TransactionStatus{Confirmed: true, BlockHeight: entry.Height,
+				BlockHash: header.BlockHash().String(), BlockTime: header.Timestamp.Unix()}, nil
+		}
+	}
+	// known to the server, e.g. via its node's txindex, but not to its script index
+	return &TransactionStatus{}, nil
+}
+
+func (c *ElectrumClient) addressScript(address string) ([]byte, error) {
+	decoded, err := btcutil.DecodeAddress(address, c.params)
+	if err != nil {
+		return nil, err
+	}
+	if !decoded.IsForNet(c.params) {
+		return nil, fmt.Errorf("address %v is not for network %v", address, c.params.Name)
+	}
+	return txscript.PayToAddrScript(decoded)
+}
+
+// call sends the request of 'method' with 'params' and deserializes its result into 'result'
+func (c *ElectrumClient) call(method string, result any, params ...any) error {
+	if params == nil {
+		params = []any{}
+	}
+	responses := make(chan electrumResponse, 1)
+	c.lock.Lock()
+	if c.closed != nil {
+		c.lock.Unlock()
+		return fmt.Errorf("%v: %w", method, c.closed)
+	}
+	c.nextId++
+	id := c.nextId
+	c.pending[id] = responses
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		delete(c.pending, id)
+		c.lock.Unlock()
+	}()
+
+	request, err := json.Marshal(electrumRequest{JsonRpc: "2.0", Id: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	c.writeLock.Lock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err = c.conn.Write(append(request, '\n'))
+	c.writeLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("%v: %w", method, err)
+	}
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case response, ok := <-responses:
+		if !ok {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			return fmt.Errorf("%v: %w", method, c.closed)
+		}
+		if response.Error != nil {
+			return fmt.Errorf("%v: %w", method, response.Error)
+		}
+		if err = json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("%v: invalid response: %w", method, err)
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%v: timed out after %v", method, c.timeout)
+	}
+}
+
+// read dispatches the server's newline delimited messages, responses and notifications, until the connection closes
+func (c *ElectrumClient) read() {
+	scanner := bufio.NewScanner(c.conn)
+	// responses, e.g. of histories or transactions, may exceed the default token size
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var response electrumResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			continue
+		}
+		if response.Id == nil {
+			c.notify(response)
+			continue
+		}
+		c.lock.Lock()
+		responses, ok := c.pending[*response.Id]
+		c.lock.Unlock()
+		if ok {
+			responses <- response
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = errors.New("connection closed")
+	}
+	c.lock.Lock()
+	c.closed = fmt.Errorf("electrum connection closed: %w", err)
+	for id, responses := range c.pending {
+		close(responses)
+		delete(c.pending, id)
+	}
+	c.lock.Unlock()
+	close(c.done)
+}
+
+func (c *ElectrumClient) notify(notification electrumResponse) {
+	if notification.Method != "blockchain.scripthash.subscribe" || len(notification.Params) != 2 {
+		return
+	}
+	var scriptHash string
+	var status *string
+	if json.Unmarshal(notification.Params[0], &scriptHash) != nil || json.Unmarshal(notification.Params[1], &status) != nil {
+		return
+	}
+	c.lock.Lock()
+	script, ok := c.scripts[scriptHash]
+	if ok {
+		scriptStatus := ScriptStatus{Script: script}
+		if status != nil {
+			scriptStatus.Status = *status
+		}
+		if _, queued := c.undelivered[scriptHash]; !queued {
+			c.undeliveredOrder = append(c.undeliveredOrder, scriptHash)
+		}
+		c.undelivered[scriptHash] = scriptStatus
+	}
+	c.lock.Unlock()
+	if ok {
+		// never blocks the read loop; a pending signal already covers this status
+		select {
+		case c.notified <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliver sends the undelivered statuses to statuses, apart from the read loop so that a slow receiver does not
+// stall responses, until the connection closes
+func (c *ElectrumClient) deliver() {
+	defer close(c.statuses)
+	for {
+		select {
+		case <-c.notified:
+		case <-c.done:
+			return
+		}
+		for {
+			c.lock.Lock()
+			if len(c.undeliveredOrder) == 0 {
+				c.lock.Unlock()
+				break
+			}
+			scriptHash := c.undeliveredOrder[0]
+			c.undeliveredOrder = c.undeliveredOrder[1:]
+			status := c.undelivered[scriptHash]
+			delete(c.undelivered, scriptHash)
+			c.lock.Unlock()
+			select {
+			case c.statuses <- status:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+// isElectrumNotFound is whether 'err' is a server's error for an unknown transaction; servers relay their node's
+// error message
+func isElectrumNotFound(err error) bool {
+	var electrumErr *ElectrumError
+	if !errors.As(err, &electrumErr) {
+		return false
+	}
+	message := strings.ToLower(electrumErr.Message)
+	return strings.Contains(message, "no such mempool or blockchain transaction") ||
+		strings.Contains(message, "not found")
+}
@@ -0,0 +1,492 @@
+package leafy_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	electrumPrevTxId     = "c2c6063ec2a3ea72ac9dc75e3da3f19897e3291166c45b2a8a4d22178afb01e8"
+	electrumFundingTxId  = "7e413d360bde230115238ebf7a3c20a689be225a2d38c2efbc3c585b14c734e2"
+	electrumSpendingTxId = "6caddd56686eaae96ab4ace2b39b9a9d0fce919c63484df7bb37db913136bbb0"
+	electrumBlockHash    = "5eb0729601783e0f9fd14f227ef912e825cfe8a433c15381691d8f2e0af227e4"
+)
+
+// electrumRecording is a recorded request of an Electrum session and the server's response, along with any
+// notifications the server sent after it
+type electrumRecording struct {
+	Method        string            `json:"method"`
+	Params        json.RawMessage   `json:"params"`
+	Result        json.RawMessage   `json:"result"`
+	Error         json.RawMessage   `json:"error"`
+	Notifications []json.RawMessage `json:"notifications"`
+}
+
+// startFakeElectrum serves the recorded session of testdata/electrum_session.json, via TLS if 'tlsConfig' is set,
+// and returns the server's address
+func startFakeElectrum(t *testing.T, tlsConfig *tls.Config) string {
+	serialized, err := os.ReadFile("testdata/electrum_session.json")
+	require.NoError(t, err)
+	var recordings []electrumRecording
+	require.NoError(t, json.Unmarshal(serialized, &recordings))
+	var listener net.Listener
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go replayElectrum(t, conn, recordings)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func replayElectrum(t *testing.T, conn net.Conn, recordings []electrumRecording) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var request struct {
+			Id     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			t.Errorf("invalid electrum request: %v", err)
+			return
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": request.Id}
+		var notifications []json.RawMessage
+		recording := findElectrumRecording(recordings, request.Method, request.Params)
+		switch {
+		case recording == nil:
+			t.Errorf("unrecorded electrum request: %v %s", request.Method, request.Params)
+			response["error"] = map[string]any{"code": -32601, "message": "unrecorded request"}
+		case recording.Error != nil:
+			response["error"] = recording.Error
+		default:
+			response["result"] = recording.Result
+			notifications = recording.Notifications
+		}
+		if !writeElectrumLine(conn, response) {
+			return
+		}
+		for _, notification := range notifications {
+			if !writeElectrumLine(conn, notification) {
+				return
+			}
+		}
+	}
+}
+
+func findElectrumRecording(recordings []electrumRecording, method string, params json.RawMessage) *electrumRecording {
+	var requested any
+	if json.Unmarshal(params, &requested) != nil {
+		return nil
+	}
+	for i, recording := range recordings {
+		var recorded any
+		if recording.Method != method || json.Unmarshal(recording.Params, &recorded) != nil {
+			continue
+		}
+		if jsonEqual(recorded, requested) {
+			return &recordings[i]
+		}
+	}
+	return nil
+}
+
+func jsonEqual(a any, b any) bool {
+	serializedA, errA := json.Marshal(a)
+	serializedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(serializedA) == string(serializedB)
+}
+
+func writeElectrumLine(conn net.Conn, value any) bool {
+	serialized, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	_, err = conn.Write(append(serialized, '\n'))
+	return err == nil
+}
+
+func dialFakeElectrum(t *testing.T) *leafy.ElectrumClient {
+	client, err := leafy.DialElectrum(&chaincfg.RegressionNetParams, leafy.ElectrumConfig{
+		Address: startFakeElectrum(t, nil),
+		Timeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func electrumAddresses(t *testing.T) ([]string, [][]byte) {
+	params := &chaincfg.RegressionNetParams
+	addresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 6)
+	require.NoError(t, err)
+	scripts := make([][]byte, len(addresses))
+	for i, address := range addresses {
+		decoded, err := btcutil.DecodeAddress(address, params)
+		require.NoError(t, err)
+		scripts[i], err = txscript.PayToAddrScript(decoded)
+		require.NoError(t, err)
+	}
+	return addresses, scripts
+}
+
+func TestElectrumScriptHash(t *testing.T) {
+	// https://electrumx.readthedocs.io/en/latest/protocol-basics.html#script-hashes
+	script, err := hex.DecodeString("76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac")
+	require.NoError(t, err)
+	require.Equal(t, "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161", leafy.ElectrumScriptHash(script))
+}
+
+func TestElectrumAddressUtxos(t *testing.T) {
+	client := dialFakeElectrum(t)
+	addresses, scripts := electrumAddresses(t)
+
+	utxos, err := client.AddressUtxos(addresses[0])
+	require.NoError(t, err)
+	require.Empty(t, utxos)
+
+	utxos, err = client.AddressUtxos(addresses[1])
+	require.NoError(t, err)
+	require.Len(t, utxos, 2)
+	require.Equal(t, electrumFundingTxId, utxos[0].Outpoint.Hash.String())
+	require.Equal(t, uint32(1), utxos[0].Outpoint.Index)
+	require.Equal(t, int64(149_000), utxos[0].Amount)
+	require.Equal(t, int64(101), utxos[0].BlockHeight)
+	require.Equal(t, hex.EncodeToString(scripts[1]), utxos[0].Script)
+	require.Equal(t, addresses[1], utxos[0].FromAddress)
+	require.Equal(t, electrumSpendingTxId, utxos[1].Outpoint.Hash.String())
+	require.Equal(t, int64(0), utxos[1].BlockHeight)
+}
+
+func TestElectrumAddressTransactions(t *testing.T) {
+	client := dialFakeElectrum(t)
+	addresses, scripts := electrumAddresses(t)
+
+	txs, err := client.AddressTransactions(addresses[0])
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	// unconfirmed first
+	spending := txs[0]
+	require.Equal(t, electrumSpendingTxId, spending.TxId)
+	require.Equal(t, leafy.TransactionStatus{}, spending.Status)
+	require.Equal(t, int64(500), spending.Fee)
+	require.Equal(t, int64(444), spending.Weight)
+	require.Equal(t, electrumFundingTxId, spending.Inputs[0].Outpoint.Hash.String())
+	require.Equal(t, []string{strings.Repeat("03", 64)}, spending.Inputs[0].Witness)
+	require.Equal(t, &leafy.ChainTransactionOutput{Script: hex.EncodeToString(scripts[0]), Address: addresses[0],
+		Amount: 50_000}, spending.Inputs[0].PrevOut)
+	require.Equal(t, []leafy.ChainTransactionOutput{{Script: hex.EncodeToString(scripts[1]), Address: addresses[1],
+		Amount: 49_500}}, spending.Outputs)
+
+	funding := txs[1]
+	require.Equal(t, electrumFundingTxId, funding.TxId)
+	require.Equal(t, leafy.TransactionStatus{Confirmed: true, BlockHeight: 101, BlockHash: electrumBlockHash,
+		BlockTime: 1700000000}, funding.Status)
+	require.Equal(t, int64(1_000), funding.Fee)
+	require.Equal(t, electrumPrevTxId, funding.Inputs[0].Outpoint.Hash.String())
+	require.Equal(t, addresses[5], funding.Inputs[0].PrevOut.Address)
+	require.Len(t, funding.Outputs, 2)
+}
+
+func TestElectrumHistoryAndStatus(t *testing.T) {
+	client := dialFakeElectrum(t)
+	_, scripts := electrumAddresses(t)
+
+	history, err := client.HasHistory([][]byte{scripts[0], scripts[2]})
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, false}, history)
+
+	addresses, _ := electrumAddresses(t)
+	addressStatus, err := client.AddressStatus(addresses[0])
+	require.NoError(t, err)
+	expected := sha256.Sum256([]byte(electrumFundingTxId + ":101:" + electrumSpendingTxId + ":0:"))
+	require.Equal(t, hex.EncodeToString(expected[:]), addressStatus)
+	addressStatus, err = client.AddressStatus(addresses[2])
+	require.NoError(t, err)
+	require.Empty(t, addressStatus)
+
+	status, err := client.TransactionStatus(electrumFundingTxId)
+	require.NoError(t, err)
+	require.Equal(t, &leafy.TransactionStatus{Confirmed: true, BlockHeight: 101, BlockHash: electrumBlockHash,
+		BlockTime: 1700000000}, status)
+	status, err = client.TransactionStatus(electrumSpendingTxId)
+	require.NoError(t, err)
+	require.Equal(t, &leafy.TransactionStatus{}, status)
+	_, err = client.TransactionStatus("0000000000000000000000000000000000000000000000000000000000000001")
+	require.ErrorIs(t, err, leafy.ErrTransactionNotFound)
+}
+
+func TestElectrumTipHeightAndFees(t *testing.T) {
+	client := dialFakeElectrum(t)
+
+	height, err := client.TipHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(120), height)
+
+	fees, err := client.RecommendedFees()
+	require.NoError(t, err)
+	require.Equal(t, &leafy.RecommendedFees{Fastest: 25, HalfHour: 20, Hour: 1, Economy: 1, Minimum: 1}, fees)
+}
+
+func TestElectrumBroadcast(t *testing.T) {
+	client := dialFakeElectrum(t)
+	serialized, err := os.ReadFile("testdata/electrum_session.json")
+	require.NoError(t, err)
+	var recordings []electrumRecording
+	require.NoError(t, json.Unmarshal(serialized, &recordings))
+	recording := findElectrumRecording(recordings, "blockchain.transaction.get",
+		json.RawMessage(`["`+electrumSpendingTxId+`"]`))
+	var spendingHex string
+	require.NoError(t, json.Unmarshal(recording.Result, &spendingHex))
+	decoded, err := hex.DecodeString(spendingHex)
+	require.NoError(t, err)
+	var spending wire.MsgTx
+	require.NoError(t, spending.Deserialize(bytes.NewReader(decoded)))
+
+	txid, err := client.Broadcast(&spending)
+	require.NoError(t, err)
+	require.Equal(t, electrumSpendingTxId, txid)
+
+	spending.LockTime = 900000
+	_, err = client.Broadcast(&spending)
+	require.ErrorContains(t, err, "non-final")
+	var electrumErr *leafy.ElectrumError
+	require.ErrorAs(t, err, &electrumErr)
+	require.Equal(t, 1, electrumErr.Code)
+}
+
+func TestElectrumSubscribeScript(t *testing.T) {
+	client := dialFakeElectrum(t)
+	_, scripts := electrumAddresses(t)
+
+	status, err := client.SubscribeScript(scripts[2])
+	require.NoError(t, err)
+	require.Empty(t, status)
+
+	status, err = client.SubscribeScript(scripts[1])
+	require.NoError(t, err)
+	require.Equal(t, "f1c2b9a4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2", status)
+	select {
+	case changed := <-client.ScriptStatuses():
+		require.Equal(t, leafy.ScriptStatus{Script: scripts[1],
+			Status: "0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9"}, changed)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no script status notification")
+	}
+
+	require.NoError(t, client.Close())
+	_, err = client.TipHeight()
+	require.ErrorContains(t, err, "electrum connection closed")
+	_, open := <-client.ScriptStatuses()
+	require.False(t, open)
+}
+
+// startScriptedElectrum serves 'respond' of each request's method and params, writing the notifications it returns
+// after the response, and returns the server's address
+func startScriptedElectrum(t *testing.T, respond func(method string, params []json.RawMessage) (any, []any)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					var request struct {
+						Id     json.RawMessage   `json:"id"`
+						Method string            `json:"method"`
+						Params []json.RawMessage `json:"params"`
+					}
+					if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+						return
+					}
+					result, notifications := respond(request.Method, request.Params)
+					if !writeElectrumLine(conn, map[string]any{"jsonrpc": "2.0", "id": request.Id, "result": result}) {
+						return
+					}
+					for _, notification := range notifications {
+						if !writeElectrumLine(conn, notification) {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestElectrumCoalescesScriptStatuses(t *testing.T) {
+	_, scripts := electrumAddresses(t)
+	scriptHash := leafy.ElectrumScriptHash(scripts[0])
+	// more notifications than are buffered
+	const notified = 500
+	address := startScriptedElectrum(t, func(method string, params []json.RawMessage) (any, []any) {
+		switch method {
+		case "server.version":
+			return []string{"fake", "1.4"}, nil
+		case "blockchain.scripthash.subscribe":
+			notifications := make([]any, notified)
+			for i := range notifications {
+				notifications[i] = map[string]any{"jsonrpc": "2.0", "method": method,
+					"params": []any{scriptHash, fmt.Sprintf("%064x", i+1)}}
+			}
+			return nil, notifications
+		case "blockchain.headers.subscribe":
+			return map[string]any{"height": 120}, nil
+		}
+		return nil, nil
+	})
+	client, err := leafy.DialElectrum(&chaincfg.RegressionNetParams, leafy.ElectrumConfig{Address: address,
+		Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.SubscribeScript(scripts[0])
+	require.NoError(t, err)
+	// responses are not stalled by the undrained notifications
+	height, err := client.TipHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(120), height)
+	// and the latest status is delivered
+	received := 0
+	for {
+		select {
+		case status := <-client.ScriptStatuses():
+			received++
+			require.Equal(t, scripts[0], status.Script)
+			if status.Status == fmt.Sprintf("%064x", notified) {
+				require.LessOrEqual(t, received, notified)
+				return
+			}
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "latest script status not delivered")
+			return
+		}
+	}
+}
+
+func TestElectrumTransactionStatusSkipsUnspendableOutputs(t *testing.T) {
+	_, scripts := electrumAddresses(t)
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	opReturn, err := txscript.NullDataScript([]byte("leafy"))
+	require.NoError(t, err)
+	tx.AddTxOut(wire.NewTxOut(0, opReturn))
+	tx.AddTxOut(wire.NewTxOut(10_000, scripts[3]))
+	var serialized bytes.Buffer
+	require.NoError(t, tx.Serialize(&serialized))
+	txid := tx.TxHash().String()
+	header := wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, 0)
+	header.Timestamp = time.Unix(1700000000, 0)
+	var serializedHeader bytes.Buffer
+	require.NoError(t, header.Serialize(&serializedHeader))
+
+	address := startScriptedElectrum(t, func(method string, params []json.RawMessage) (any, []any) {
+		switch method {
+		case "server.version":
+			return []string{"fake", "1.4"}, nil
+		case "blockchain.transaction.get":
+			return hex.EncodeToString(serialized.Bytes()), nil
+		case "blockchain.scripthash.get_history":
+			var scriptHash string
+			require.NoError(t, json.Unmarshal(params[0], &scriptHash))
+			require.Equal(t, leafy.ElectrumScriptHash(scripts[3]), scriptHash)
+			return []any{map[string]any{"tx_hash": txid, "height": 101}}, nil
+		case "blockchain.block.header":
+			return hex.EncodeToString(serializedHeader.Bytes()), nil
+		}
+		return nil, nil
+	})
+	client, err := leafy.DialElectrum(&chaincfg.RegressionNetParams, leafy.ElectrumConfig{Address: address,
+		Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	defer client.Close()
+
+	status, err := client.TransactionStatus(txid)
+	require.NoError(t, err)
+	require.Equal(t, &leafy.TransactionStatus{Confirmed: true, BlockHeight: 101, BlockHash: header.BlockHash().String(),
+		BlockTime: 1700000000}, status)
+}
+
+func TestElectrumTLS(t *testing.T) {
+	certificate := selfSignedCertificate(t)
+	address := startFakeElectrum(t, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate.Leaf)
+	client, err := leafy.DialElectrum(&chaincfg.RegressionNetParams, leafy.ElectrumConfig{
+		Address:   address,
+		TLS:       true,
+		TLSConfig: &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"},
+		Timeout:   5 * time.Second,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	height, err := client.TipHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(120), height)
+
+	_, err = leafy.DialElectrum(&chaincfg.RegressionNetParams, leafy.ElectrumConfig{
+		Address: address,
+		TLS:     true,
+		Timeout: 5 * time.Second,
+	})
+	require.ErrorContains(t, err, "failed to connect to electrum server")
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
@@ -0,0 +1,381 @@
+package leafy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// esploraChainPageSize is the number of confirmed transactions per page of an Esplora address' transactions
+const esploraChainPageSize = 25
+
+// EsploraClient is a ChainBackend of an Esplora REST API, e.g. https://mempool.space/api or
+// https://blockstream.info/api
+type EsploraClient struct {
+	params  *chaincfg.Params
+	baseURL string
+	// HTTPClient performs the requests; defaults to a client with a 30 second timeout
+	HTTPClient *http.Client
+}
+
+var _ ChainBackend = (*EsploraClient)(nil)
+var _ HistoryLookup = (*EsploraClient)(nil)
+
+// NewEsploraClient creates an EsploraClient of the API at 'baseURL' serving the 'params' network
+func NewEsploraClient(params *chaincfg.Params, baseURL string) *EsploraClient {
+	return &EsploraClient{
+		params:     params,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type esploraStatus struct {
+	Confirmed   bool   `json:"confirmed"`
+	BlockHeight int64  `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+	BlockTime   int64  `json:"block_time"`
+}
+
+func (s esploraStatus) toStatus() TransactionStatus {
+	return TransactionStatus{Confirmed: s.Confirmed, BlockHeight: s.BlockHeight, BlockHash: s.BlockHash,
+		BlockTime: s.BlockTime}
+}
+
+type esploraUtxo struct {
+	TxId   string        `json:"txid"`
+	Vout   uint32        `json:"vout"`
+	Value  int64         `json:"value"`
+	Status esploraStatus `json:"status"`
+}
+
+type esploraOutput struct {
+	ScriptPubKey        string `json:"scriptpubkey"`
+	ScriptPubKeyAddress string `json:"scriptpubkey_address"`
+	Value               int64  `json:"value"`
+}
+
+func (o esploraOutput) toOutput() ChainTransactionOutput {
+	return ChainTransactionOutput{Script: o.ScriptPubKey, Address: o.ScriptPubKeyAddress, Amount: o.Value}
+}
+
+type esploraInput struct {
+	TxId       string         `json:"txid"`
+	Vout       uint32         `json:"vout"`
+	PrevOut    *esploraOutput `json:"prevout"`
+	Sequence   uint32         `json:"sequence"`
+	IsCoinbase bool           `json:"is_coinbase"`
+	Witness    []string       `json:"witness"`
+}
+
+type esploraTransaction struct {
+	TxId   string          `json:"txid"`
+	Vin    []esploraInput  `json:"vin"`
+	Vout   []esploraOutput `json:"vout"`
+	Weight int64           `json:"weight"`
+	Fee    int64           `json:"fee"`
+	Status esploraStatus   `json:"status"`
+}
+
+func (t esploraTransaction) toTransaction() (ChainTransaction, error) {
+	tx := ChainTransaction{TxId: t.TxId, Status: t.Status.toStatus(), Fee: t.Fee, Weight: t.Weight,
+		Inputs: make([]ChainTransactionInput, len(t.Vin)), Outputs: make([]ChainTransactionOutput, len(t.Vout))}
+	for i, vin := range t.Vin {
+		input := ChainTransactionInput{Sequence: vin.Sequence, Coinbase: vin.IsCoinbase, Witness: vin.Witness}
+		if vin.IsCoinbase {
+			input.Outpoint = wire.OutPoint{Index: vin.Vout}
+		} else {
+			hash, err := chainhash.NewHashFromStr(vin.TxId)
+			if err != nil {
+				return ChainTransaction{}, fmt.Errorf("invalid input txid of %v: %w", t.TxId, err)
+			}
+			input.Outpoint = wire.OutPoint{Hash: *hash, Index: vin.Vout}
+		}
+		if vin.PrevOut != nil {
+			prevOut := vin.PrevOut.toOutput()
+			input.PrevOut = &prevOut
+		}
+		tx.Inputs[i] = input
+	}
+	for i, vout := range t.Vout {
+		tx.Outputs[i] = vout.toOutput()
+	}
+	return tx, nil
+}
+
+// AddressUtxos returns the utxos of 'address' along with its script, which Esplora does not serve
+func (c *EsploraClient) AddressUtxos(address string) ([]Utxo, error) {
+	decoded, err := btcutil.DecodeAddress(address, c.params)
+	if err != nil {
+		return nil, err
+	}
+	if !decoded.IsForNet(c.params) {
+		return nil, fmt.Errorf("address %v is not for network %v", address, c.params.Name)
+	}
+	script, err := txscript.PayToAddrScript(decoded)
+	if err != nil {
+		return nil, err
+	}
+	var esploraUtxos []esploraUtxo
+	if err = c.getJSON(fmt.Sprintf("/address/%s/utxo", address), &esploraUtxos); err != nil {
+		return nil, err
+	}
+	utxos := make([]Utxo, len(esploraUtxos))
+	for i, esploraUtxo := range esploraUtxos {
+		hash, err := chainhash.NewHashFromStr(esploraUtxo.TxId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid utxo txid: %w", err)
+		}
+		utxos[i] = Utxo{
+			FromAddress: address,
+			Outpoint:    wire.OutPoint{Hash: *hash, Index: esploraUtxo.Vout},
+			Amount:      esploraUtxo.Value,
+			Script:      hex.EncodeToString(script),
+			BlockHeight: esploraUtxo.Status.BlockHeight,
+		}
+	}
+	return utxos, nil
+}
+
+// AddressTransactions returns all transactions of 'address', unconfirmed first and then confirmed from the newest,
+// paging through the confirmed transactions as needed
+func (c *EsploraClient) AddressTransactions(address string) ([]ChainTransaction, error) {
+	var page []esploraTransaction
+	if err := c.getJSON(fmt.Sprintf("/address/%s/txs", address), &page); err != nil {
+		return nil, err
+	}
+	var txs []ChainTransaction
+	for {
+		confirmed := 0
+		lastConfirmed := ""
+		for _, esploraTx := range page {
+			tx, err := esploraTx.toTransaction()
+			if err != nil {
+				return nil, err
+			}
+			txs = append(txs, tx)
+			if esploraTx.Status.Confirmed {
+				confirmed++
+				lastConfirmed = esploraTx.TxId
+			}
+		}
+		if confirmed < esploraChainPageSize {
+			return txs, nil
+		}
+		page = nil
+		if err := c.getJSON(fmt.Sprintf("/address/%s/txs/chain/%s", address, lastConfirmed), &page); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// esploraAddress is the summary of an address' transactions, confirmed (chain) and unconfirmed (mempool)
+type esploraAddress struct {
+	ChainStats   esploraAddressStats `json:"chain_stats"`
+	MempoolStats esploraAddressStats `json:"mempool_stats"`
+}
+
+type esploraAddressStats struct {
+	TxCount      int64 `json:"tx_count"`
+	FundedTxoSum int64 `json:"funded_txo_sum"`
+	SpentTxoSum  int64 `json:"spent_txo_sum"`
+}
+
+// HasHistory implements HistoryLookup via the transaction counts of each script's address, without fetching its
+// transactions
+func (c *EsploraClient) HasHistory(scripts [][]byte) ([]bool, error) {
+	history := make([]bool, len(scripts))
+	for i, script := range scripts {
+		address, err := singleAddress(c.params, script)
+		if err != nil {
+			return nil, err
+		}
+		var summary esploraAddress
+		if err = c.getJSON(fmt.Sprintf("/address/%s", address), &summary); err != nil {
+			return nil, err
+		}
+		history[i] = summary.ChainStats.TxCount+summary.MempoolStats.TxCount > 0
+	}
+	return history, nil
+}
+
+// AddressStatus implements AddressStatusLookup via the transaction counts and sums of the address' confirmed and
+// unconfirmed outputs
+func (c *EsploraClient) AddressStatus(address string) (string, error) {
+	var summary esploraAddress
+	if err := c.getJSON(fmt.Sprintf("/address/%s", address), &summary); err != nil {
+		return "", err
+	}
+	chain, mempool := summary.ChainStats, summary.MempoolStats
+	if chain.TxCount+mempool.TxCount == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%d:%d:%d|%d:%d:%d", chain.TxCount, chain.FundedTxoSum, chain.SpentTxoSum, mempool.TxCount,
+		mempool.FundedTxoSum, mempool.SpentTxoSum), nil
+}
+
+func (c *EsploraClient) TipHeight() (int64, error) {
+	body, err := c.get("/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tip height: %w", err)
+	}
+	return height, nil
+}
+
+// RecommendedFees returns mempool.space's recommended fees or, if not served (i.e. plain Esplora), those derived
+// from the Esplora fee estimates
+func (c *EsploraClient) RecommendedFees() (*RecommendedFees, error) {
+	var recommended struct {
+		FastestFee  float64 `json:"fastestFee"`
+		HalfHourFee float64 `json:"halfHourFee"`
+		HourFee     float64 `json:"hourFee"`
+		EconomyFee  float64 `json:"economyFee"`
+		MinimumFee  float64 `json:"minimumFee"`
+	}
+	found, err := c.getJSONIfFound("/v1/fees/recommended", &recommended)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return &RecommendedFees{Fastest: recommended.FastestFee, HalfHour: recommended.HalfHourFee,
+			Hour: recommended.HourFee, Economy: recommended.EconomyFee, Minimum: recommended.MinimumFee}, nil
+	}
+	var estimates map[string]float64
+	if err = c.getJSON("/fee-estimates", &estimates); err != nil {
+		return nil, err
+	}
+	return recommendedFeesFromEstimates(estimates)
+}
+
+// recommendedFeesFromEstimates converts Esplora's fee rates by confirmation target, in blocks, to RecommendedFees;
+// a target without an estimate uses that of the nearest lesser target
+func recommendedFeesFromEstimates(estimates map[string]float64) (*RecommendedFees, error) {
+	targets := make([]int, 0, len(estimates))
+	rates := make(map[int]float64, len(estimates))
+	for target, rate := range estimates {
+		blocks, err := strconv.Atoi(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fee estimate target: %v", target)
+		}
+		targets = append(targets, blocks)
+		rates[blocks] = rate
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no fee estimates")
+	}
+	sort.Ints(targets)
+	forTarget := func(blocks int) float64 {
+		rate := rates[targets[0]]
+		for _, target := range targets {
+			if target > blocks {
+				break
+			}
+			rate = rates[target]
+		}
+		return rate
+	}
+	minimum := math.Max(1, rates[targets[len(targets)-1]])
+	return &RecommendedFees{Fastest: forTarget(1), HalfHour: forTarget(3), Hour: forTarget(6),
+		Economy: forTarget(144), Minimum: minimum}, nil
+}
+
+func (c *EsploraClient) Broadcast(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	body, err := c.do(http.MethodPost, "/tx", strings.NewReader(hex.EncodeToString(buf.Bytes())))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (c *EsploraClient) TransactionStatus(txid string) (*TransactionStatus, error) {
+	var status esploraStatus
+	found, err := c.getJSONIfFound(fmt.Sprintf("/tx/%s/status", txid), &status)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %v", ErrTransactionNotFound, txid)
+	}
+	transactionStatus := status.toStatus()
+	return &transactionStatus, nil
+}
+
+type esploraStatusError struct {
+	statusCode int
+}
+
+func (e *esploraStatusError) Error() string {
+	return fmt.Sprintf("status %d", e.statusCode)
+}
+
+func (c *EsploraClient) get(path string) ([]byte, error) {
+	return c.do(http.MethodGet, path, nil)
+}
+
+func (c *EsploraClient) getJSON(path string, value any) error {
+	body, err := c.get(path)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("esplora %v: invalid response: %w", path, err)
+	}
+	return nil
+}
+
+// getJSONIfFound is getJSON returning false, rather than an error, if 'path' is not found
+func (c *EsploraClient) getJSONIfFound(path string, value any) (bool, error) {
+	err := c.getJSON(path, value)
+	var statusErr *esploraStatusError
+	if errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *EsploraClient) do(method string, path string, requestBody io.Reader) ([]byte, error) {
+	request, err := http.NewRequest(method, c.baseURL+path, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	if requestBody != nil {
+		request.Header.Set("Content-Type", "text/plain")
+	}
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("esplora %v: %w", path, err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("esplora %v: %w", path, err)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message := strings.TrimSpace(string(body))
+		return nil, fmt.Errorf("esplora %v: %w: %v", path, &esploraStatusError{statusCode: response.StatusCode},
+			message)
+	}
+	return body, nil
+}
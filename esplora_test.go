@@ -0,0 +1,250 @@
+package leafy_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"io"
+	"leafy"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const esploraTxId = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+func newEsploraServer(t *testing.T, handlers map[string]http.HandlerFunc) (*leafy.EsploraClient, *httptest.Server) {
+	mux := http.NewServeMux()
+	for pattern, handler := range handlers {
+		mux.HandleFunc(pattern, handler)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return leafy.NewEsploraClient(&chaincfg.RegressionNetParams, server.URL+"/api/"), server
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, value any) {
+	require.NoError(t, json.NewEncoder(w).Encode(value))
+}
+
+func esploraTx(txid string, confirmed bool, height int64) map[string]any {
+	status := map[string]any{"confirmed": confirmed}
+	if confirmed {
+		status["block_height"] = height
+		status["block_hash"] = fmt.Sprintf("%064x", height)
+		status["block_time"] = 1700000000 + height
+	}
+	return map[string]any{
+		"txid": txid,
+		"vin": []any{map[string]any{
+			"txid": esploraTxId, "vout": 1, "sequence": 0xfffffffd, "is_coinbase": false, "witness": []string{"aa"},
+			"prevout": map[string]any{"scriptpubkey": "5120aa", "scriptpubkey_address": "bcrt1pxx", "value": 20_000},
+		}},
+		"vout":   []any{map[string]any{"scriptpubkey": "5120bb", "scriptpubkey_address": "bcrt1pyy", "value": 19_000}},
+		"weight": 600,
+		"fee":    1_000,
+		"status": status,
+	}
+}
+
+func TestEsploraAddressUtxos(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 1)
+	require.NoError(t, err)
+	client, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/address/" + addresses[0] + "/utxo": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(t, w, []any{
+				map[string]any{"txid": esploraTxId, "vout": 1, "value": 50_000,
+					"status": map[string]any{"confirmed": true, "block_height": 120}},
+				map[string]any{"txid": esploraTxId, "vout": 2, "value": 7_000,
+					"status": map[string]any{"confirmed": false}},
+			})
+		},
+	})
+	utxos, err := client.AddressUtxos(addresses[0])
+	require.NoError(t, err)
+	require.Len(t, utxos, 2)
+	hash, err := chainhash.NewHashFromStr(esploraTxId)
+	require.NoError(t, err)
+	require.Equal(t, wire.OutPoint{Hash: *hash, Index: 1}, utxos[0].Outpoint)
+	require.Equal(t, int64(50_000), utxos[0].Amount)
+	require.Equal(t, int64(120), utxos[0].BlockHeight)
+	require.Equal(t, addresses[0], utxos[0].FromAddress)
+	require.Equal(t, int64(0), utxos[1].BlockHeight)
+	script, err := utxos[0].DecodeScript()
+	require.NoError(t, err)
+	require.Len(t, script, 34)
+	require.Equal(t, utxos[0].Script, utxos[1].Script)
+
+	_, err = client.AddressUtxos("bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq")
+	require.Error(t, err)
+}
+
+func TestEsploraAddressTransactions(t *testing.T) {
+	address := "bcrt1ptest"
+	chainPages := 0
+	client, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/address/" + address + "/txs": func(w http.ResponseWriter, r *http.Request) {
+			txs := []any{esploraTx("mempool", false, 0)}
+			for i := 0; i < 25; i++ {
+				txs = append(txs, esploraTx(fmt.Sprintf("%064x", 1000-i), true, int64(1000-i)))
+			}
+			writeJSON(t, w, txs)
+		},
+		"/api/address/" + address + "/txs/chain/": func(w http.ResponseWriter, r *http.Request) {
+			chainPages++
+			require.Equal(t, fmt.Sprintf("/api/address/%s/txs/chain/%064x", address, 976), r.URL.Path)
+			writeJSON(t, w, []any{esploraTx(fmt.Sprintf("%064x", 1), true, 1)})
+		},
+	})
+	txs, err := client.AddressTransactions(address)
+	require.NoError(t, err)
+	require.Equal(t, 1, chainPages)
+	require.Len(t, txs, 27)
+	require.Equal(t, "mempool", txs[0].TxId)
+	require.False(t, txs[0].Status.Confirmed)
+	require.Equal(t, leafy.TransactionStatus{Confirmed: true, BlockHeight: 1000, BlockHash: fmt.Sprintf("%064x", 1000),
+		BlockTime: 1700001000}, txs[1].Status)
+	require.Equal(t, int64(1_000), txs[1].Fee)
+	require.Equal(t, int64(600), txs[1].Weight)
+	require.Equal(t, uint32(1), txs[1].Inputs[0].Outpoint.Index)
+	require.Equal(t, esploraTxId, txs[1].Inputs[0].Outpoint.Hash.String())
+	require.Equal(t, []string{"aa"}, txs[1].Inputs[0].Witness)
+	require.Equal(t, &leafy.ChainTransactionOutput{Script: "5120aa", Address: "bcrt1pxx", Amount: 20_000},
+		txs[1].Inputs[0].PrevOut)
+	require.Equal(t, []leafy.ChainTransactionOutput{{Script: "5120bb", Address: "bcrt1pyy", Amount: 19_000}},
+		txs[1].Outputs)
+	require.Equal(t, fmt.Sprintf("%064x", 1), txs[26].TxId)
+}
+
+func TestEsploraTipHeightAndBroadcast(t *testing.T) {
+	msgTx := wire.NewMsgTx(2)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1_000, []byte{0x51}))
+	msgTx.LockTime = 900000
+	client, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/blocks/tip/height": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("840000"))
+		},
+		"/api/tx": func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			serialized, err := hex.DecodeString(string(body))
+			require.NoError(t, err)
+			var tx wire.MsgTx
+			require.NoError(t, tx.Deserialize(bytes.NewReader(serialized)))
+			if tx.LockTime > 840000 {
+				http.Error(w, "sendrawtransaction RPC error: non-final", http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(tx.TxHash().String()))
+		},
+	})
+	height, err := client.TipHeight()
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), height)
+
+	_, err = client.Broadcast(msgTx)
+	require.ErrorContains(t, err, "status 400: sendrawtransaction RPC error: non-final")
+	msgTx.LockTime = 0
+	txid, err := client.Broadcast(msgTx)
+	require.NoError(t, err)
+	require.Equal(t, msgTx.TxHash().String(), txid)
+}
+
+func TestEsploraRecommendedFees(t *testing.T) {
+	mempool, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/v1/fees/recommended": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"fastestFee":25,"halfHourFee":20,"hourFee":15,"economyFee":5,"minimumFee":1}`))
+		},
+	})
+	fees, err := mempool.RecommendedFees()
+	require.NoError(t, err)
+	require.Equal(t, &leafy.RecommendedFees{Fastest: 25, HalfHour: 20, Hour: 15, Economy: 5, Minimum: 1}, fees)
+
+	esplora, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/fee-estimates": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"1":30.5,"2":22.1,"5":12.0,"144":3.2,"1008":0.5}`))
+		},
+	})
+	fees, err = esplora.RecommendedFees()
+	require.NoError(t, err)
+	require.Equal(t, &leafy.RecommendedFees{Fastest: 30.5, HalfHour: 22.1, Hour: 12.0, Economy: 3.2, Minimum: 1}, fees)
+
+	failing, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/v1/fees/recommended": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		},
+	})
+	_, err = failing.RecommendedFees()
+	require.ErrorContains(t, err, "status 503")
+}
+
+func TestEsploraTransactionStatus(t *testing.T) {
+	client, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/tx/": func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/tx/"+esploraTxId) {
+				http.Error(w, "Transaction not found", http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"confirmed":true,"block_height":100,"block_hash":"00ff","block_time":1700000000}`))
+		},
+	})
+	status, err := client.TransactionStatus(esploraTxId)
+	require.NoError(t, err)
+	require.Equal(t, &leafy.TransactionStatus{Confirmed: true, BlockHeight: 100, BlockHash: "00ff",
+		BlockTime: 1700000000}, status)
+	_, err = client.TransactionStatus(strings.Repeat("0", 64))
+	require.ErrorIs(t, err, leafy.ErrTransactionNotFound)
+}
+
+func TestChainBackendHistoryLookup(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	addresses, err := leafy.GetAddresses(params, wallet, 0, 30)
+	require.NoError(t, err)
+	client, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/address/": func(w http.ResponseWriter, r *http.Request) {
+			// the address' transaction counts suffice; its transactions are not fetched
+			require.NotContains(t, r.URL.Path, "/txs")
+			count := 0
+			if r.URL.Path == "/api/address/"+addresses[2] {
+				count = 60
+			}
+			writeJSON(t, w, map[string]any{
+				"chain_stats":   map[string]any{"tx_count": count},
+				"mempool_stats": map[string]any{"tx_count": 0},
+			})
+		},
+	})
+	discovery, err := leafy.DiscoverAddresses(params, wallet, 5, leafy.ChainBackendHistoryLookup(params, client))
+	require.NoError(t, err)
+	require.True(t, discovery.Used)
+	require.Equal(t, uint32(2), discovery.HighestUsedIndex)
+}
+
+func TestEsploraAddressStatus(t *testing.T) {
+	client, _ := newEsploraServer(t, map[string]http.HandlerFunc{
+		"/api/address/": func(w http.ResponseWriter, r *http.Request) {
+			stats := map[string]any{"tx_count": 0, "funded_txo_sum": 0, "spent_txo_sum": 0}
+			if r.URL.Path == "/api/address/bcrt1pused" {
+				stats = map[string]any{"tx_count": 2, "funded_txo_sum": 30_000, "spent_txo_sum": 10_000}
+			}
+			writeJSON(t, w, map[string]any{"chain_stats": stats,
+				"mempool_stats": map[string]any{"tx_count": 0, "funded_txo_sum": 0, "spent_txo_sum": 0}})
+		},
+	})
+	status, err := client.AddressStatus("bcrt1pused")
+	require.NoError(t, err)
+	require.Equal(t, "2:30000:10000|0:0:0", status)
+	status, err = client.AddressStatus("bcrt1punused")
+	require.NoError(t, err)
+	require.Empty(t, status)
+}
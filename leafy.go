@@ -8,7 +8,6 @@ import (
 	"crypto/x509"
 	"encoding/hex"
 	"fmt"
-	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
@@ -16,14 +15,16 @@ import (
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/tyler-smith/go-bip39"
-	"math"
 )
 
 const P2trDustAmt = 330
 
+// DefaultTimelock is the recovery path timelock, in blocks, of wallets created without a WalletConfig
 const DefaultTimelock = 52560
 
-// Timelock non-const for testing
+// Timelock was the recovery path timelock, in blocks, of wallets created without a WalletConfig; it is no longer read
+//
+// Deprecated: configure the timelock of a wallet via WalletConfig; see NewWalletWithConfig and DefaultTimelock.
 var Timelock uint32 = DefaultTimelock
 
 // GetAddresses generates 'num' of addresses for the provided Leafy wallet.
@@ -33,46 +34,54 @@ func GetAddresses(
 	startIndex uint32,
 	num uint8,
 ) ([]string, error) {
-	if num < 1 {
-		return nil, fmt.Errorf("invalid amount of addresses [%d], must be greater than 0", num)
-	}
-	firstKey, err := getBip44Key(wallet.GetFirstMnemonic(), params, startIndex)
+	return GetChainAddresses(params, wallet, ExternalChain, startIndex, num)
+}
+
+// GetAddressesForAccount is GetAddresses for BIP-44 'account' of 'wallet'; see WalletForAccount
+func GetAddressesForAccount(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	account uint32,
+	startIndex uint32,
+	num uint8,
+) ([]string, error) {
+	accountWallet, err := RecoveryWalletForAccount(params, wallet, account)
 	if err != nil {
 		return nil, err
 	}
-	secondDescriptor, err := wallet.GetSecondDescriptor(params)
-	if err != nil {
-		return nil, err
+	return GetAddresses(params, accountWallet, startIndex, num)
+}
+
+// GetChainAddresses is GetAddresses for the addresses of 'chain'; i.e. InternalChain for change addresses
+func GetChainAddresses(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	chain uint32,
+	startIndex uint32,
+	num uint8,
+) ([]string, error) {
+	if num < 1 {
+		return nil, fmt.Errorf("invalid amount of addresses [%d], must be greater than 0", num)
+	}
+	if uint64(startIndex)+uint64(num) > hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("exhausted address indices at %d", startIndex)
 	}
-	secondKey, err := ImportFromTaprootDescriptorForParentWithoutChecksum(secondDescriptor, Path(startIndex))
+	deriver, err := newAddressDeriver(params, wallet, addressBranch{chain: chain})
 	if err != nil {
 		return nil, err
 	}
 	addresses := make([]string, num)
 	for i := uint8(0); i < num; i++ {
-		firstPrivateKey, err := firstKey.GetPrivateKey()
-		if err != nil {
-			return nil, err
-		}
-		secondPublicKey, err := secondKey.GetPublicKey()
+		firstPrivateKey, secondPublicKey, err := deriver.keysAt(startIndex + uint32(i))
 		if err != nil {
 			return nil, err
 		}
-		address, _, _, _, err := createTweakedAddressFromPublicKey(params, secondPublicKey, firstPrivateKey)
+		address, _, _, _, err := createTweakedAddressFromPublicKey(params, GetWalletConfig(wallet).Timelock, secondPublicKey, firstPrivateKey)
 		if err != nil {
 			return nil, err
 		}
 		addresses[i] = address.EncodeAddress()
-		firstKey, err = firstKey.DeriveNextSibling()
-		if err != nil {
-			return nil, err
-		}
-		secondKey, err = secondKey.DeriveNextSibling()
-		if err != nil {
-			return nil, err
-		}
 	}
-
 	return addresses, nil
 }
 
@@ -90,8 +99,49 @@ func CreateAndSignTransaction(
 	if err != nil {
 		return nil, err
 	}
+	return SignTransaction(params, wallet, tx)
+}
+
+// CreateAndSignTransactionForAccount is CreateAndSignTransaction for BIP-44 'account' of 'wallet'; see
+// WalletForAccount
+func CreateAndSignTransactionForAccount(
+	params *chaincfg.Params,
+	wallet Wallet,
+	account uint32,
+	utxos []Utxo,
+	changeAddress btcutil.Address,
+	destination btcutil.Address,
+	amount int64,
+	feeRate float64,
+) (*SignedMsg, error) {
+	accountWallet, err := WalletForAccount(wallet, account)
+	if err != nil {
+		return nil, err
+	}
+	return CreateAndSignTransaction(params, accountWallet, utxos, changeAddress, destination, amount, feeRate)
+}
+
+// SignTransaction signs each input of 'tx' via the key path of its Leafy address. The derivation index of each
+// address is found by deriving the wallet's addresses, see SignTransactionWithIndexer.
+func SignTransaction(
+	params *chaincfg.Params,
+	wallet Wallet,
+	tx *TransactionInfo,
+) (*SignedMsg, error) {
+	return SignTransactionWithIndexer(params, wallet, tx, nil)
+}
+
+// SignTransactionWithIndexer is like SignTransaction but looks up the derivation index of each input's address via
+// 'indexer' (e.g. an AddressCache). Inputs whose Utxo carried a DerivationIndex use it instead. If 'indexer' is nil,
+// up to the first 1000 addresses are derived for the other inputs.
+func SignTransactionWithIndexer(
+	params *chaincfg.Params,
+	wallet Wallet,
+	tx *TransactionInfo,
+	indexer AddressIndexer,
+) (*SignedMsg, error) {
 	msgTx := tx.MsgTx.Copy()
-	signingKeys, err := findSigningKeys(params, wallet, tx)
+	signingKeys, err := findSigningKeys(params, wallet, tx, indexer)
 	if err != nil {
 		return nil, err
 	}
@@ -160,61 +210,91 @@ func findSigningKeys(
 	params *chaincfg.Params,
 	wallet Wallet,
 	transactionInfo *TransactionInfo,
+	indexer AddressIndexer,
 ) (map[string]*signingKeys, error) {
-	firstKey, err := getBip44Key(wallet.GetFirstMnemonic(), params, 0)
-	if err != nil {
-		return nil, err
-	}
-	secondKey, err := getBip44Key(wallet.GetSecondMnemonic(), params, 0)
+	indexer, err := signingIndexer(params, wallet, transactionInfo, indexer)
 	if err != nil {
 		return nil, err
 	}
+	derivers := newAddressDerivers(params, wallet)
 	mapping := make(map[string]*signingKeys, 0)
-	allMapped := false
-	// Leafy uses up to 1000 addresses
-outer:
-	for i := uint(0); i < 10; i++ {
-		for j := uint8(i * 100); j < uint8(i*100)+100; j++ {
-			firstPrivateKey, err := firstKey.GetPrivateKey()
-			if err != nil {
-				return nil, err
-			}
-			secondPrivateKey, err := secondKey.GetPrivateKey()
-			if err != nil {
-				return nil, err
-			}
-			address, _, tweakedPrivateKey, merkleRoot, _, err := createTweakedAddress(params, secondPrivateKey, firstPrivateKey)
-			if err != nil {
-				return nil, err
-			}
-			mapping[address.EncodeAddress()] = &signingKeys{
-				tweakedPrivateKey: tweakedPrivateKey,
-				merkleRoot:        merkleRoot,
-			}
-			secondKey, err = secondKey.DeriveNextSibling()
-			if err != nil {
-				return nil, err
-			}
-			firstKey, err = firstKey.DeriveNextSibling()
-			if err != nil {
-				return nil, err
-			}
+	for outpoint, script := range transactionInfo.outpointToScript {
+		derivation, found := transactionInfo.outpointToDerivation[outpoint]
+		if !found {
+			derivation, found = indexer.IndexOf(script)
 		}
-		for _, value := range transactionInfo.outpointToAddr {
-			_, found := mapping[value]
-			if !found {
-				continue outer
-			}
+		if !found {
+			return nil, fmt.Errorf("failed to find signing keys for inputted address %s", transactionInfo.outpointToAddr[outpoint])
+		}
+		deriver, err := derivers.forDerivation(derivation)
+		if err != nil {
+			return nil, err
+		}
+		firstIndexKey, secondIndexKey, err := deriver.bip44KeysAt(derivation.Index)
+		if err != nil {
+			return nil, err
+		}
+		firstPrivateKey, err := firstIndexKey.GetPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		secondPrivateKey, err := secondIndexKey.GetPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		address, _, tweakedPrivateKey, merkleRoot, _, err := createTweakedAddress(params, GetWalletConfig(wallet).Timelock, secondPrivateKey, firstPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkIndexedScript(address, script, derivation); err != nil {
+			return nil, err
+		}
+		mapping[address.EncodeAddress()] = &signingKeys{
+			tweakedPrivateKey: tweakedPrivateKey,
+			merkleRoot:        merkleRoot,
 		}
-		allMapped = true
-		break outer
-	}
-	if !allMapped {
-		return nil, fmt.Errorf("failed to find signing keys for inputted addresses")
 	}
 	return mapping, nil
 }
 
+// signingIndexer returns 'indexer' or, if nil, an AddressIndexer for the inputs of 'transactionInfo' whose Utxo did
+// not carry a derivation index
+func signingIndexer(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	transactionInfo *TransactionInfo,
+	indexer AddressIndexer,
+) (AddressIndexer, error) {
+	if indexer != nil {
+		return indexer, nil
+	}
+	scripts := make([][]byte, 0, len(transactionInfo.outpointToScript))
+	for outpoint, script := range transactionInfo.outpointToScript {
+		if _, indexed := transactionInfo.outpointToDerivation[outpoint]; !indexed {
+			scripts = append(scripts, script)
+		}
+	}
+	if len(scripts) == 0 {
+		return &DiscoveryResult{}, nil
+	}
+	return scanAddressIndices(params, wallet, scripts)
+}
+
+// checkIndexedScript returns an error if 'address' (derived at 'derivation') does not pay to 'script'
+func checkIndexedScript(address btcutil.Address, script []byte, derivation AddressDerivation) error {
+	addressScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(addressScript, script) {
+		return fmt.Errorf("script %x does not match address %s of chain %d index %d", script, address.EncodeAddress(),
+			derivation.Chain, derivation.Index)
+	}
+	return nil
+}
+
+// CreateAndSignRecoveryTransaction uses CreateRecoveryTransaction and signs the created transaction via the timelock script path.
+// Every input must be mature, else the transaction is not final (BIP-68); see CreateAndSignMatureRecoveryTransaction.
 func CreateAndSignRecoveryTransaction(
 	params *chaincfg.Params,
 	wallet RecoveryWallet,
@@ -224,16 +304,56 @@ func CreateAndSignRecoveryTransaction(
 	amount int64,
 	feeRate float64,
 ) (*SignedMsg, error) {
-	tx, err := CreateTransaction(utxos, changeAddress, destination, amount, feeRate)
+	tx, err := createTransaction(utxos, changeAddress, []Recipient{{Address: destination, Amount: amount}}, feeRate,
+		RecoveryPathSpend, GetWalletConfig(wallet).Timelock)
+	if err != nil {
+		return nil, err
+	}
+	return SignRecoveryTransaction(params, wallet, tx)
+}
+
+// CreateAndSignRecoveryTransactionForAccount is CreateAndSignRecoveryTransaction for BIP-44 'account' of 'wallet';
+// see RecoveryWalletForAccount
+func CreateAndSignRecoveryTransactionForAccount(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	account uint32,
+	utxos []Utxo,
+	changeAddress btcutil.Address,
+	destination btcutil.Address,
+	amount int64,
+	feeRate float64,
+) (*SignedMsg, error) {
+	accountWallet, err := RecoveryWalletForAccount(params, wallet, account)
 	if err != nil {
 		return nil, err
 	}
+	return CreateAndSignRecoveryTransaction(params, accountWallet, utxos, changeAddress, destination, amount, feeRate)
+}
+
+// SignRecoveryTransaction signs each input of 'tx' via the timelock script path of its Leafy address.
+func SignRecoveryTransaction(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	tx *TransactionInfo,
+) (*SignedMsg, error) {
+	return SignRecoveryTransactionWithIndexer(params, wallet, tx, nil)
+}
+
+// SignRecoveryTransactionWithIndexer is like SignRecoveryTransaction but looks up the derivation index of each
+// input's address via 'indexer', as with SignTransactionWithIndexer.
+func SignRecoveryTransactionWithIndexer(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	tx *TransactionInfo,
+	indexer AddressIndexer,
+) (*SignedMsg, error) {
 	// add sequence for tapscript's timelock
 	msgTx := tx.MsgTx.Copy()
 	for _, txin := range msgTx.TxIn {
-		txin.Sequence = Timelock
+		txin.Sequence = GetWalletConfig(wallet).Timelock
 	}
-	signingKeys, err := findSigningRecoveryKeys(params, wallet, tx)
+	signingKeys, err := findSigningRecoveryKeys(params, wallet, tx, indexer)
 	if err != nil {
 		return nil, err
 	}
@@ -297,68 +417,52 @@ func CreateAndSignRecoveryTransaction(
 
 type signingRecoveryKeys struct {
 	privateKey    *btcec.PrivateKey
+	internalKey   *btcec.PublicKey
 	tapscriptData *TapscriptSigningData
+	derivation    AddressDerivation
 }
 
 func findSigningRecoveryKeys(
 	params *chaincfg.Params,
 	wallet RecoveryWallet,
 	transactionInfo *TransactionInfo,
+	indexer AddressIndexer,
 ) (map[string]*signingRecoveryKeys, error) {
-	firstKey, err := getBip44Key(wallet.GetFirstMnemonic(), params, 0)
-	if err != nil {
-		return nil, err
-	}
-	descriptor, err := wallet.GetSecondDescriptor(params)
-	if err != nil {
-		return nil, err
-	}
-	secondKey, err := ImportFromTaprootDescriptorForParentWithoutChecksum(descriptor, Path(0))
+	indexer, err := signingIndexer(params, wallet, transactionInfo, indexer)
 	if err != nil {
 		return nil, err
 	}
+	derivers := newAddressDerivers(params, wallet)
 	mapping := make(map[string]*signingRecoveryKeys, 0)
-	allMapped := false
-	// Leafy uses up to 1000 addresses
-outer:
-	for i := uint(0); i < 10; i++ {
-		for j := uint8(i * 100); j < uint8(i*100)+100; j++ {
-			firstPrivateKey, err := firstKey.GetPrivateKey()
-			if err != nil {
-				return nil, err
-			}
-			secondPublicKey, err := secondKey.GetPublicKey()
-			if err != nil {
-				return nil, err
-			}
-			address, _, _, tapscriptData, err := createTweakedAddressFromPublicKey(params, secondPublicKey, firstPrivateKey)
-			if err != nil {
-				return nil, err
-			}
-			mapping[address.EncodeAddress()] = &signingRecoveryKeys{
-				privateKey:    firstPrivateKey,
-				tapscriptData: tapscriptData,
-			}
-			secondKey, err = secondKey.DeriveNextSibling()
-			if err != nil {
-				return nil, err
-			}
-			firstKey, err = firstKey.DeriveNextSibling()
-			if err != nil {
-				return nil, err
-			}
+	for outpoint, script := range transactionInfo.outpointToScript {
+		derivation, found := transactionInfo.outpointToDerivation[outpoint]
+		if !found {
+			derivation, found = indexer.IndexOf(script)
 		}
-		for _, value := range transactionInfo.outpointToAddr {
-			_, found := mapping[value]
-			if !found {
-				continue outer
-			}
+		if !found {
+			return nil, fmt.Errorf("failed to find signing keys for inputted address %s", transactionInfo.outpointToAddr[outpoint])
+		}
+		deriver, err := derivers.forDerivation(derivation)
+		if err != nil {
+			return nil, err
+		}
+		firstPrivateKey, secondPublicKey, err := deriver.keysAt(derivation.Index)
+		if err != nil {
+			return nil, err
+		}
+		address, internalKey, _, tapscriptData, err := createTweakedAddressFromPublicKey(params, GetWalletConfig(wallet).Timelock, secondPublicKey, firstPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkIndexedScript(address, script, derivation); err != nil {
+			return nil, err
+		}
+		mapping[address.EncodeAddress()] = &signingRecoveryKeys{
+			privateKey:    firstPrivateKey,
+			internalKey:   internalKey,
+			tapscriptData: tapscriptData,
+			derivation:    derivation,
 		}
-		allMapped = true
-		break outer
-	}
-	if !allMapped {
-		return nil, fmt.Errorf("failed to find signing keys for inputted addresses")
 	}
 	return mapping, nil
 }
@@ -373,6 +477,8 @@ type TransactionInfo struct {
 	outpointToAddr   map[string]string
 	outpointToAmt    map[string]int64
 	outpointToScript map[string][]byte
+	// outpointToDerivation is the derivation of those inputs whose Utxo carried a DerivationIndex
+	outpointToDerivation map[string]AddressDerivation
 }
 
 type SignedMsg struct {
@@ -394,16 +500,129 @@ func GenerateMnemonic() (string, error) {
 	return bip39.NewMnemonic(seed)
 }
 
-// GetDescriptor returns a descriptor for the BIP-32 derivation used by Leafy for mnemonic
+// GetDescriptor returns a descriptor for the BIP-32 derivation used by Leafy for mnemonic. It is a multipath
+// descriptor covering both the ExternalChain and InternalChain, so that change can be recovered from it.
 func GetDescriptor(
 	params *chaincfg.Params,
 	mnemonic string,
 ) (string, error) {
-	bip44Key, err := getBip44Key(mnemonic, params, 0)
+	return GetDescriptorForAccount(params, mnemonic, 0)
+}
+
+// GetDescriptorForAccount is GetDescriptor for BIP-44 'account'
+func GetDescriptorForAccount(
+	params *chaincfg.Params,
+	mnemonic string,
+	account uint32,
+) (string, error) {
+	bip44Key, err := getBip44AccountKey(mnemonic, params, defaultAccountPath(params, account), ExternalChain, 0)
 	if err != nil {
 		return "", err
 	}
-	return bip44Key.GetTaprootParentDescriptorWithoutChecksum(""), nil
+	return bip44Key.GetTaprootAccountDescriptorWithoutChecksum()
+}
+
+// GetDescriptorWithChecksum is GetDescriptor with a BIP-380 checksum, as expected by Bitcoin Core and Sparrow
+func GetDescriptorWithChecksum(
+	params *chaincfg.Params,
+	mnemonic string,
+) (string, error) {
+	return GetDescriptorWithChecksumForAccount(params, mnemonic, 0)
+}
+
+// GetDescriptorWithChecksumForAccount is GetDescriptorWithChecksum for BIP-44 'account'
+func GetDescriptorWithChecksumForAccount(
+	params *chaincfg.Params,
+	mnemonic string,
+	account uint32,
+) (string, error) {
+	bip44Key, err := getBip44AccountKey(mnemonic, params, defaultAccountPath(params, account), ExternalChain, 0)
+	if err != nil {
+		return "", err
+	}
+	return bip44Key.GetTaprootAccountDescriptor()
+}
+
+// GetAccountDescriptor returns a BIP-389 multipath descriptor of the first BIP-44 account of mnemonic, covering both
+// its ExternalChain and InternalChain addresses
+func GetAccountDescriptor(
+	params *chaincfg.Params,
+	mnemonic string,
+) (string, error) {
+	return GetAccountDescriptorForAccount(params, mnemonic, 0)
+}
+
+// GetAccountDescriptorForAccount is GetAccountDescriptor for BIP-44 'account'
+func GetAccountDescriptorForAccount(
+	params *chaincfg.Params,
+	mnemonic string,
+	account uint32,
+) (string, error) {
+	bip44Key, err := getBip44AccountKey(mnemonic, params, defaultAccountPath(params, account), ExternalChain, 0)
+	if err != nil {
+		return "", err
+	}
+	return bip44Key.GetTaprootAccountDescriptor()
+}
+
+// GetSingleSeedAddresses returns 'num' key path only addresses, see GetTaprootAddress, of the keys of 'mnemonic'
+// alone from 'startIndex' of 'chain', derived as configured by 'config'. With WalletConfig.Bip86 these are BIP-86
+// addresses, and so funds sent to them can be swept or recovered by any BIP-86 wallet importing
+// GetSingleSeedDescriptor.
+func GetSingleSeedAddresses(
+	params *chaincfg.Params,
+	mnemonic string,
+	config *WalletConfig,
+	chain uint32,
+	startIndex uint32,
+	num uint8,
+) ([]string, error) {
+	if num < 1 {
+		return nil, fmt.Errorf("invalid amount of addresses [%d], must be greater than 0", num)
+	}
+	if uint64(startIndex)+uint64(num) > hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("exhausted address indices at %d", startIndex)
+	}
+	key, err := getBip44AccountKey(mnemonic, params, config.accountPath(params, config.LegacyCoinType), chain, 0)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, num)
+	for i := range addresses {
+		indexKey, err := key.DeriveSibling(Path(startIndex + uint32(i)))
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := indexKey.GetPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		address, err := GetTaprootAddress(publicKey, params)
+		if err != nil {
+			return nil, err
+		}
+		addresses[i] = address.EncodeAddress()
+	}
+	return addresses, nil
+}
+
+// GetSingleSeedDescriptor returns the multipath descriptor of the addresses of GetSingleSeedAddresses, with the
+// private key if 'includePrivate'. Leafy's master key is of the mnemonic's entropy, not its BIP-39 seed, so another
+// wallet must import this descriptor rather than the mnemonic.
+func GetSingleSeedDescriptor(
+	params *chaincfg.Params,
+	mnemonic string,
+	config *WalletConfig,
+	includePrivate bool,
+) (string, error) {
+	key, err := getBip44AccountKey(mnemonic, params, config.accountPath(params, config.LegacyCoinType), ExternalChain, 0)
+	if err != nil {
+		return "", err
+	}
+	if includePrivate {
+		return key.GetTaprootAccountPrivateDescriptor()
+	}
+	return key.GetTaprootAccountDescriptor()
 }
 
 type SocialKeyPair struct {
@@ -513,11 +732,40 @@ func CreateTransaction(
 	destAddr btcutil.Address,
 	amount int64,
 	feeRate float64,
+) (*TransactionInfo, error) {
+	return createTransaction(utxos, changeAddr, []Recipient{{Address: destAddr, Amount: amount}}, feeRate, KeyPathSpend,
+		0)
+}
+
+// CreateRecoveryTransaction is like CreateTransaction but fees are estimated for spending the 'utxos' via the
+// timelock script path, see SignRecoveryTransaction, of the DefaultWalletConfig's timelock.
+func CreateRecoveryTransaction(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	destAddr btcutil.Address,
+	amount int64,
+	feeRate float64,
+) (*TransactionInfo, error) {
+	return createTransaction(utxos, changeAddr, []Recipient{{Address: destAddr, Amount: amount}}, feeRate,
+		RecoveryPathSpend, 0)
+}
+
+// createTransaction selects 'utxos' in order until the 'recipients' and the fee (estimated from the final witness
+// shape of 'path' and, for the recovery path, 'timelock', including any change output) are covered. If change would be dust, further 'utxos' are added,
+// when available, to alleviate the dusting. If a recipient is "send max" then all 'utxos' are spent and there is
+// no change.
+func createTransaction(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	recipients []Recipient,
+	feeRate float64,
+	path SpendPath,
+	timelock uint32,
 ) (*TransactionInfo, error) {
 	if feeRate <= 0 {
 		return nil, fmt.Errorf("invalid fee rate; should be >= 0")
 	}
-	outputScript, err := txscript.PayToAddrScript(destAddr)
+	outputs, maxIndex, amount, err := recipientOutputs(recipients)
 	if err != nil {
 		return nil, err
 	}
@@ -525,142 +773,235 @@ func CreateTransaction(
 	if err != nil {
 		return nil, err
 	}
-	outpointToAddr := make(map[string]string, 0)
-	outpointToAmt := make(map[string]int64, 0)
-	outpointToScript := make(map[string][]byte, 0)
-	msgTx := &wire.MsgTx{
-		Version:  2,
-		LockTime: 0,
-		TxIn:     []*wire.TxIn{},
-		TxOut: []*wire.TxOut{
-			{
-				Value:    amount,
-				PkScript: outputScript,
-			},
-		},
-	}
-	spendAll := amount == 0
-	matchedUtxos := make([]Utxo, 0)
-	unmatchedUtxos := make([]Utxo, 0)
+	spendAll := maxIndex >= 0
 	var matchedAmount int64 = 0
 	var unmatchedAmount int64 = 0
+	matched := 0
 	for _, utxo := range utxos {
 		if !spendAll && matchedAmount >= amount {
 			unmatchedAmount += utxo.Amount
-			unmatchedUtxos = append(unmatchedUtxos, utxo)
 		} else {
 			matchedAmount += utxo.Amount
-			matchedUtxos = append(matchedUtxos, utxo)
+			matched++
 		}
 	}
 	if matchedAmount < amount {
 		return nil, fmt.Errorf("insufficient funds; need %d have %d", amount, matchedAmount)
 	}
-	for _, matchedUtxo := range matchedUtxos {
-		blankWitness := make([][]byte, 1)
-		blankSig := make([]byte, 64)
-		blankWitness[0] = blankSig
-		msgTx.TxIn = append(msgTx.TxIn, &wire.TxIn{
-			PreviousOutPoint: matchedUtxo.Outpoint,
-			Sequence:         0,
-			Witness:          blankWitness,
-		})
-		outpointToAddr[matchedUtxo.Outpoint.String()] = matchedUtxo.FromAddress
-		outpointToAmt[matchedUtxo.Outpoint.String()] = matchedUtxo.Amount
-		decodedScript, err := matchedUtxo.DecodeScript()
+	estimator := &WeightEstimator{Timelock: timelock}
+	for _, output := range outputs {
+		estimator.AddOutput(output.PkScript)
+	}
+	for i := 0; i < matched; i++ {
+		estimator.AddLeafyInput(path)
+	}
+	// add inputs until the fee (which grows with each input) converges
+	for {
+		feeNeeded := estimator.Fee(feeRate)
+		if spendAll {
+			maxAmount := matchedAmount - amount - feeNeeded
+			if maxAmount <= 0 {
+				return nil, fmt.Errorf("insufficient funds to account for fees; need %d have %d", amount+feeNeeded, matchedAmount)
+			}
+			outputs[maxIndex].Value = maxAmount
+			return newTransactionInfo(utxos[:matched], outputs, feeNeeded, 0, path, timelock)
+		}
+		excess := matchedAmount - amount - feeNeeded
+		if excess < 0 && unmatchedAmount == 0 {
+			return nil, fmt.Errorf("insufficient funds to account for fees; need %d have %d remaining", -excess, unmatchedAmount)
+		}
+		withChange := *estimator
+		withChange.AddOutput(changeScript)
+		change := matchedAmount - amount - withChange.Fee(feeRate)
+		// add another input if the fee is not yet covered or, when there is change, if the change is dust
+		if excess < 0 || (excess > 0 && change <= P2trDustAmt && unmatchedAmount > 0) {
+			unmatchedAmount -= utxos[matched].Amount
+			matchedAmount += utxos[matched].Amount
+			matched++
+			estimator.AddLeafyInput(path)
+			continue
+		}
+		if change <= 0 {
+			// the change cannot pay for its own output, leave the excess to the fee
+			return newTransactionInfo(utxos[:matched], outputs, feeNeeded+excess, 0, path, timelock)
+		}
+		outputs = append(outputs, &wire.TxOut{Value: change, PkScript: changeScript})
+		return newTransactionInfo(utxos[:matched], outputs, matchedAmount-amount-change, change, path, timelock)
+	}
+}
+
+// CreateTransactionWithCoinSelector is like CreateTransaction but the 'utxos' spent are chosen by 'selector'. Change
+// below the viable amount of the selection is added to the fees rather than creating a dust output. A nil 'selector'
+// or a zero 'amount' (i.e. spend all) is delegated to CreateTransaction.
+func CreateTransactionWithCoinSelector(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	destAddr btcutil.Address,
+	amount int64,
+	feeRate float64,
+	selector CoinSelector,
+) (*TransactionInfo, error) {
+	return createTransactionWithCoinSelector(utxos, changeAddr, []Recipient{{Address: destAddr, Amount: amount}}, feeRate,
+		selector, KeyPathSpend, 0)
+}
+
+// CreateRecoveryTransactionWithCoinSelector is like CreateTransactionWithCoinSelector but fees are estimated for
+// spending the 'utxos' via the timelock script path. A nil 'selector' or a zero 'amount' is delegated to
+// CreateRecoveryTransaction.
+func CreateRecoveryTransactionWithCoinSelector(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	destAddr btcutil.Address,
+	amount int64,
+	feeRate float64,
+	selector CoinSelector,
+) (*TransactionInfo, error) {
+	return createTransactionWithCoinSelector(utxos, changeAddr, []Recipient{{Address: destAddr, Amount: amount}}, feeRate,
+		selector, RecoveryPathSpend, 0)
+}
+
+func createTransactionWithCoinSelector(
+	utxos []Utxo,
+	changeAddr btcutil.Address,
+	recipients []Recipient,
+	feeRate float64,
+	selector CoinSelector,
+	path SpendPath,
+	timelock uint32,
+) (*TransactionInfo, error) {
+	if selector == nil || hasSendMaxRecipient(recipients) {
+		return createTransaction(utxos, changeAddr, recipients, feeRate, path, timelock)
+	}
+	if feeRate <= 0 {
+		return nil, fmt.Errorf("invalid fee rate; should be >= 0")
+	}
+	outputs, _, amount, err := recipientOutputs(recipients)
+	if err != nil {
+		return nil, err
+	}
+	changeScript, err := txscript.PayToAddrScript(changeAddr)
+	if err != nil {
+		return nil, err
+	}
+	var outputsWeight int64
+	for _, output := range outputs {
+		outputsWeight += outputWeight(output.PkScript)
+	}
+	request := NewCoinSelectionRequest(amount, feeRate, outputsWeight)
+	request.InputWeight = leafyInputWeight(path, timelock)
+	request.ChangeOutputWeight = outputWeight(changeScript)
+	selection, err := selector.Select(utxos, request)
+	if err != nil {
+		return nil, err
+	}
+	if selection.Change > 0 {
+		outputs = append(outputs, &wire.TxOut{Value: selection.Change, PkScript: changeScript})
+	}
+	return newTransactionInfo(selection.Utxos, outputs, selection.Fee, selection.Change, path, timelock)
+}
+
+// newTransactionInfo creates a TransactionInfo spending 'inputs' to 'outputs'. Each input has a placeholder witness
+// of the final shape of 'path' (and 'timelock') so that the unsigned transaction has the weight of the signed one.
+func newTransactionInfo(
+	inputs []Utxo,
+	outputs []*wire.TxOut,
+	fee int64,
+	change int64,
+	path SpendPath,
+	timelock uint32,
+) (*TransactionInfo, error) {
+	outpointToAddr := make(map[string]string, len(inputs))
+	outpointToAmt := make(map[string]int64, len(inputs))
+	outpointToScript := make(map[string][]byte, len(inputs))
+	outpointToDerivation := make(map[string]AddressDerivation, len(inputs))
+	msgTx := &wire.MsgTx{
+		Version:  2,
+		LockTime: 0,
+		TxIn:     make([]*wire.TxIn, 0, len(inputs)),
+		TxOut:    outputs,
+	}
+	var inputAmount int64
+	for _, input := range inputs {
+		decodedScript, err := input.DecodeScript()
 		if err != nil {
 			return nil, err
 		}
-		outpointToScript[matchedUtxo.Outpoint.String()] = decodedScript
-	}
-	// TODO - the weight is pre fee-inputs and change-output; should a placeholder be used?
-	weight := blockchain.GetTransactionWeight(btcutil.NewTx(msgTx))
-	vSize := (weight + (blockchain.WitnessScaleFactor - 1)) / blockchain.WitnessScaleFactor
-	feeNeeded := int64(math.Ceil(feeRate * float64(vSize)))
-	feePaid := feeNeeded
-	change := matchedAmount - amount
-	if spendAll {
-		change = 0
-		msgTx.TxOut[0].Value = matchedAmount - feeNeeded
-	} else {
-		if feeNeeded > change {
-			feeNeeded -= change
-			if feeNeeded > unmatchedAmount {
-				return nil, fmt.Errorf("insufficient funds to account for fees; need %d have %d remaining", feeNeeded, unmatchedAmount)
-			}
-			var matchedFeeAmount int64 = 0
-			for _, utxo := range unmatchedUtxos {
-				blankWitness := make([][]byte, 1)
-				blankSig := make([]byte, 64)
-				blankWitness[0] = blankSig
-				matchedFeeAmount += utxo.Amount
-				matchedAmount += utxo.Amount
-				unmatchedAmount -= utxo.Amount
-				msgTx.TxIn = append(msgTx.TxIn, &wire.TxIn{
-					PreviousOutPoint: utxo.Outpoint,
-					Sequence:         0,
-					Witness:          blankWitness,
-				})
-				outpointToAddr[utxo.Outpoint.String()] = utxo.FromAddress
-				outpointToAmt[utxo.Outpoint.String()] = utxo.Amount
-				decodedScript, err := utxo.DecodeScript()
-				if err != nil {
-					return nil, err
-				}
-				outpointToScript[utxo.Outpoint.String()] = decodedScript
-				if matchedFeeAmount >= feeNeeded {
-					break
-				}
-			}
-			change = matchedFeeAmount - feeNeeded
-		} else {
-			change -= feeNeeded
-		}
-	}
-	if change > 0 {
-		// if change is under the dust amount but there are more inputs, try to add more
-		// to alleviate the dusting
-		index := 0
-		for change <= P2trDustAmt && unmatchedAmount > 0 {
-			change += unmatchedUtxos[index].Amount
-			unmatchedAmount -= unmatchedUtxos[index].Amount
-			matchedAmount += unmatchedUtxos[index].Amount
-			msgTx.TxIn = append(msgTx.TxIn, &wire.TxIn{
-				PreviousOutPoint: unmatchedUtxos[index].Outpoint,
-				Sequence:         0,
-			})
-			outpointToAddr[unmatchedUtxos[index].Outpoint.String()] = unmatchedUtxos[index].FromAddress
-			outpointToAmt[unmatchedUtxos[index].Outpoint.String()] = unmatchedUtxos[index].Amount
-			decodedScript, err := unmatchedUtxos[index].DecodeScript()
-			if err != nil {
-				return nil, err
+		if input.SpendPath != nil && *input.SpendPath != path {
+			return nil, fmt.Errorf("utxo %s must be spent via the %s path but was via the %s path",
+				input.Outpoint.String(), input.SpendPath, path)
+		}
+		if input.DerivationIndex != nil {
+			outpointToDerivation[input.Outpoint.String()] = AddressDerivation{
+				Chain: input.DerivationChain,
+				Index: *input.DerivationIndex,
 			}
-			outpointToScript[unmatchedUtxos[index].Outpoint.String()] = decodedScript
-			index += 1
 		}
-		msgTx.TxOut = append(msgTx.TxOut, &wire.TxOut{
-			Value:    change,
-			PkScript: changeScript,
+		msgTx.TxIn = append(msgTx.TxIn, &wire.TxIn{
+			PreviousOutPoint: input.Outpoint,
+			Sequence:         0,
+			Witness:          placeholderWitness(path, timelock),
 		})
+		outpointToAddr[input.Outpoint.String()] = input.FromAddress
+		outpointToAmt[input.Outpoint.String()] = input.Amount
+		outpointToScript[input.Outpoint.String()] = decodedScript
+		inputAmount += input.Amount
 	}
 	buf := bytes.NewBuffer(make([]byte, 0, msgTx.SerializeSize()))
-	if err = msgTx.Serialize(buf); err != nil {
+	if err := msgTx.Serialize(buf); err != nil {
 		return nil, err
 	}
-	msgHex := hex.EncodeToString(buf.Bytes())
 	return &TransactionInfo{
-		Hex:              msgHex,
-		MsgTx:            msgTx,
-		TxInputAmt:       matchedAmount,
-		TxFeeAmt:         feePaid,
-		TxChangeAmt:      change,
-		outpointToAddr:   outpointToAddr,
-		outpointToAmt:    outpointToAmt,
-		outpointToScript: outpointToScript,
+		Hex:                  hex.EncodeToString(buf.Bytes()),
+		MsgTx:                msgTx,
+		TxInputAmt:           inputAmount,
+		TxDestAmt:            inputAmount - fee - change,
+		TxFeeAmt:             fee,
+		TxChangeAmt:          change,
+		outpointToAddr:       outpointToAddr,
+		outpointToAmt:        outpointToAmt,
+		outpointToScript:     outpointToScript,
+		outpointToDerivation: outpointToDerivation,
 	}, nil
 }
 
 func getBip44Key(mnemonic string, params *chaincfg.Params, startIndex uint32) (*Bip44Key, error) {
+	return getBip44AccountKey(mnemonic, params, defaultAccountPath(params, 0), ExternalChain, startIndex)
+}
+
+// accountPath is the purpose, coin type and account, each hardened, of a wallet's keys
+type accountPath struct {
+	purpose  uint32
+	coinType uint32
+	account  uint32
+}
+
+// defaultAccountPath is the accountPath of 'account' of a wallet with the default purpose, PurposeBip44
+func defaultAccountPath(params *chaincfg.Params, account uint32) accountPath {
+	return accountPath{purpose: PurposeBip44, coinType: params.HDCoinType, account: account}
+}
+
+// legacyCoinType is the BIP-44 coin type of every network's addresses before WalletConfig.LegacyCoinType
+const legacyCoinType uint32 = 0
+
+// coinType is the BIP-44 coin type of 'params', per SLIP-44, or legacyCoinType if 'legacy'
+func coinType(params *chaincfg.Params, legacy bool) uint32 {
+	if legacy {
+		return legacyCoinType
+	}
+	return params.HDCoinType
+}
+
+// getBip44AccountKey returns the key of purpose'/coinType'/account'/chain/startIndex of 'mnemonic'
+func getBip44AccountKey(
+	mnemonic string,
+	params *chaincfg.Params,
+	path accountPath,
+	chain uint32,
+	startIndex uint32,
+) (*Bip44Key, error) {
+	if err := ValidateAccount(path.account); err != nil {
+		return nil, err
+	}
 	seed, err := bip39.EntropyFromMnemonic(mnemonic)
 	if err != nil {
 		return nil, err
@@ -669,14 +1010,15 @@ func getBip44Key(mnemonic string, params *chaincfg.Params, startIndex uint32) (*
 	if err != nil {
 		return nil, err
 	}
-	// conventionally, Leafy will use 44'/0'/0'/0/x with incrementing x for addresses
+	// conventionally, Leafy will use 44'/0'/0'/0/x with incrementing x for addresses (and 44'/0'/0'/1/x for change)
 	// the use of bip-44 is not necessary but provides a standard structure of addresses
-	// within Leafy.
+	// within Leafy. Wallets segregating funds use further accounts, 44'/0'/account'/..., and test networks the
+	// SLIP-44 coin type 1', 44'/1'/... Wallets may also use the BIP-86 purpose, 86'/0'/0'/...
 	bip44Key, err := CreateBip44Key(master,
-		PathHardened(44),
-		PathHardened(0),
-		PathHardened(0),
-		Path(0),
+		PathHardened(path.purpose),
+		PathHardened(path.coinType),
+		PathHardened(path.account),
+		Path(chain),
 		Path(startIndex))
 	if err != nil {
 		return nil, err
@@ -691,6 +1033,7 @@ func computeHashRaw(data []byte) []byte {
 
 func createTweakedAddress(
 	params *chaincfg.Params,
+	timelock uint32,
 	secondKey *btcec.PrivateKey,
 	firstKey *btcec.PrivateKey,
 ) (btcutil.Address, *btcec.PublicKey, *btcec.PrivateKey, []byte, *TapscriptSigningData, error) {
@@ -698,7 +1041,7 @@ func createTweakedAddress(
 	tweakedPrivateKey := txscript.TweakTaprootPrivKey(*secondKey, hash)
 	tweakedPublicKey := tweakedPrivateKey.PubKey()
 
-	addr, internalKey, merkleRoot, tapscriptData, err := createTweakedAddressFromTweakedPublicKey(params, tweakedPublicKey, firstKey)
+	addr, internalKey, merkleRoot, tapscriptData, err := createTweakedAddressFromTweakedPublicKey(params, timelock, tweakedPublicKey, firstKey)
 	if err != nil {
 		return nil, nil, nil, nil, nil, err
 	}
@@ -707,20 +1050,22 @@ func createTweakedAddress(
 
 func createTweakedAddressFromPublicKey(
 	params *chaincfg.Params,
+	timelock uint32,
 	secondPublicKey *btcec.PublicKey,
 	firstKey *btcec.PrivateKey,
 ) (btcutil.Address, *btcec.PublicKey, []byte, *TapscriptSigningData, error) {
 	hash := computeHashRaw(firstKey.Serialize())
 	tweakedPublicKey := txscript.ComputeTaprootOutputKey(secondPublicKey, hash)
-	return createTweakedAddressFromTweakedPublicKey(params, tweakedPublicKey, firstKey)
+	return createTweakedAddressFromTweakedPublicKey(params, timelock, tweakedPublicKey, firstKey)
 }
 
 func createTweakedAddressFromTweakedPublicKey(
 	params *chaincfg.Params,
+	timelock uint32,
 	tweakedPublicKey *btcec.PublicKey,
 	firstKey *btcec.PrivateKey,
 ) (btcutil.Address, *btcec.PublicKey, []byte, *TapscriptSigningData, error) {
-	builder, err := scriptTweakBuilder(params, tweakedPublicKey, firstKey.PubKey())
+	builder, err := scriptTweakBuilder(params, timelock, tweakedPublicKey, firstKey.PubKey())
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
@@ -739,10 +1084,11 @@ func createTweakedAddressFromTweakedPublicKey(
 
 func scriptTweakBuilder(
 	params *chaincfg.Params,
+	timelock uint32,
 	internalKey *btcec.PublicKey,
 	firstPublicKey *btcec.PublicKey,
 ) (*TapscriptBuilder, error) {
-	timelockKeyScript, err := CreateTapscriptTimelockFromKey(params, int64(Timelock), firstPublicKey)
+	timelockKeyScript, err := CreateTapscriptTimelockFromKey(params, int64(timelock), firstPublicKey)
 	if err != nil {
 		return nil, err
 	}
@@ -33,8 +33,8 @@ func TestGetAddresses(t *testing.T) {
 	addresses, err := leafy.GetAddresses(params, wallet, 0, 2)
 	require.NoError(t, err)
 	require.Equal(t, 2, len(addresses))
-	require.Equal(t, "bcrt1pfncurwja7y8d628x85vua4zlcjm08w6mgkt4uyk0xadm739ku72shr4wzp", addresses[0])
-	require.Equal(t, "bcrt1pe3r5e5ey3masltdr6yc7deczhv3dnlhzeduz80qsq7htld4ywyyqn3u8jm", addresses[1])
+	require.Equal(t, "bcrt1pvm90xmzzt5m7m793hpfdd55nucyhyjsjf48f05an0rye3eaevcksxd86wu", addresses[0])
+	require.Equal(t, "bcrt1pxsmf6gqxputfsyzp50uwuuq0e04u69rwxa5jy0zza0ftjf5gahzqxty4q9", addresses[1])
 
 	descriptor, err := leafy.GetDescriptor(params, seedMnemonic)
 	require.NoError(t, err)
@@ -42,8 +42,263 @@ func TestGetAddresses(t *testing.T) {
 	addresses, err = leafy.GetAddresses(params, recoveryWallet, 0, 2)
 	require.NoError(t, err)
 	require.Equal(t, 2, len(addresses))
-	require.Equal(t, "bcrt1pfncurwja7y8d628x85vua4zlcjm08w6mgkt4uyk0xadm739ku72shr4wzp", addresses[0])
-	require.Equal(t, "bcrt1pe3r5e5ey3masltdr6yc7deczhv3dnlhzeduz80qsq7htld4ywyyqn3u8jm", addresses[1])
+	require.Equal(t, "bcrt1pvm90xmzzt5m7m793hpfdd55nucyhyjsjf48f05an0rye3eaevcksxd86wu", addresses[0])
+	require.Equal(t, "bcrt1pxsmf6gqxputfsyzp50uwuuq0e04u69rwxa5jy0zza0ftjf5gahzqxty4q9", addresses[1])
+}
+
+func TestLegacyCoinType(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	require.EqualValues(t, 1, leafy.GetWalletConfig(wallet).CoinType(params))
+	require.EqualValues(t, 0, leafy.GetWalletConfig(wallet).CoinType(&chaincfg.MainNetParams))
+	descriptor, err := leafy.GetDescriptor(params, seedMnemonic)
+	require.NoError(t, err)
+	require.Contains(t, descriptor, "/44'/1'/0']")
+	require.Contains(t, descriptor, "/<0;1>/*)")
+	mainnetDescriptor, err := leafy.GetDescriptor(&chaincfg.MainNetParams, seedMnemonic)
+	require.NoError(t, err)
+	require.Contains(t, mainnetDescriptor, "/44'/0'/0']")
+
+	// the addresses of wallets created before coin types were derived from the network
+	legacyWallet, err := leafy.LegacyCoinTypeWallet(wallet)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, leafy.GetWalletConfig(legacyWallet).CoinType(params))
+	legacyAddresses, err := leafy.GetAddresses(params, legacyWallet, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, "bcrt1pfncurwja7y8d628x85vua4zlcjm08w6mgkt4uyk0xadm739ku72shr4wzp", legacyAddresses[0])
+	require.Equal(t, "bcrt1pe3r5e5ey3masltdr6yc7deczhv3dnlhzeduz80qsq7htld4ywyyqn3u8jm", legacyAddresses[1])
+	legacyDescriptor, err := legacyWallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	require.Contains(t, legacyDescriptor, "/44'/0'/0']")
+	// a recovery wallet of a legacy second descriptor is legacy
+	addresses, err := leafy.GetAddresses(params, leafy.NewRecoveryWallet(seedMnemonic, legacyDescriptor), 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, legacyAddresses, addresses)
+	// but a legacy recovery wallet of a second descriptor of the network's coin type is not
+	legacyRecoveryWallet, err := leafy.NewRecoveryWalletWithConfig(seedMnemonic, descriptor,
+		&leafy.WalletConfig{Timelock: leafy.DefaultTimelock, LegacyCoinType: true})
+	require.NoError(t, err)
+	_, err = leafy.GetAddresses(params, legacyRecoveryWallet, 0, 2)
+	require.Error(t, err)
+
+	// funds of the legacy coin type can still be signed for
+	utxos, destAddress := createWalletUtxos(t, params, legacyWallet, 10000, 20000)
+	signed, err := leafy.CreateAndSignTransaction(params, wallet, utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	signed, err = leafy.CreateAndSignRecoveryTransaction(params, leafy.NewRecoveryWallet(seedMnemonic, legacyDescriptor),
+		utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	packet, err := tx.ToPsbt(params, wallet)
+	require.NoError(t, err)
+	require.NoError(t, leafy.SignPsbt(params, wallet, packet))
+	finalized, err := leafy.FinalizePsbt(packet)
+	require.NoError(t, err)
+	requireValidWitnesses(t, finalized.Msg, utxos)
+
+	// and discovered, for migration
+	used := map[string]bool{legacyAddresses[1]: true}
+	lookup := leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		history := make([]bool, len(scripts))
+		for i, script := range scripts {
+			_, scriptAddresses, _, err := txscript.ExtractPkScriptAddrs(script, params)
+			require.NoError(t, err)
+			history[i] = used[scriptAddresses[0].EncodeAddress()]
+		}
+		return history, nil
+	})
+	discovery, err := leafy.DiscoverLegacyCoinType(params, wallet, leafy.DefaultGapLimit, lookup)
+	require.NoError(t, err)
+	require.True(t, discovery.Used())
+	require.True(t, discovery.External.Legacy)
+	require.EqualValues(t, 1, discovery.External.HighestUsedIndex)
+	require.False(t, discovery.Internal.Used)
+	require.True(t, leafy.GetWalletConfig(discovery.Wallet).LegacyCoinType)
+	found, ok := discovery.External.IndexOf(addressScript(t, params, legacyAddresses[1]))
+	require.True(t, ok)
+	require.Equal(t, leafy.AddressDerivation{Chain: leafy.ExternalChain, Index: 1, Legacy: true}, found)
+	_, err = leafy.DiscoverLegacyCoinType(&chaincfg.MainNetParams, wallet, leafy.DefaultGapLimit, lookup)
+	require.Error(t, err)
+}
+
+// externalWallet is a RecoveryWallet implemented outside of leafy, without a WalletConfig
+type externalWallet struct {
+	leafy.RecoveryWallet
+}
+
+func TestWalletConfigTimelock(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	for _, invalid := range []uint32{0, 65536, 1 << 22} {
+		_, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic, &leafy.WalletConfig{Timelock: invalid})
+		require.Error(t, err)
+		_, err = leafy.NewRecoveryWalletWithConfig(seedMnemonic, "", &leafy.WalletConfig{Timelock: invalid})
+		require.Error(t, err)
+	}
+	require.NoError(t, leafy.ValidateTimelock(1))
+	require.NoError(t, leafy.ValidateTimelock(65535))
+	require.EqualValues(t, leafy.DefaultTimelock, leafy.GetWalletConfig(leafy.NewWallet(seedMnemonic, seedMnemonic)).Timelock)
+	require.Equal(t, leafy.DefaultWalletConfig(), leafy.GetWalletConfig(externalWallet{leafy.NewWallet(seedMnemonic, seedMnemonic)}))
+
+	// wallets with different timelocks, in the same process, have different addresses
+	defaultAddresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 2)
+	require.NoError(t, err)
+	wallet, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic, &leafy.WalletConfig{Timelock: 144})
+	require.NoError(t, err)
+	addresses, err := leafy.GetAddresses(params, wallet, 0, 2)
+	require.NoError(t, err)
+	require.NotEqual(t, defaultAddresses, addresses)
+
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	recoveryWallet, err := leafy.NewRecoveryWalletWithConfig(seedMnemonic, descriptor, leafy.GetWalletConfig(wallet))
+	require.NoError(t, err)
+	recoveryAddresses, err := leafy.GetAddresses(params, recoveryWallet, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, addresses, recoveryAddresses)
+
+	utxos, destAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+	signed, err := leafy.CreateAndSignTransaction(params, wallet, utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	signed, err = leafy.CreateAndSignRecoveryTransaction(params, recoveryWallet, utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	for _, txin := range signed.Msg.TxIn {
+		require.EqualValues(t, 144, txin.Sequence)
+	}
+	requireValidWitnesses(t, signed.Msg, utxos)
+
+	// the default timelock wallet cannot sign for the addresses
+	_, err = leafy.CreateAndSignTransaction(params, leafy.NewWallet(seedMnemonic, seedMnemonic), utxos, destAddress,
+		destAddress, 15000, 2)
+	require.Error(t, err)
+}
+
+func TestWalletAccounts(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	_, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic,
+		&leafy.WalletConfig{Timelock: leafy.DefaultTimelock, Account: 1 << 31})
+	require.Error(t, err)
+	_, err = leafy.GetDescriptorForAccount(params, seedMnemonic, 1<<31)
+	require.Error(t, err)
+
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	defaultAddresses, err := leafy.GetAddresses(params, wallet, 0, 2)
+	require.NoError(t, err)
+	addresses, err := leafy.GetAddressesForAccount(params, wallet, 0, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, defaultAddresses, addresses)
+	descriptor, err := leafy.GetDescriptorForAccount(params, seedMnemonic, 0)
+	require.NoError(t, err)
+	defaultDescriptor, err := leafy.GetDescriptor(params, seedMnemonic)
+	require.NoError(t, err)
+	require.Equal(t, defaultDescriptor, descriptor)
+
+	// each account has its own addresses and descriptor
+	accountAddresses, err := leafy.GetAddressesForAccount(params, wallet, 2, 0, 2)
+	require.NoError(t, err)
+	require.NotEqual(t, defaultAddresses, accountAddresses)
+	accountDescriptor, err := leafy.GetDescriptorForAccount(params, seedMnemonic, 2)
+	require.NoError(t, err)
+	require.Contains(t, accountDescriptor, "/44'/1'/2']")
+	checksummed, err := leafy.GetDescriptorWithChecksumForAccount(params, seedMnemonic, 2)
+	require.NoError(t, err)
+	stripped, err := leafy.StripDescriptorChecksum(checksummed)
+	require.NoError(t, err)
+	require.Equal(t, accountDescriptor, stripped)
+	multipath, err := leafy.GetAccountDescriptorForAccount(params, seedMnemonic, 2)
+	require.NoError(t, err)
+	require.Contains(t, multipath, "/44'/1'/2']")
+	accountWallet, err := leafy.WalletForAccount(wallet, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, leafy.GetWalletConfig(accountWallet).Account)
+	require.EqualValues(t, 0, leafy.GetWalletConfig(wallet).Account)
+	secondDescriptor, err := accountWallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	require.Equal(t, accountDescriptor, secondDescriptor)
+
+	// a recovery wallet requires the second descriptor of the account
+	recoveryWallet := leafy.NewRecoveryWallet(seedMnemonic, accountDescriptor)
+	recoveryAddresses, err := leafy.GetAddressesForAccount(params, recoveryWallet, 2, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, accountAddresses, recoveryAddresses)
+	_, err = leafy.GetAddresses(params, recoveryWallet, 0, 2)
+	require.Error(t, err)
+	_, err = leafy.GetAddressesForAccount(params, leafy.NewRecoveryWallet(seedMnemonic, defaultDescriptor), 2, 0, 2)
+	require.Error(t, err)
+	multipathWallet := leafy.NewRecoveryWallet(seedMnemonic, multipath)
+	recoveryAddresses, err = leafy.GetAddressesForAccount(params, multipathWallet, 2, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, accountAddresses, recoveryAddresses)
+
+	utxos, destAddress := createWalletUtxos(t, params, accountWallet, 10000, 20000)
+	signed, err := leafy.CreateAndSignTransactionForAccount(params, wallet, 2, utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	signed, err = leafy.CreateAndSignRecoveryTransactionForAccount(params, recoveryWallet, 2, utxos, destAddress,
+		destAddress, 15000, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	// of another account
+	_, err = leafy.CreateAndSignTransactionForAccount(params, wallet, 1, utxos, destAddress, destAddress, 15000, 2)
+	require.Error(t, err)
+}
+
+func TestBip86Wallet(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	config := &leafy.WalletConfig{Timelock: leafy.DefaultTimelock, Bip86: true}
+	require.EqualValues(t, leafy.PurposeBip86, config.Purpose())
+	require.EqualValues(t, leafy.PurposeBip44, leafy.DefaultWalletConfig().Purpose())
+	wallet, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic, config)
+	require.NoError(t, err)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	require.Contains(t, descriptor, "/86'/1'/0']")
+	addresses, err := leafy.GetAddresses(params, wallet, 0, 2)
+	require.NoError(t, err)
+	defaultAddresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 2)
+	require.NoError(t, err)
+	require.NotEqual(t, defaultAddresses, addresses)
+
+	// the recovery wallet must be of the same purpose
+	recoveryWallet, err := leafy.NewRecoveryWalletWithConfig(seedMnemonic, descriptor, config)
+	require.NoError(t, err)
+	recoveryAddresses, err := leafy.GetAddresses(params, recoveryWallet, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, addresses, recoveryAddresses)
+	_, err = leafy.GetAddresses(params, leafy.NewRecoveryWallet(seedMnemonic, descriptor), 0, 2)
+	require.Error(t, err)
+
+	utxos, destAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+	signed, err := leafy.CreateAndSignTransaction(params, wallet, utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	signed, err = leafy.CreateAndSignRecoveryTransaction(params, recoveryWallet, utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+
+	// the single seed addresses are those of the single seed descriptor
+	singleAddresses, err := leafy.GetSingleSeedAddresses(params, seedMnemonic, config, leafy.InternalChain, 3, 2)
+	require.NoError(t, err)
+	singleDescriptor, err := leafy.GetSingleSeedDescriptor(params, seedMnemonic, config, false)
+	require.NoError(t, err)
+	require.Contains(t, singleDescriptor, "/86'/1'/0']")
+	for i, address := range singleAddresses {
+		key, err := leafy.ImportFromTaprootDescriptorForChain(singleDescriptor, leafy.InternalChain, leafy.Path(3+uint32(i)))
+		require.NoError(t, err)
+		publicKey, err := key.GetPublicKey()
+		require.NoError(t, err)
+		expected, err := leafy.GetTaprootAddress(publicKey, params)
+		require.NoError(t, err)
+		require.Equal(t, expected.EncodeAddress(), address)
+	}
+	privateDescriptor, err := leafy.GetSingleSeedDescriptor(params, seedMnemonic, config, true)
+	require.NoError(t, err)
+	require.Contains(t, privateDescriptor, "/86'/1'/0']tprv")
+	_, err = leafy.GetSingleSeedAddresses(params, seedMnemonic, config, leafy.ExternalChain, 0, 0)
+	require.Error(t, err)
 }
 
 func TestCreateAndSignTransaction(t *testing.T) {
@@ -107,10 +362,11 @@ func TestCreateAndSignTransaction(t *testing.T) {
 }
 
 func TestCreateAndSignRecoveryTransaction(t *testing.T) {
-	leafy.Timelock = 10
-	wallet, txs, bitcoind, fundingKey, _ := setupWallet(t)
+	defaultWallet, txs, bitcoind, fundingKey, _ := setupWallet(t)
 	defer bitcoind.Cleanup()
-	defer func() { leafy.Timelock = leafy.DefaultTimelock }()
+	config := &leafy.WalletConfig{Timelock: 10}
+	wallet, err := leafy.NewWalletWithConfig(defaultWallet.GetFirstMnemonic(), defaultWallet.GetSecondMnemonic(), config)
+	require.NoError(t, err)
 
 	params := &chaincfg.RegressionNetParams
 	addresses, err := leafy.GetAddresses(params, wallet, 1, 4)
@@ -170,7 +426,7 @@ func TestCreateAndSignRecoveryTransaction(t *testing.T) {
 	require.True(t, strings.Contains(err.Error(), "-26: non-BIP68-final"))
 
 	// advance up to timelock
-	_, _, err = bitcoind.GetClient().MineToWalletFromImportedKeys(int64(leafy.Timelock - 2))
+	_, _, err = bitcoind.GetClient().MineToWalletFromImportedKeys(int64(config.Timelock - 2))
 	require.NoError(t, err)
 	_, err = bitcoind.GetClient().RpcClient.SendRawTransaction(signedMsg.Msg, false)
 	require.Error(t, err)
@@ -236,8 +492,8 @@ func TestCreateTransaction(t *testing.T) {
 	require.EqualValues(t, 2, len(tx.MsgTx.TxIn))
 	require.EqualValues(t, 2, len(tx.MsgTx.TxOut))
 	require.EqualValues(t, int64(1100), tx.TxInputAmt)
-	require.EqualValues(t, int64(111), tx.TxFeeAmt)
-	require.EqualValues(t, int64(889), tx.TxChangeAmt)
+	require.EqualValues(t, int64(212), tx.TxFeeAmt)
+	require.EqualValues(t, int64(788), tx.TxChangeAmt)
 	require.False(t, tx.IsChangeDust())
 
 	// exact match of amount and fees, i.e. no change [selection of utxo is first match, put exact match first]
@@ -314,14 +570,14 @@ func TestCreateTransaction(t *testing.T) {
 		},
 		Amount: 1000,
 	})
-	tx, err = leafy.CreateTransaction(utxos, addr, addr, 601, 1)
+	tx, err = leafy.CreateTransaction(utxos, addr, addr, 558, 1)
 	require.NoError(t, err)
 	require.NotNil(t, tx.Hex)
 	require.NotNil(t, tx.MsgTx)
 	require.EqualValues(t, 2, len(tx.MsgTx.TxIn))
 	require.EqualValues(t, 2, len(tx.MsgTx.TxOut))
 	require.EqualValues(t, int64(1100), tx.TxInputAmt)
-	require.EqualValues(t, int64(169), tx.TxFeeAmt) // 931
+	require.EqualValues(t, int64(212), tx.TxFeeAmt)
 	require.EqualValues(t, int64(330), tx.TxChangeAmt)
 	require.True(t, tx.IsChangeDust())
 	// under dust amount
@@ -332,8 +588,8 @@ func TestCreateTransaction(t *testing.T) {
 	require.EqualValues(t, 2, len(tx.MsgTx.TxIn))
 	require.EqualValues(t, 2, len(tx.MsgTx.TxOut))
 	require.EqualValues(t, int64(1100), tx.TxInputAmt)
-	require.EqualValues(t, int64(169), tx.TxFeeAmt) // 931
-	require.EqualValues(t, int64(231), tx.TxChangeAmt)
+	require.EqualValues(t, int64(212), tx.TxFeeAmt)
+	require.EqualValues(t, int64(188), tx.TxChangeAmt)
 	require.True(t, tx.IsChangeDust())
 	// dust but one more input alleviates
 	utxos = append(utxos, leafy.Utxo{
@@ -350,8 +606,8 @@ func TestCreateTransaction(t *testing.T) {
 	require.EqualValues(t, 3, len(tx.MsgTx.TxIn))
 	require.EqualValues(t, 2, len(tx.MsgTx.TxOut))
 	require.EqualValues(t, int64(1500), tx.TxInputAmt)
-	require.EqualValues(t, int64(169), tx.TxFeeAmt) // 931
-	require.EqualValues(t, int64(631), tx.TxChangeAmt)
+	require.EqualValues(t, int64(269), tx.TxFeeAmt)
+	require.EqualValues(t, int64(531), tx.TxChangeAmt)
 	require.False(t, tx.IsChangeDust())
 	// dust but more inputs needed to alleviate
 	utxos = make([]leafy.Utxo, 0)
@@ -383,15 +639,15 @@ func TestCreateTransaction(t *testing.T) {
 		},
 		Amount: 200,
 	})
-	tx, err = leafy.CreateTransaction(utxos, addr, addr, 850, 1)
+	tx, err = leafy.CreateTransaction(utxos, addr, addr, 840, 1)
 	require.NoError(t, err)
 	require.NotNil(t, tx.Hex)
 	require.NotNil(t, tx.MsgTx)
 	require.EqualValues(t, 4, len(tx.MsgTx.TxIn))
 	require.EqualValues(t, 2, len(tx.MsgTx.TxOut))
 	require.EqualValues(t, int64(1500), tx.TxInputAmt)
-	require.EqualValues(t, int64(169), tx.TxFeeAmt) // 931
-	require.EqualValues(t, int64(481), tx.TxChangeAmt)
+	require.EqualValues(t, int64(327), tx.TxFeeAmt)
+	require.EqualValues(t, int64(333), tx.TxChangeAmt)
 	require.False(t, tx.IsChangeDust())
 	// dust, add more inputs but still dust
 	utxos = make([]leafy.Utxo, 0)
@@ -414,14 +670,14 @@ func TestCreateTransaction(t *testing.T) {
 			Hash:  chainhash.DoubleHashH([]byte("foo bar")),
 			Index: 2,
 		},
-		Amount: 20,
+		Amount: 100,
 	})
 	utxos = append(utxos, leafy.Utxo{
 		Outpoint: wire.OutPoint{
 			Hash:  chainhash.DoubleHashH([]byte("foo bar")),
 			Index: 3,
 		},
-		Amount: 20,
+		Amount: 100,
 	})
 	tx, err = leafy.CreateTransaction(utxos, addr, addr, 850, 1)
 	require.NoError(t, err)
@@ -429,9 +685,9 @@ func TestCreateTransaction(t *testing.T) {
 	require.NotNil(t, tx.MsgTx)
 	require.EqualValues(t, 4, len(tx.MsgTx.TxIn))
 	require.EqualValues(t, 2, len(tx.MsgTx.TxOut))
-	require.EqualValues(t, int64(1140), tx.TxInputAmt)
-	require.EqualValues(t, int64(169), tx.TxFeeAmt) // 931
-	require.EqualValues(t, int64(121), tx.TxChangeAmt)
+	require.EqualValues(t, int64(1300), tx.TxInputAmt)
+	require.EqualValues(t, int64(327), tx.TxFeeAmt)
+	require.EqualValues(t, int64(123), tx.TxChangeAmt)
 	require.True(t, tx.IsChangeDust())
 }
 
@@ -0,0 +1,135 @@
+package leafy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// DefaultLivelinessThreshold is the number of blocks, about a month, before a utxo's recovery path matures within
+// which CreateLivelinessTransaction refreshes it; leaving time to bump the fee of the liveliness update if needed
+const DefaultLivelinessThreshold = 4320
+
+var ErrNoExpiringUtxos = errors.New("no utxos are within the liveliness threshold")
+
+// LivelinessOptions configures CreateLivelinessTransaction; the zero value of each field is its default
+type LivelinessOptions struct {
+	// Threshold is the number of blocks before maturity within which utxos are refreshed, DefaultLivelinessThreshold
+	// if zero. Mature utxos are always refreshed and a Threshold of the wallet's timelock refreshes every utxo.
+	Threshold uint32
+	// Outputs is the number of fresh addresses across which the refreshed funds are split, 1 if zero
+	Outputs uint8
+	// GapLimit is that of the discovery of the next unused addresses, DefaultGapLimit if zero
+	GapLimit uint32
+}
+
+// LivelinessTransaction is a signed liveliness update; see CreateLivelinessTransaction
+type LivelinessTransaction struct {
+	Signed *SignedMsg
+	// Refreshed are the utxos spent
+	Refreshed []Utxo
+	// Chain and Indices are the derivation of the addresses of the outputs, in order; the next unused index of Chain
+	// is the last of Indices plus one once the transaction is broadcast
+	Chain   uint32
+	Indices []uint32
+	// Fee is the fee, in sats, paid by the transaction
+	Fee int64
+}
+
+// CreateLivelinessTransaction creates a liveliness update of 'wallet', i.e. a transaction moving those of 'utxos'
+// whose recovery path matures within the options' Threshold of the best block at 'tipHeight' (see RecoveryMaturity)
+// to fresh addresses, restarting their timelock. The fresh addresses are the next unused ExternalChain addresses, which
+// every second descriptor covers, as discovered via 'lookup', and the funds less the fee (at 'feeRate' sat/vByte) are
+// split evenly across them. The transaction is signed via the key path. It returns ErrNoExpiringUtxos if no utxo is within the threshold.
+func CreateLivelinessTransaction(
+	params *chaincfg.Params,
+	wallet Wallet,
+	utxos []Utxo,
+	tipHeight int64,
+	lookup HistoryLookup,
+	feeRate float64,
+	options *LivelinessOptions,
+) (*LivelinessTransaction, error) {
+	threshold, outputs, gapLimit := uint32(DefaultLivelinessThreshold), uint8(1), uint32(DefaultGapLimit)
+	if options != nil {
+		if options.Threshold > 0 {
+			threshold = options.Threshold
+		}
+		if options.Outputs > 0 {
+			outputs = options.Outputs
+		}
+		if options.GapLimit > 0 {
+			gapLimit = options.GapLimit
+		}
+	}
+	if feeRate <= 0 {
+		return nil, fmt.Errorf("invalid fee rate; should be >= 0")
+	}
+	var refreshed []Utxo
+	var total int64
+	for _, maturity := range RecoveryMaturities(utxos, GetWalletConfig(wallet).Timelock, tipHeight) {
+		if maturity.BlocksRemaining <= int64(threshold) {
+			refreshed = append(refreshed, maturity.Utxo)
+			total += maturity.Utxo.Amount
+		}
+	}
+	if len(refreshed) == 0 {
+		return nil, ErrNoExpiringUtxos
+	}
+	discovery, err := DiscoverChainAddresses(params, wallet, ExternalChain, gapLimit, lookup)
+	if err != nil {
+		return nil, err
+	}
+	startIndex := discovery.NextUnusedIndex()
+	addresses, err := GetChainAddresses(params, wallet, ExternalChain, startIndex, outputs)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]Recipient, len(addresses))
+	indices := make([]uint32, len(addresses))
+	estimator := &WeightEstimator{}
+	for range refreshed {
+		estimator.AddLeafyInput(KeyPathSpend)
+	}
+	for i, address := range addresses {
+		decoded, err := btcutil.DecodeAddress(address, params)
+		if err != nil {
+			return nil, err
+		}
+		script, err := txscript.PayToAddrScript(decoded)
+		if err != nil {
+			return nil, err
+		}
+		estimator.AddOutput(script)
+		recipients[i] = Recipient{Address: decoded}
+		indices[i] = startIndex + uint32(i)
+	}
+	// all but the last output receive an even share; the last is "send max" and so absorbs the remainder and any
+	// difference between the estimated and the actual fee
+	share := (total - estimator.Fee(feeRate)) / int64(outputs)
+	if share <= 0 {
+		return nil, fmt.Errorf("insufficient funds; %d sats of %d utxos cannot pay the fee at %v sat/vByte",
+			total, len(refreshed), feeRate)
+	}
+	for i := 0; i < len(recipients)-1; i++ {
+		recipients[i].Amount = share
+	}
+	lastAddress := recipients[len(recipients)-1].Address
+	signed, err := CreateAndSignBatchTransaction(params, wallet, refreshed, lastAddress, recipients, feeRate, nil)
+	if err != nil {
+		return nil, err
+	}
+	var paid int64
+	for _, txOut := range signed.Msg.TxOut {
+		paid += txOut.Value
+	}
+	return &LivelinessTransaction{
+		Signed:    signed,
+		Refreshed: refreshed,
+		Chain:     ExternalChain,
+		Indices:   indices,
+		Fee:       total - paid,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package leafy_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestCreateLivelinessTransaction(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic, &leafy.WalletConfig{Timelock: 1000})
+	require.NoError(t, err)
+	external, err := leafy.GetAddresses(params, wallet, 0, 8)
+	require.NoError(t, err)
+	used := map[string]bool{}
+	for _, address := range external[:5] {
+		used[address] = true
+	}
+	lookup := leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		history := make([]bool, len(scripts))
+		for i, script := range scripts {
+			_, scriptAddresses, _, err := txscript.ExtractPkScriptAddrs(script, params)
+			require.NoError(t, err)
+			history[i] = used[scriptAddresses[0].EncodeAddress()]
+		}
+		return history, nil
+	})
+
+	// as of the tip at 1999: mature, maturing in 99 and 599 blocks, unconfirmed and long mature
+	heights := []int64{1000, 1099, 1599, 0, 500}
+	utxos := make([]leafy.Utxo, len(heights))
+	for i, height := range heights {
+		utxos[i] = indexedUtxo(t, params, wallet, uint32(i), 100_000)
+		utxos[i].BlockHeight = height
+	}
+
+	liveliness, err := leafy.CreateLivelinessTransaction(params, wallet, utxos, 1999, lookup, 2,
+		&leafy.LivelinessOptions{Threshold: 100})
+	require.NoError(t, err)
+	require.Equal(t, []leafy.Utxo{utxos[0], utxos[1], utxos[4]}, liveliness.Refreshed)
+	require.Equal(t, leafy.ExternalChain, liveliness.Chain)
+	require.Equal(t, []uint32{5}, liveliness.Indices)
+	msgTx := liveliness.Signed.Msg
+	require.Len(t, msgTx.TxIn, 3)
+	require.Len(t, msgTx.TxOut, 1)
+	require.Equal(t, addressScript(t, params, external[5]), msgTx.TxOut[0].PkScript)
+	require.Equal(t, int64(300_000)-liveliness.Fee, msgTx.TxOut[0].Value)
+	require.Greater(t, liveliness.Fee, int64(0))
+	for _, txIn := range msgTx.TxIn {
+		require.Len(t, txIn.Witness, 1)
+	}
+	requireValidWitnesses(t, msgTx, liveliness.Refreshed)
+
+	// split across outputs; the timelock refreshes every utxo, including those unconfirmed
+	liveliness, err = leafy.CreateLivelinessTransaction(params, wallet, utxos, 1999, lookup, 2,
+		&leafy.LivelinessOptions{Threshold: 1000, Outputs: 3})
+	require.NoError(t, err)
+	require.Equal(t, utxos, liveliness.Refreshed)
+	require.Equal(t, []uint32{5, 6, 7}, liveliness.Indices)
+	msgTx = liveliness.Signed.Msg
+	require.Len(t, msgTx.TxOut, 3)
+	var paid int64
+	for i, txOut := range msgTx.TxOut {
+		require.Equal(t, addressScript(t, params, external[5+i]), txOut.PkScript)
+		require.InDelta(t, msgTx.TxOut[0].Value, txOut.Value, 5)
+		paid += txOut.Value
+	}
+	require.Equal(t, int64(500_000)-liveliness.Fee, paid)
+	requireValidWitnesses(t, msgTx, liveliness.Refreshed)
+	serialized, err := json.Marshal(liveliness)
+	require.NoError(t, err)
+	require.Contains(t, string(serialized), `"Indices":[5,6,7]`)
+
+	// the default threshold of about a month
+	liveliness, err = leafy.CreateLivelinessTransaction(params, wallet, utxos[1:3], 1999, lookup, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, utxos[1:3], liveliness.Refreshed)
+
+	_, err = leafy.CreateLivelinessTransaction(params, wallet, utxos[1:4], 1000, lookup, 2,
+		&leafy.LivelinessOptions{Threshold: 10})
+	require.ErrorIs(t, err, leafy.ErrNoExpiringUtxos)
+	_, err = leafy.CreateLivelinessTransaction(params, wallet, utxos, 1999, lookup, 0, nil)
+	require.Error(t, err)
+	// funds too little to split without dust
+	_, err = leafy.CreateLivelinessTransaction(params, wallet, utxos[:1], 1999, lookup, 2,
+		&leafy.LivelinessOptions{Threshold: 100, Outputs: 250})
+	require.Error(t, err)
+}
+
+func TestCreateLivelinessTransactionDestinations(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	utxo := chainUtxo(t, params, wallet, leafy.InternalChain, 7, 50_000)
+	utxo.BlockHeight = 100
+	lookup := leafy.HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		return make([]bool, len(scripts)), nil
+	})
+	liveliness, err := leafy.CreateLivelinessTransaction(params, wallet, []leafy.Utxo{utxo},
+		100+leafy.DefaultTimelock, lookup, 1, nil)
+	require.NoError(t, err)
+	// no history found, so the first external address
+	require.Equal(t, []uint32{0}, liveliness.Indices)
+	external, err := leafy.GetAddresses(params, wallet, 0, 1)
+	require.NoError(t, err)
+	msgTx := liveliness.Signed.Msg
+	require.Equal(t, addressScript(t, params, external[0]), msgTx.TxOut[0].PkScript)
+	requireValidWitnesses(t, msgTx, liveliness.Refreshed)
+
+	// the refreshed output is recoverable from the backup, exported before or since multipath descriptors
+	refreshed := []leafy.Utxo{{
+		FromAddress: external[0],
+		Outpoint:    wire.OutPoint{Hash: msgTx.TxHash(), Index: 0},
+		Amount:      msgTx.TxOut[0].Value,
+		Script:      hex.EncodeToString(msgTx.TxOut[0].PkScript),
+	}}
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	for _, backup := range []string{descriptor, externalChainDescriptor(t, descriptor)} {
+		recoveryWallet := leafy.NewRecoveryWallet(seedMnemonic, backup)
+		destination, err := btcutil.DecodeAddress(external[0], params)
+		require.NoError(t, err)
+		signed, err := leafy.CreateAndSignRecoveryTransaction(params, recoveryWallet, refreshed, destination,
+			destination, 0, 2)
+		require.NoError(t, err)
+		requireValidWitnesses(t, signed.Msg, refreshed)
+	}
+}
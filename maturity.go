@@ -0,0 +1,98 @@
+package leafy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"time"
+)
+
+var ErrNoMatureUtxos = errors.New("no utxos are mature for recovery")
+
+// UtxoMaturity is the progress of a utxo's recovery path towards spendability, i.e. of its relative timelock
+// (BIP-68) since the utxo confirmed
+type UtxoMaturity struct {
+	Utxo Utxo
+	// MatureHeight is the height of the first block which may include a recovery transaction spending the utxo, zero
+	// if the utxo is unconfirmed (or its height unknown)
+	MatureHeight int64 `json:",omitempty"`
+	// BlocksRemaining is the number of blocks to be mined before the utxo is Mature; the entire timelock if unconfirmed
+	BlocksRemaining int64
+	// Remaining approximates the time until BlocksRemaining are mined; see TimelockToApproximateDuration
+	Remaining time.Duration
+	// Mature is whether a recovery transaction spending the utxo is valid in the next block
+	Mature bool
+}
+
+// RecoveryMaturity returns the maturity of 'utxo', per its BlockHeight, for recovery with 'timelock' as of the
+// best block at 'tipHeight'
+func RecoveryMaturity(utxo Utxo, timelock uint32, tipHeight int64) UtxoMaturity {
+	maturity := UtxoMaturity{Utxo: utxo, BlocksRemaining: int64(timelock)}
+	if utxo.BlockHeight > 0 {
+		maturity.MatureHeight = utxo.BlockHeight + int64(timelock)
+		maturity.BlocksRemaining = max(0, maturity.MatureHeight-(tipHeight+1))
+		maturity.Mature = maturity.BlocksRemaining == 0
+	}
+	maturity.Remaining = TimelockToApproximateDuration(maturity.BlocksRemaining)
+	return maturity
+}
+
+// RecoveryMaturities returns the RecoveryMaturity of each of 'utxos', in order
+func RecoveryMaturities(utxos []Utxo, timelock uint32, tipHeight int64) []UtxoMaturity {
+	maturities := make([]UtxoMaturity, len(utxos))
+	for i, utxo := range utxos {
+		maturities[i] = RecoveryMaturity(utxo, timelock, tipHeight)
+	}
+	return maturities
+}
+
+// MatureRecoveryUtxos returns those of 'utxos', in order, which are Mature for recovery with 'timelock' as of the best
+// block at 'tipHeight'
+func MatureRecoveryUtxos(utxos []Utxo, timelock uint32, tipHeight int64) []Utxo {
+	var mature []Utxo
+	for _, utxo := range utxos {
+		if RecoveryMaturity(utxo, timelock, tipHeight).Mature {
+			mature = append(mature, utxo)
+		}
+	}
+	return mature
+}
+
+// CreateAndSignMatureRecoveryTransaction is CreateAndSignRecoveryTransaction of only those of 'utxos' which are
+// mature for the recovery path of 'wallet' as of the best block at 'tipHeight'; see MatureRecoveryUtxos. It returns
+// ErrNoMatureUtxos if none are.
+func CreateAndSignMatureRecoveryTransaction(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	utxos []Utxo,
+	tipHeight int64,
+	changeAddress btcutil.Address,
+	destination btcutil.Address,
+	amount int64,
+	feeRate float64,
+) (*SignedMsg, error) {
+	mature, err := matureRecoveryUtxos(utxos, GetWalletConfig(wallet).Timelock, tipHeight)
+	if err != nil {
+		return nil, err
+	}
+	return CreateAndSignRecoveryTransaction(params, wallet, mature, changeAddress, destination, amount, feeRate)
+}
+
+// matureRecoveryUtxos is MatureRecoveryUtxos returning ErrNoMatureUtxos, along with when the first utxo matures, if
+// none are
+func matureRecoveryUtxos(utxos []Utxo, timelock uint32, tipHeight int64) ([]Utxo, error) {
+	mature := MatureRecoveryUtxos(utxos, timelock, tipHeight)
+	if len(mature) > 0 {
+		return mature, nil
+	}
+	if len(utxos) == 0 {
+		return nil, ErrNoMatureUtxos
+	}
+	soonest := int64(timelock)
+	for _, maturity := range RecoveryMaturities(utxos, timelock, tipHeight) {
+		soonest = min(soonest, maturity.BlocksRemaining)
+	}
+	return nil, fmt.Errorf("%w; the first matures in %d blocks (~%v)", ErrNoMatureUtxos, soonest,
+		TimelockToApproximateDuration(soonest))
+}
@@ -0,0 +1,96 @@
+package leafy_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+	"time"
+)
+
+func TestRecoveryMaturity(t *testing.T) {
+	utxo := leafy.Utxo{Amount: 1000, BlockHeight: 100}
+
+	// the recovery transaction is valid in a block 'timelock' blocks after that of the utxo
+	maturity := leafy.RecoveryMaturity(utxo, 10, 100)
+	require.Equal(t, leafy.UtxoMaturity{Utxo: utxo, MatureHeight: 110, BlocksRemaining: 9,
+		Remaining: 90 * time.Minute}, maturity)
+	maturity = leafy.RecoveryMaturity(utxo, 10, 108)
+	require.Equal(t, int64(1), maturity.BlocksRemaining)
+	require.False(t, maturity.Mature)
+	maturity = leafy.RecoveryMaturity(utxo, 10, 109)
+	require.Equal(t, int64(0), maturity.BlocksRemaining)
+	require.Equal(t, time.Duration(0), maturity.Remaining)
+	require.True(t, maturity.Mature)
+	maturity = leafy.RecoveryMaturity(utxo, 10, 500)
+	require.Equal(t, int64(0), maturity.BlocksRemaining)
+	require.True(t, maturity.Mature)
+
+	// unconfirmed utxos are immature for the entire timelock
+	utxo.BlockHeight = 0
+	maturity = leafy.RecoveryMaturity(utxo, leafy.DefaultTimelock, 500)
+	require.Equal(t, leafy.UtxoMaturity{Utxo: utxo, BlocksRemaining: leafy.DefaultTimelock,
+		Remaining: leafy.TimelockToApproximateDuration(leafy.DefaultTimelock)}, maturity)
+}
+
+func TestMatureRecoveryUtxos(t *testing.T) {
+	utxos := []leafy.Utxo{
+		{Amount: 1, BlockHeight: 90},
+		{Amount: 2},
+		{Amount: 3, BlockHeight: 101},
+		{Amount: 4, BlockHeight: 95},
+	}
+	maturities := leafy.RecoveryMaturities(utxos, 10, 104)
+	require.Len(t, maturities, 4)
+	var remaining []int64
+	for i, maturity := range maturities {
+		require.Equal(t, utxos[i], maturity.Utxo)
+		remaining = append(remaining, maturity.BlocksRemaining)
+	}
+	require.Equal(t, []int64{0, 10, 6, 0}, remaining)
+	require.Equal(t, []leafy.Utxo{utxos[0], utxos[3]}, leafy.MatureRecoveryUtxos(utxos, 10, 104))
+	require.Empty(t, leafy.MatureRecoveryUtxos(utxos, 10, 50))
+}
+
+func TestCreateAndSignMatureRecoveryTransaction(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic, &leafy.WalletConfig{Timelock: 10})
+	require.NoError(t, err)
+	addresses, err := leafy.GetAddresses(params, wallet, 0, 3)
+	require.NoError(t, err)
+	change, err := btcutil.DecodeAddress(addresses[1], params)
+	require.NoError(t, err)
+	destination, err := btcutil.DecodeAddress(addresses[2], params)
+	require.NoError(t, err)
+	script := hex.EncodeToString(addressScript(t, params, addresses[0]))
+	utxos := make([]leafy.Utxo, 3)
+	for i, height := range []int64{100, 95, 0} {
+		utxos[i] = leafy.Utxo{FromAddress: addresses[0], Outpoint: wire.OutPoint{Hash: chainhash.Hash{byte(i + 1)}},
+			Amount: 50_000, Script: script, BlockHeight: height}
+	}
+
+	_, err = leafy.CreateAndSignMatureRecoveryTransaction(params, wallet, utxos, 100, change, destination, 10_000, 2)
+	require.True(t, errors.Is(err, leafy.ErrNoMatureUtxos))
+	require.ErrorContains(t, err, "the first matures in 4 blocks")
+	_, err = leafy.CreateAndSignMatureRecoveryTransaction(params, wallet, nil, 100, change, destination, 10_000, 2)
+	require.ErrorIs(t, err, leafy.ErrNoMatureUtxos)
+
+	signed, err := leafy.CreateAndSignMatureRecoveryTransaction(params, wallet, utxos, 104, change, destination, 10_000, 2)
+	require.NoError(t, err)
+	require.Len(t, signed.Msg.TxIn, 1)
+	require.Equal(t, utxos[1].Outpoint, signed.Msg.TxIn[0].PreviousOutPoint)
+	require.Equal(t, uint32(10), signed.Msg.TxIn[0].Sequence)
+	require.Len(t, signed.Msg.TxIn[0].Witness, 3)
+
+	// mature utxos insufficient for the amount are not supplemented by immature ones
+	_, err = leafy.CreateAndSignMatureRecoveryTransaction(params, wallet, utxos, 104, change, destination, 60_000, 2)
+	require.Error(t, err)
+	signed, err = leafy.CreateAndSignMatureRecoveryTransaction(params, wallet, utxos, 109, change, destination, 60_000, 2)
+	require.NoError(t, err)
+	require.Len(t, signed.Msg.TxIn, 2)
+}
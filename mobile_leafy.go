@@ -1,10 +1,16 @@
 package leafy
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
 	"math"
 	"strings"
 )
@@ -14,140 +20,972 @@ import (
 // MobileCreateNewWallet wraps calls to CreateNewWallet and returns the generated seed phrases and the associated second
 // seed phrase descriptor
 func MobileCreateNewWallet(networkName string) ([]byte, error) {
-	wallet, err := CreateNewWallet()
+	return MobileCreateNewWalletWithConfig(networkName, "")
+}
+
+// MobileCreateNewWalletWithConfig wraps calls to CreateNewWalletWithConfig where 'config' is a JSON serialization of
+// the WalletConfig, or empty for the DefaultWalletConfig. The other Mobile functions recreate wallets with the
+// DefaultWalletConfig, or the Account of their ForAccount variants, and so only the Account may differ from it.
+// The return type is a JSON serialization of the MobileWallet
+func MobileCreateNewWalletWithConfig(networkName string, config string) ([]byte, error) {
+	walletConfig := DefaultWalletConfig()
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), walletConfig); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+	if defaults := DefaultWalletConfig(); walletConfig.Timelock != defaults.Timelock || walletConfig.Bip86 ||
+		walletConfig.LegacyCoinType {
+		return nil, wrapError(fmt.Errorf("unsupported wallet config; only the Account may differ from the default"))
+	}
+	wallet, err := CreateNewWalletWithConfig(walletConfig)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	network, err := parseNetworkName(networkName)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+	descriptor, err := wallet.GetSecondDescriptor(network)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	mobileWallet := MobileWallet{
+		FirstMnemonic:    wallet.GetFirstMnemonic(),
+		SecondMnemonic:   wallet.GetSecondMnemonic(),
+		SecondDescriptor: descriptor,
+	}
+	serialized, err := json.Marshal(mobileWallet)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileGetAddresses wraps calls to GetAddresses to conform to gomobile type restrictions
+// The return type is a JSON serialization of the []string
+func MobileGetAddresses(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	startIndex int64,
+	num int64,
+) ([]byte, error) {
+	if startIndex < 0 || startIndex > math.MaxUint32 {
+		return nil, wrapError(fmt.Errorf("startIndex must be between [0, %d]", math.MaxUint32))
+	}
+	if num < 0 || num > math.MaxUint8 {
+		return nil, wrapError(fmt.Errorf("num must be between [0, %d]", math.MaxUint8))
+	}
+	startIndexUint32 := uint32(startIndex)
+	numUint8 := uint8(num)
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	addresses, err := GetAddresses(params, wallet, startIndexUint32, numUint8)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(addresses)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileGetAddressesForAccount wraps calls to GetAddressesForAccount to conform to gomobile type restrictions
+// The return type is a JSON serialization of the []string
+func MobileGetAddressesForAccount(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	account int64,
+	startIndex int64,
+	num int64,
+) ([]byte, error) {
+	if startIndex < 0 || startIndex > math.MaxUint32 {
+		return nil, wrapError(fmt.Errorf("startIndex must be between [0, %d]", math.MaxUint32))
+	}
+	if num < 0 || num > math.MaxUint8 {
+		return nil, wrapError(fmt.Errorf("num must be between [0, %d]", math.MaxUint8))
+	}
+	accountUint32, err := mobileAccount(account)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	addresses, err := GetAddressesForAccount(params, wallet, accountUint32, uint32(startIndex), uint8(num))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(addresses)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileGetDescriptorForAccount wraps calls to GetDescriptorForAccount to conform to gomobile type restrictions
+func MobileGetDescriptorForAccount(networkName string, mnemonic string, account int64) (string, error) {
+	accountUint32, err := mobileAccount(account)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	descriptor, err := GetDescriptorForAccount(params, mnemonic, accountUint32)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return descriptor, nil
+}
+
+// MobileGetWalletPolicy wraps calls to GetWalletPolicy to conform to gomobile type restrictions
+// The return type is a JSON serialization of the MobileWalletPolicy
+func MobileGetWalletPolicy(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	startIndex int64,
+	num int64,
+) ([]byte, error) {
+	return MobileGetChainWalletPolicy(networkName, firstMnemonic, secondDescriptor, int64(ExternalChain), startIndex,
+		num)
+}
+
+// MobileGetChainWalletPolicy wraps calls to GetChainWalletPolicy to conform to gomobile type restrictions. 'chain' is
+// ExternalChain or InternalChain.
+// The return type is a JSON serialization of the MobileWalletPolicy
+func MobileGetChainWalletPolicy(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	chain int64,
+	startIndex int64,
+	num int64,
+) ([]byte, error) {
+	if chain != int64(ExternalChain) && chain != int64(InternalChain) {
+		return nil, wrapError(fmt.Errorf("chain must be %d or %d", ExternalChain, InternalChain))
+	}
+	if startIndex < 0 || startIndex > math.MaxUint32 {
+		return nil, wrapError(fmt.Errorf("startIndex must be between [0, %d]", math.MaxUint32))
+	}
+	if num < 0 || num > math.MaxUint8 {
+		return nil, wrapError(fmt.Errorf("num must be between [0, %d]", math.MaxUint8))
+	}
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	policy, err := GetChainWalletPolicy(params, wallet, uint32(chain), uint32(startIndex), uint8(num))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	descriptors, err := policy.GetAddressDescriptors()
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(MobileWalletPolicy{
+		Policy:             policy,
+		AddressDescriptors: descriptors,
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileHistoryLookup is implemented by the mobile application to report whether 'address' has any transaction
+// history
+type MobileHistoryLookup interface {
+	HasHistory(address string) (bool, error)
+}
+
+// MobileDiscoverAddresses wraps calls to DiscoverAddresses to conform to gomobile type restrictions
+// The return type is a JSON serialization of the MobileDiscovery
+func MobileDiscoverAddresses(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	gapLimit int64,
+	lookup MobileHistoryLookup,
+) ([]byte, error) {
+	if gapLimit < 1 || gapLimit > math.MaxUint32 {
+		return nil, wrapError(fmt.Errorf("gapLimit must be between [1, %d]", math.MaxUint32))
+	}
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	result, err := DiscoverAddresses(params, wallet, uint32(gapLimit), mobileHistoryLookup(params, lookup))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(MobileDiscovery{
+		Used:             result.Used,
+		HighestUsedIndex: result.HighestUsedIndex,
+		NextUnusedIndex:  result.NextUnusedIndex(),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileSyncWallet wraps calls to WalletSync.Resync from the Esplora API at 'esploraURL' to conform to gomobile type
+// restrictions. 'checkpoint' is the JSON serialization of the Checkpoint of the prior snapshot or empty to sync from
+// scratch.
+// The return type is a JSON serialization of the WalletSnapshot
+func MobileSyncWallet(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	esploraURL string,
+	gapLimit int64,
+	checkpoint string,
+) ([]byte, error) {
+	if gapLimit < 1 || gapLimit > math.MaxUint32 {
+		return nil, wrapError(fmt.Errorf("gapLimit must be between [1, %d]", math.MaxUint32))
+	}
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	var syncCheckpoint *WalletSyncCheckpoint
+	if checkpoint != "" {
+		syncCheckpoint = &WalletSyncCheckpoint{}
+		if err = json.Unmarshal([]byte(checkpoint), syncCheckpoint); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	walletSync, err := NewWalletSync(params, wallet, NewEsploraClient(params, esploraURL), uint32(gapLimit))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	snapshot, err := walletSync.Resync(syncCheckpoint)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileNextUnusedChangeAddress wraps calls to NextUnusedChangeAddress to conform to gomobile type restrictions
+// The return type is a JSON serialization of the MobileChangeAddress
+func MobileNextUnusedChangeAddress(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	lookup MobileHistoryLookup,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	address, index, err := NextUnusedChangeAddress(params, wallet, mobileHistoryLookup(params, lookup))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(MobileChangeAddress{
+		Address: address.EncodeAddress(),
+		Index:   index,
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// mobileHistoryLookup adapts 'lookup' to a HistoryLookup
+func mobileHistoryLookup(params *chaincfg.Params, lookup MobileHistoryLookup) HistoryLookup {
+	return HistoryLookupFunc(func(scripts [][]byte) ([]bool, error) {
+		history := make([]bool, len(scripts))
+		for i, script := range scripts {
+			_, addresses, _, err := txscript.ExtractPkScriptAddrs(script, params)
+			if err != nil || len(addresses) != 1 {
+				return nil, fmt.Errorf("failed to extract address of script %x", script)
+			}
+			if history[i], err = lookup.HasHistory(addresses[0].EncodeAddress()); err != nil {
+				return nil, err
+			}
+		}
+		return history, nil
+	})
+}
+
+// MobileCreateTransaction wraps calls to CreateTransaction to conform to gomobile type restrictions
+// The return type is a JSON serialization of the MobileTransaction
+func MobileCreateTransaction(
+	networkName string,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+) ([]byte, error) {
+	return MobileCreateTransactionWithCoinSelection(networkName, utxos, changeAddrSerialized, destAddrSerialized,
+		amount, feeRate, "")
+}
+
+// MobileCreateTransactionWithCoinSelection wraps calls to CreateTransactionWithCoinSelector to conform to gomobile
+// type restrictions. The 'coinSelection' is the name of the CoinSelector (see GetCoinSelector)
+// The return type is a JSON serialization of the MobileTransaction
+func MobileCreateTransactionWithCoinSelection(
+	networkName string,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+	coinSelection string,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateTransaction(params, utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate,
+		coinSelection, KeyPathSpend)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serializeMobileTransaction(tx)
+}
+
+// MobileCreateRecoveryTransaction wraps calls to CreateRecoveryTransactionWithCoinSelector to conform to gomobile
+// type restrictions. The 'coinSelection' is the name of the CoinSelector (see GetCoinSelector)
+// The return type is a JSON serialization of the MobileTransaction
+func MobileCreateRecoveryTransaction(
+	networkName string,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+	coinSelection string,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateTransaction(params, utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate,
+		coinSelection, RecoveryPathSpend)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serializeMobileTransaction(tx)
+}
+
+func serializeMobileTransaction(tx *TransactionInfo) ([]byte, error) {
+	mobileTx := MobileTransaction{
+		Hex:          fmt.Sprintf("%x", tx.Hex),
+		TotalInput:   tx.TxInputAmt,
+		Amount:       tx.TxInputAmt - tx.TxFeeAmt - tx.TxChangeAmt,
+		Fees:         tx.TxFeeAmt,
+		Change:       tx.TxChangeAmt,
+		ChangeIsDust: tx.IsChangeDust(),
+	}
+	serialized, err := json.Marshal(mobileTx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileRecipient is the JSON form of a Recipient; an 'Amount' of zero is "send max"
+type MobileRecipient struct {
+	Address string
+	Amount  int64
+}
+
+// MobileCreateBatchTransaction wraps calls to CreateBatchTransaction (or CreateBatchRecoveryTransaction if
+// 'recovery' is true) to conform to gomobile type restrictions. The 'recipients' is a JSON serialization of
+// a list of MobileRecipient and 'coinSelection' is the name of the CoinSelector (see GetCoinSelector)
+// The return type is a JSON serialization of the MobileTransaction
+func MobileCreateBatchTransaction(
+	networkName string,
+	utxos string,
+	changeAddrSerialized string,
+	recipients string,
+	feeRate float64,
+	coinSelection string,
+	recovery bool,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	path := KeyPathSpend
+	if recovery {
+		path = RecoveryPathSpend
+	}
+	tx, err := mobileCreateBatchTransaction(params, utxos, changeAddrSerialized, recipients, feeRate, coinSelection,
+		path)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serializeMobileTransaction(tx)
+}
+
+// MobileCreateAndSignBatchTransaction wraps calls to CreateAndSignBatchTransaction to conform to gomobile type
+// restrictions. The 'recipients' is a JSON serialization of a list of MobileRecipient
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignBatchTransaction(
+	networkName string,
+	firstMnemonic string,
+	secondMnemonic string,
+	utxos string,
+	changeAddrSerialized string,
+	recipients string,
+	feeRate float64,
+	coinSelection string,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateBatchTransaction(params, utxos, changeAddrSerialized, recipients, feeRate, coinSelection,
+		KeyPathSpend)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewWallet(firstMnemonic, secondMnemonic)
+	info, err := SignTransaction(params, wallet, tx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(info)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileCreateAndSignBatchRecoveryTransaction wraps calls to CreateAndSignBatchRecoveryTransaction to conform to
+// gomobile type restrictions. The 'recipients' is a JSON serialization of a list of MobileRecipient
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignBatchRecoveryTransaction(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	utxos string,
+	changeAddrSerialized string,
+	recipients string,
+	feeRate float64,
+	coinSelection string,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateBatchTransaction(params, utxos, changeAddrSerialized, recipients, feeRate, coinSelection,
+		RecoveryPathSpend)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	info, err := SignRecoveryTransaction(params, wallet, tx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(info)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileCreateAndSignTransaction wraps calls to CreateAndSignTransaction to conform to gomobile type restrictions
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignTransaction(
+	networkName string,
+	firstMnemonic string,
+	secondMnemonic string,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+) ([]byte, error) {
+	return MobileCreateAndSignTransactionWithCoinSelection(networkName, firstMnemonic, secondMnemonic, utxos,
+		changeAddrSerialized, destAddrSerialized, amount, feeRate, "")
+}
+
+// MobileCreateAndSignTransactionWithCoinSelection wraps calls to CreateTransactionWithCoinSelector and
+// SignTransaction to conform to gomobile type restrictions
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignTransactionWithCoinSelection(
+	networkName string,
+	firstMnemonic string,
+	secondMnemonic string,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+	coinSelection string,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateTransaction(params, utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate,
+		coinSelection, KeyPathSpend)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewWallet(firstMnemonic, secondMnemonic)
+	info, err := SignTransaction(params, wallet, tx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(info)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileCreateAndSignRecoveryTransaction wraps calls to CreateAndSignRecoveryTransaction to conform to gomobile type restrictions
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignRecoveryTransaction(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+) ([]byte, error) {
+	return MobileCreateAndSignRecoveryTransactionWithCoinSelection(networkName, firstMnemonic, secondDescriptor,
+		utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate, "")
+}
+
+// MobileCreateAndSignRecoveryTransactionWithCoinSelection wraps calls to CreateRecoveryTransactionWithCoinSelector and
+// SignRecoveryTransaction to conform to gomobile type restrictions
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignRecoveryTransactionWithCoinSelection(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+	coinSelection string,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateTransaction(params, utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate,
+		coinSelection, RecoveryPathSpend)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	info, err := SignRecoveryTransaction(params, wallet, tx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(info)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileRecoveryMaturities wraps calls to RecoveryMaturities to conform to gomobile type restrictions. 'utxos' is
+// the JSON serialization of the utxos, whose BlockHeight is their confirmation height, and 'timelock' is that of the
+// wallet's recovery path.
+// The return type is a JSON serialization of the UtxoMaturity of each utxo
+func MobileRecoveryMaturities(utxos string, timelock int64, tipHeight int64) ([]byte, error) {
+	if timelock < 0 || timelock > math.MaxUint32 {
+		return nil, wrapError(fmt.Errorf("timelock must be between [0, %d]", math.MaxUint32))
+	}
+	if err := ValidateTimelock(uint32(timelock)); err != nil {
+		return nil, wrapError(err)
+	}
+	var utxosDeserialized []Utxo
+	if err := json.Unmarshal([]byte(utxos), &utxosDeserialized); err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(RecoveryMaturities(utxosDeserialized, uint32(timelock), tipHeight))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileCreateAndSignMatureRecoveryTransaction is MobileCreateAndSignRecoveryTransactionWithCoinSelection of only
+// those 'utxos' mature for recovery, with the wallet's 'timelock', as of the best block at 'tipHeight'; see
+// CreateAndSignMatureRecoveryTransaction
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignMatureRecoveryTransaction(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	utxos string,
+	timelock int64,
+	tipHeight int64,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+	coinSelection string,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	if timelock < 0 || timelock > math.MaxUint32 {
+		return nil, wrapError(fmt.Errorf("timelock must be between [0, %d]", math.MaxUint32))
+	}
+	config := DefaultWalletConfig()
+	config.Timelock = uint32(timelock)
+	wallet, err := NewRecoveryWalletWithConfig(firstMnemonic, secondDescriptor, config)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	var utxosDeserialized []Utxo
+	if err = json.Unmarshal([]byte(utxos), &utxosDeserialized); err != nil {
+		return nil, wrapError(err)
+	}
+	mature, err := matureRecoveryUtxos(utxosDeserialized, config.Timelock, tipHeight)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateTransactionFromUtxos(params, mature, changeAddrSerialized, destAddrSerialized, amount,
+		feeRate, coinSelection, RecoveryPathSpend, config.Timelock)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	info, err := SignRecoveryTransaction(params, wallet, tx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(info)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileCreateLivelinessTransaction wraps calls to CreateLivelinessTransaction to conform to gomobile type
+// restrictions. 'options' is the JSON serialization of the LivelinessOptions or empty for the defaults.
+// The return type is a JSON serialization of the LivelinessTransaction
+func MobileCreateLivelinessTransaction(
+	networkName string,
+	firstMnemonic string,
+	secondMnemonic string,
+	utxos string,
+	tipHeight int64,
+	feeRate float64,
+	options string,
+	lookup MobileHistoryLookup,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	var utxosDeserialized []Utxo
+	if err = json.Unmarshal([]byte(utxos), &utxosDeserialized); err != nil {
+		return nil, wrapError(err)
+	}
+	var livelinessOptions *LivelinessOptions
+	if options != "" {
+		livelinessOptions = &LivelinessOptions{}
+		if err = json.Unmarshal([]byte(options), livelinessOptions); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+	wallet := NewWallet(firstMnemonic, secondMnemonic)
+	liveliness, err := CreateLivelinessTransaction(params, wallet, utxosDeserialized, tipHeight,
+		mobileHistoryLookup(params, lookup), feeRate, livelinessOptions)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(liveliness)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return serialized, nil
+}
+
+// MobileCreateAndSignTransactionForAccount wraps calls to CreateAndSignTransactionForAccount to conform to gomobile
+// type restrictions
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignTransactionForAccount(
+	networkName string,
+	firstMnemonic string,
+	secondMnemonic string,
+	account int64,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+) ([]byte, error) {
+	accountUint32, err := mobileAccount(account)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateTransaction(params, utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate,
+		"", KeyPathSpend)
+	if err != nil {
+		return nil, wrapError(err)
 	}
-	descriptor, err := wallet.GetSecondDescriptor(network)
+	wallet, err := WalletForAccount(NewWallet(firstMnemonic, secondMnemonic), accountUint32)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
-	mobileWallet := MobileWallet{
-		FirstMnemonic:    wallet.GetFirstMnemonic(),
-		SecondMnemonic:   wallet.GetSecondMnemonic(),
-		SecondDescriptor: descriptor,
+	info, err := SignTransaction(params, wallet, tx)
+	if err != nil {
+		return nil, wrapError(err)
 	}
-	serialized, err := json.Marshal(mobileWallet)
+	serialized, err := json.Marshal(info)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	return serialized, nil
 }
 
-// MobileGetAddresses wraps calls to GetAddresses to conform to gomobile type restrictions
-// The return type is a JSON serialization of the []string
-func MobileGetAddresses(
+// MobileCreateAndSignRecoveryTransactionForAccount wraps calls to CreateAndSignRecoveryTransactionForAccount to
+// conform to gomobile type restrictions. The 'secondDescriptor' must be of 'account'.
+// The return type is a JSON serialization of the SignedMsg
+func MobileCreateAndSignRecoveryTransactionForAccount(
 	networkName string,
 	firstMnemonic string,
 	secondDescriptor string,
-	startIndex int64,
-	num int64,
+	account int64,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
 ) ([]byte, error) {
-	if startIndex < 0 || startIndex > math.MaxUint32 {
-		return nil, wrapError(fmt.Errorf("startIndex must be between [0, %d]", math.MaxUint32))
-	}
-	if num < 0 || num > math.MaxUint8 {
-		return nil, wrapError(fmt.Errorf("num must be between [0, %d]", math.MaxUint8))
+	accountUint32, err := mobileAccount(account)
+	if err != nil {
+		return nil, wrapError(err)
 	}
-	startIndexUint32 := uint32(startIndex)
-	numUint8 := uint8(num)
 	params, err := parseNetworkName(networkName)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
-	addresses, err := GetAddresses(params, wallet, startIndexUint32, numUint8)
+	tx, err := mobileCreateTransaction(params, utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate,
+		"", RecoveryPathSpend)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	serialized, err := json.Marshal(addresses)
+	wallet, err := RecoveryWalletForAccount(params, NewRecoveryWallet(firstMnemonic, secondDescriptor), accountUint32)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	info, err := SignRecoveryTransaction(params, wallet, tx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	serialized, err := json.Marshal(info)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	return serialized, nil
 }
 
-// MobileCreateTransaction wraps calls to CreateTransaction to conform to gomobile type restrictions
-// The return type is a JSON serialization of the MobileTransaction
-func MobileCreateTransaction(
+// MobileCreatePsbt wraps calls to CreateTransaction and TransactionInfo.ToPsbt (or CreateRecoveryTransaction and
+// TransactionInfo.ToRecoveryPsbt if 'recovery' is true) to conform to gomobile type restrictions
+// The return type is the base64 serialization of the PSBT in the provided 'psbtVersion'
+func MobileCreatePsbt(
 	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
 	utxos string,
 	changeAddrSerialized string,
 	destAddrSerialized string,
 	amount int64,
 	feeRate float64,
-) ([]byte, error) {
+	recovery bool,
+	psbtVersion int64,
+) (string, error) {
 	params, err := parseNetworkName(networkName)
 	if err != nil {
-		return nil, wrapError(err)
+		return "", wrapError(err)
 	}
-	changeAddr, err := btcutil.DecodeAddress(changeAddrSerialized, params)
+	path := KeyPathSpend
+	if recovery {
+		path = RecoveryPathSpend
+	}
+	tx, err := mobileCreateTransaction(params, utxos, changeAddrSerialized, destAddrSerialized, amount, feeRate, "",
+		path)
 	if err != nil {
-		return nil, wrapError(err)
+		return "", wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	var packet *psbt.Packet
+	if recovery {
+		packet, err = tx.ToRecoveryPsbt(params, wallet)
+	} else {
+		packet, err = tx.ToPsbt(params, wallet)
 	}
-	destAddr, err := btcutil.DecodeAddress(destAddrSerialized, params)
 	if err != nil {
-		return nil, wrapError(err)
+		return "", wrapError(err)
 	}
-	var utxosDeserialized []Utxo
-	err = json.Unmarshal([]byte(utxos), &utxosDeserialized)
+	encoded, err := EncodePsbt(packet, PsbtVersion(psbtVersion))
 	if err != nil {
-		return nil, wrapError(err)
+		return "", wrapError(err)
+	}
+	return encoded, nil
+}
+
+// MobileSignPsbt wraps calls to SignPsbt to conform to gomobile type restrictions
+// The return type is the base64 serialization of the signed PSBT in the version of the provided 'encodedPsbt'
+func MobileSignPsbt(
+	networkName string,
+	firstMnemonic string,
+	secondMnemonic string,
+	encodedPsbt string,
+) (string, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	packet, version, err := DecodePsbt(encodedPsbt)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	wallet := NewWallet(firstMnemonic, secondMnemonic)
+	if err = SignPsbt(params, wallet, packet); err != nil {
+		return "", wrapError(err)
+	}
+	encoded, err := EncodePsbt(packet, version)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return encoded, nil
+}
+
+// MobileSignRecoveryPsbt wraps calls to SignRecoveryPsbt to conform to gomobile type restrictions
+// The return type is the base64 serialization of the signed PSBT in the version of the provided 'encodedPsbt'
+func MobileSignRecoveryPsbt(
+	networkName string,
+	firstMnemonic string,
+	secondDescriptor string,
+	encodedPsbt string,
+) (string, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return "", wrapError(err)
 	}
-	tx, err := CreateTransaction(utxosDeserialized, changeAddr, destAddr, amount, feeRate)
+	packet, version, err := DecodePsbt(encodedPsbt)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	if err = SignRecoveryPsbt(params, wallet, packet); err != nil {
+		return "", wrapError(err)
+	}
+	encoded, err := EncodePsbt(packet, version)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return encoded, nil
+}
+
+// MobileCombinePsbts wraps calls to CombinePsbts to conform to gomobile type restrictions
+// The 'encodedPsbts' is a JSON serialization of a []string of base64 PSBTs. The return type is the base64
+// serialization of the combined PSBT in the version of the first of 'encodedPsbts'
+func MobileCombinePsbts(encodedPsbts string) (string, error) {
+	var psbtsDeserialized []string
+	err := json.Unmarshal([]byte(encodedPsbts), &psbtsDeserialized)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	packets := make([]*psbt.Packet, 0, len(psbtsDeserialized))
+	var version PsbtVersion
+	for index, encodedPsbt := range psbtsDeserialized {
+		packet, packetVersion, err := DecodePsbt(encodedPsbt)
+		if err != nil {
+			return "", wrapError(err)
+		}
+		if index == 0 {
+			version = packetVersion
+		}
+		packets = append(packets, packet)
+	}
+	combined, err := CombinePsbts(packets...)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	encoded, err := EncodePsbt(combined, version)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return encoded, nil
+}
+
+// MobileFinalizePsbt wraps calls to FinalizePsbt to conform to gomobile type restrictions
+// The return type is a JSON serialization of the SignedMsg
+func MobileFinalizePsbt(encodedPsbt string) ([]byte, error) {
+	packet, _, err := DecodePsbt(encodedPsbt)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	mobileTx := MobileTransaction{
-		Hex:          fmt.Sprintf("%x", tx.Hex),
-		TotalInput:   tx.TxInputAmt,
-		Amount:       tx.TxInputAmt - tx.TxFeeAmt - tx.TxChangeAmt,
-		Fees:         tx.TxFeeAmt,
-		Change:       tx.TxChangeAmt,
-		ChangeIsDust: tx.IsChangeDust(),
+	info, err := FinalizePsbt(packet)
+	if err != nil {
+		return nil, wrapError(err)
 	}
-	serialized, err := json.Marshal(mobileTx)
+	serialized, err := json.Marshal(info)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	return serialized, nil
 }
 
-// MobileCreateAndSignTransaction wraps calls to CreateAndSignTransaction to conform to gomobile type restrictions
+// MobileBumpFee wraps calls to BumpFee to conform to gomobile type restrictions. The 'originalHex' is the
+// hex serialization of the signed transaction to replace, the 'prevouts' are a JSON serialization of the Utxo
+// spent by it and 'additional' a JSON serialization of the Utxo which may be added
 // The return type is a JSON serialization of the SignedMsg
-func MobileCreateAndSignTransaction(
+func MobileBumpFee(
 	networkName string,
 	firstMnemonic string,
 	secondMnemonic string,
-	utxos string,
+	originalHex string,
+	prevouts string,
+	additional string,
 	changeAddrSerialized string,
-	destAddrSerialized string,
-	amount int64,
 	feeRate float64,
 ) ([]byte, error) {
 	params, err := parseNetworkName(networkName)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	changeAddr, err := btcutil.DecodeAddress(changeAddrSerialized, params)
-	if err != nil {
-		return nil, wrapError(err)
-	}
-	destAddr, err := btcutil.DecodeAddress(destAddrSerialized, params)
-	if err != nil {
-		return nil, wrapError(err)
-	}
-	var utxosDeserialized []Utxo
-	err = json.Unmarshal([]byte(utxos), &utxosDeserialized)
+	tx, err := mobileCreateFeeBumpTransaction(params, originalHex, prevouts, additional, changeAddrSerialized, feeRate,
+		KeyPathSpend)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 	wallet := NewWallet(firstMnemonic, secondMnemonic)
-	info, err := CreateAndSignTransaction(params, wallet, utxosDeserialized, changeAddr, destAddr, amount, feeRate)
+	info, err := SignTransaction(params, wallet, tx)
 	if err != nil {
 		return nil, wrapError(err)
 	}
@@ -158,37 +996,61 @@ func MobileCreateAndSignTransaction(
 	return serialized, nil
 }
 
-// MobileCreateAndSignRecoveryTransaction wraps calls to CreateAndSignRecoveryTransaction to conform to gomobile type restrictions
+// MobileBumpRecoveryFee wraps calls to BumpRecoveryFee to conform to gomobile type restrictions; see MobileBumpFee
 // The return type is a JSON serialization of the SignedMsg
-func MobileCreateAndSignRecoveryTransaction(
+func MobileBumpRecoveryFee(
 	networkName string,
 	firstMnemonic string,
 	secondDescriptor string,
-	utxos string,
+	originalHex string,
+	prevouts string,
+	additional string,
 	changeAddrSerialized string,
-	destAddrSerialized string,
-	amount int64,
 	feeRate float64,
 ) ([]byte, error) {
 	params, err := parseNetworkName(networkName)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	changeAddr, err := btcutil.DecodeAddress(changeAddrSerialized, params)
+	tx, err := mobileCreateFeeBumpTransaction(params, originalHex, prevouts, additional, changeAddrSerialized, feeRate,
+		RecoveryPathSpend)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	destAddr, err := btcutil.DecodeAddress(destAddrSerialized, params)
+	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
+	info, err := SignRecoveryTransaction(params, wallet, tx)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	var utxosDeserialized []Utxo
-	err = json.Unmarshal([]byte(utxos), &utxosDeserialized)
+	serialized, err := json.Marshal(info)
 	if err != nil {
 		return nil, wrapError(err)
 	}
-	wallet := NewRecoveryWallet(firstMnemonic, secondDescriptor)
-	info, err := CreateAndSignRecoveryTransaction(params, wallet, utxosDeserialized, changeAddr, destAddr, amount, feeRate)
+	return serialized, nil
+}
+
+// MobileCpfp wraps calls to Cpfp to conform to gomobile type restrictions. The 'parents' are a JSON serialization of
+// the CpfpParent and 'outputs' a JSON serialization of the Utxo (of the parents) to spend
+// The return type is a JSON serialization of the SignedMsg
+func MobileCpfp(
+	networkName string,
+	firstMnemonic string,
+	secondMnemonic string,
+	parents string,
+	outputs string,
+	destAddrSerialized string,
+	feeRate float64,
+) ([]byte, error) {
+	params, err := parseNetworkName(networkName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := mobileCreateCpfpTransaction(params, parents, outputs, destAddrSerialized, feeRate)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	wallet := NewWallet(firstMnemonic, secondMnemonic)
+	info, err := SignTransaction(params, wallet, tx)
 	if err != nil {
 		return nil, wrapError(err)
 	}
@@ -199,6 +1061,30 @@ func MobileCreateAndSignRecoveryTransaction(
 	return serialized, nil
 }
 
+// MobileRegisterNetwork wraps calls to RegisterNetwork so that 'networkName' is accepted by every Mobile* function;
+// 'network' is a JSON serialization of the MobileNetwork
+func MobileRegisterNetwork(networkName string, network string) error {
+	var mobileNetwork MobileNetwork
+	if err := json.Unmarshal([]byte(network), &mobileNetwork); err != nil {
+		return wrapError(err)
+	}
+	params, err := mobileNetwork.params()
+	if err != nil {
+		return wrapError(err)
+	}
+	params.Name = strings.ToLower(networkName)
+	return wrapError(RegisterNetwork(networkName, params))
+}
+
+// MobileAddDescriptorChecksum wraps calls to AddDescriptorChecksum to conform to gomobile type restrictions
+func MobileAddDescriptorChecksum(descriptor string) (string, error) {
+	checksummed, err := AddDescriptorChecksum(descriptor)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return checksummed, nil
+}
+
 func MobileCreateEphemeralSocialKeyPair() ([]byte, error) {
 	socialKeyPair, err := CreateEphemeralSocialKeyPair()
 	if err != nil {
@@ -231,12 +1117,214 @@ func MobileDecryptWithEphemeralSocialPrivateKey(privateKeyHex string, encrypted
 	return decrypted, nil
 }
 
+func mobileCreateTransaction(
+	params *chaincfg.Params,
+	utxos string,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+	coinSelection string,
+	path SpendPath,
+) (*TransactionInfo, error) {
+	var utxosDeserialized []Utxo
+	if err := json.Unmarshal([]byte(utxos), &utxosDeserialized); err != nil {
+		return nil, err
+	}
+	return mobileCreateTransactionFromUtxos(params, utxosDeserialized, changeAddrSerialized, destAddrSerialized,
+		amount, feeRate, coinSelection, path, 0)
+}
+
+func mobileCreateTransactionFromUtxos(
+	params *chaincfg.Params,
+	utxos []Utxo,
+	changeAddrSerialized string,
+	destAddrSerialized string,
+	amount int64,
+	feeRate float64,
+	coinSelection string,
+	path SpendPath,
+	timelock uint32,
+) (*TransactionInfo, error) {
+	changeAddr, err := btcutil.DecodeAddress(changeAddrSerialized, params)
+	if err != nil {
+		return nil, err
+	}
+	destAddr, err := btcutil.DecodeAddress(destAddrSerialized, params)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := GetCoinSelector(coinSelection)
+	if err != nil {
+		return nil, err
+	}
+	return createTransactionWithCoinSelector(utxos, changeAddr,
+		[]Recipient{{Address: destAddr, Amount: amount}}, feeRate, selector, path, timelock)
+}
+
+func mobileCreateBatchTransaction(
+	params *chaincfg.Params,
+	utxos string,
+	changeAddrSerialized string,
+	recipients string,
+	feeRate float64,
+	coinSelection string,
+	path SpendPath,
+) (*TransactionInfo, error) {
+	changeAddr, err := btcutil.DecodeAddress(changeAddrSerialized, params)
+	if err != nil {
+		return nil, err
+	}
+	var mobileRecipients []MobileRecipient
+	if err = json.Unmarshal([]byte(recipients), &mobileRecipients); err != nil {
+		return nil, err
+	}
+	recipientsDeserialized := make([]Recipient, 0, len(mobileRecipients))
+	for _, mobileRecipient := range mobileRecipients {
+		address, err := btcutil.DecodeAddress(mobileRecipient.Address, params)
+		if err != nil {
+			return nil, err
+		}
+		recipientsDeserialized = append(recipientsDeserialized, Recipient{Address: address, Amount: mobileRecipient.Amount})
+	}
+	var utxosDeserialized []Utxo
+	if err = json.Unmarshal([]byte(utxos), &utxosDeserialized); err != nil {
+		return nil, err
+	}
+	selector, err := GetCoinSelector(coinSelection)
+	if err != nil {
+		return nil, err
+	}
+	return createBatchTransaction(utxosDeserialized, changeAddr, recipientsDeserialized, feeRate, selector, path, 0)
+}
+
+func mobileCreateFeeBumpTransaction(
+	params *chaincfg.Params,
+	originalHex string,
+	prevouts string,
+	additional string,
+	changeAddrSerialized string,
+	feeRate float64,
+	path SpendPath,
+) (*TransactionInfo, error) {
+	original, err := decodeMsgTx(originalHex)
+	if err != nil {
+		return nil, err
+	}
+	changeAddr, err := btcutil.DecodeAddress(changeAddrSerialized, params)
+	if err != nil {
+		return nil, err
+	}
+	var prevoutsDeserialized []Utxo
+	if err = json.Unmarshal([]byte(prevouts), &prevoutsDeserialized); err != nil {
+		return nil, err
+	}
+	var additionalDeserialized []Utxo
+	if additional != "" {
+		if err = json.Unmarshal([]byte(additional), &additionalDeserialized); err != nil {
+			return nil, err
+		}
+	}
+	return CreateFeeBumpTransaction(original, prevoutsDeserialized, additionalDeserialized, changeAddr, feeRate, path)
+}
+
+func mobileCreateCpfpTransaction(
+	params *chaincfg.Params,
+	parents string,
+	outputs string,
+	destAddrSerialized string,
+	feeRate float64,
+) (*TransactionInfo, error) {
+	destAddr, err := btcutil.DecodeAddress(destAddrSerialized, params)
+	if err != nil {
+		return nil, err
+	}
+	var parentsDeserialized []CpfpParent
+	if err = json.Unmarshal([]byte(parents), &parentsDeserialized); err != nil {
+		return nil, err
+	}
+	var outputsDeserialized []Utxo
+	if err = json.Unmarshal([]byte(outputs), &outputsDeserialized); err != nil {
+		return nil, err
+	}
+	return CreateCpfpTransaction(parentsDeserialized, outputsDeserialized, destAddr, feeRate)
+}
+
+func decodeMsgTx(txHex string) (*wire.MsgTx, error) {
+	serialized, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, err
+	}
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if err = msgTx.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, err
+	}
+	return msgTx, nil
+}
+
 type MobileWallet struct {
 	FirstMnemonic    string
 	SecondMnemonic   string
 	SecondDescriptor string
 }
 
+type MobileDiscovery struct {
+	Used             bool
+	HighestUsedIndex uint32
+	NextUnusedIndex  uint32
+}
+
+// MobileNetwork is a custom network; a signet if SignetChallenge is set, otherwise a copy of the Base network, with
+// the given Bech32HRP and NetworkMagic if non-empty
+type MobileNetwork struct {
+	// Base is the name of the network to copy; defaults to signet if SignetChallenge is set
+	Base string
+	// SignetChallenge is the hex encoded block challenge script of a custom signet
+	SignetChallenge string
+	Bech32HRP       string
+	NetworkMagic    uint32
+}
+
+func (n *MobileNetwork) params() (*chaincfg.Params, error) {
+	var params chaincfg.Params
+	if n.SignetChallenge != "" {
+		if n.Base != "" && !strings.EqualFold(n.Base, "signet") {
+			return nil, fmt.Errorf("signet challenge requires a signet base network, not %v", n.Base)
+		}
+		challenge, err := hex.DecodeString(n.SignetChallenge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signet challenge: %w", err)
+		}
+		params = chaincfg.CustomSignetParams(challenge, nil)
+	} else {
+		if n.Base == "" {
+			return nil, fmt.Errorf("base network or signet challenge is required")
+		}
+		base, err := NetworkParams(n.Base)
+		if err != nil {
+			return nil, err
+		}
+		params = *base
+	}
+	if n.Bech32HRP != "" {
+		params.Bech32HRPSegwit = strings.ToLower(n.Bech32HRP)
+	}
+	if n.NetworkMagic != 0 {
+		params.Net = wire.BitcoinNet(n.NetworkMagic)
+	}
+	return &params, nil
+}
+
+type MobileChangeAddress struct {
+	Address string
+	Index   uint32
+}
+
+type MobileWalletPolicy struct {
+	Policy             *WalletPolicy
+	AddressDescriptors []string
+}
+
 type MobileTransaction struct {
 	Hex          string
 	TotalInput   int64
@@ -246,21 +1334,16 @@ type MobileTransaction struct {
 	ChangeIsDust bool
 }
 
-func parseNetworkName(networkName string) (*chaincfg.Params, error) {
-	switch strings.ToLower(networkName) {
-	case "mainnet":
-		return &chaincfg.MainNetParams, nil
-	case "regtest":
-		return &chaincfg.RegressionNetParams, nil
-	case "testnet3":
-		fallthrough
-	case "testnet":
-		return &chaincfg.TestNet3Params, nil
-	case "simnet":
-		return &chaincfg.SimNetParams, nil
-	default:
-		return nil, fmt.Errorf("unknown network: %v", networkName)
+// mobileAccount converts 'account' to a BIP-44 account
+func mobileAccount(account int64) (uint32, error) {
+	if account < 0 || account >= hdkeychain.HardenedKeyStart {
+		return 0, fmt.Errorf("account must be between [0, %d]", hdkeychain.HardenedKeyStart-1)
 	}
+	return uint32(account), nil
+}
+
+func parseNetworkName(networkName string) (*chaincfg.Params, error) {
+	return NetworkParams(networkName)
 }
 
 // gomobile binding panics (e.g. "Panic: runtime error: hash of unhashable") if error is a custom implementation of builtin error
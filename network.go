@@ -0,0 +1,114 @@
+package leafy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"strings"
+	"sync"
+)
+
+// TestNet4Params are the network parameters of testnet4 (BIP-94); only those used by Leafy, i.e. not the genesis
+// block or checkpoints, are meaningful
+var TestNet4Params = testNet4Params()
+
+var (
+	networksLock sync.RWMutex
+	networks     = map[string]*chaincfg.Params{
+		"mainnet":  &chaincfg.MainNetParams,
+		"regtest":  &chaincfg.RegressionNetParams,
+		"testnet":  &chaincfg.TestNet3Params,
+		"testnet3": &chaincfg.TestNet3Params,
+		"testnet4": &TestNet4Params,
+		"simnet":   &chaincfg.SimNetParams,
+		"signet":   &chaincfg.SigNetParams,
+	}
+	builtinNetworks = map[string]bool{}
+)
+
+func init() {
+	for name := range networks {
+		builtinNetworks[name] = true
+	}
+	// chaincfg registers only mainnet, testnet3, regtest and simnet; addresses and extended keys of the others are
+	// only decodable once registered
+	for _, params := range []*chaincfg.Params{&chaincfg.SigNetParams, &TestNet4Params} {
+		if err := registerParams(params); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NetworkParams returns the network parameters named 'networkName' (case-insensitive); one of mainnet, regtest,
+// testnet (testnet3), testnet4, simnet, signet or a name registered via RegisterNetwork
+func NetworkParams(networkName string) (*chaincfg.Params, error) {
+	networksLock.RLock()
+	defer networksLock.RUnlock()
+	params, ok := networks[strings.ToLower(networkName)]
+	if !ok {
+		return nil, fmt.Errorf("unknown network: %v", networkName)
+	}
+	return params, nil
+}
+
+// RegisterNetwork makes 'params', e.g. a custom signet (see chaincfg.CustomSignetParams) or a network with a custom
+// bech32 HRP, available as 'networkName' to NetworkParams. The built-in names cannot be replaced but a registered
+// name can be, e.g. upon each app start.
+// A custom bech32 HRP requires 'params' to have a network magic (Net) distinct from every other registered network.
+func RegisterNetwork(networkName string, params *chaincfg.Params) error {
+	name := strings.ToLower(strings.TrimSpace(networkName))
+	if name == "" {
+		return errors.New("network name is required")
+	}
+	if params == nil {
+		return errors.New("network params are required")
+	}
+	if params.Bech32HRPSegwit == "" {
+		return errors.New("network params require a bech32 HRP")
+	}
+	if builtinNetworks[name] {
+		return fmt.Errorf("cannot replace built-in network: %v", networkName)
+	}
+	if err := registerParams(params); err != nil {
+		return err
+	}
+	networksLock.Lock()
+	defer networksLock.Unlock()
+	networks[name] = params
+	return nil
+}
+
+func registerParams(params *chaincfg.Params) error {
+	err := chaincfg.Register(params)
+	if errors.Is(err, chaincfg.ErrDuplicateNet) {
+		// the magic's network already registered its address prefixes and extended key ids, which suffices unless
+		// 'params' differ in their bech32 HRP
+		if !chaincfg.IsBech32SegwitPrefix(params.Bech32HRPSegwit + "1") {
+			return fmt.Errorf("network magic %v is already registered; bech32 HRP %v requires a distinct magic",
+				params.Net, params.Bech32HRPSegwit)
+		}
+		return chaincfg.RegisterHDKeyID(params.HDPublicKeyID[:], params.HDPrivateKeyID[:])
+	}
+	return err
+}
+
+func testNet4Params() chaincfg.Params {
+	params := chaincfg.TestNet3Params
+	genesisHash, err := chainhash.NewHashFromStr("00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043")
+	if err != nil {
+		panic(err)
+	}
+	params.Name = "testnet4"
+	params.Net = wire.BitcoinNet(0x283f161c)
+	params.DefaultPort = "48333"
+	params.DNSSeeds = []chaincfg.DNSSeed{
+		{Host: "seed.testnet4.bitcoin.sprovoost.nl", HasFiltering: true},
+		{Host: "seed.testnet4.wiz.biz", HasFiltering: true},
+	}
+	params.GenesisBlock = nil
+	params.GenesisHash = genesisHash
+	params.Checkpoints = nil
+	return params
+}
@@ -0,0 +1,83 @@
+package leafy_test
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"strings"
+	"testing"
+)
+
+func TestNetworkParams(t *testing.T) {
+	for name, expected := range map[string]*chaincfg.Params{
+		"mainnet":  &chaincfg.MainNetParams,
+		"RegTest":  &chaincfg.RegressionNetParams,
+		"testnet":  &chaincfg.TestNet3Params,
+		"testnet3": &chaincfg.TestNet3Params,
+		"testnet4": &leafy.TestNet4Params,
+		"simnet":   &chaincfg.SimNetParams,
+		"signet":   &chaincfg.SigNetParams,
+	} {
+		params, err := leafy.NetworkParams(name)
+		require.NoError(t, err)
+		require.Equal(t, expected, params)
+	}
+	_, err := leafy.NetworkParams("unknown")
+	require.ErrorContains(t, err, "unknown network: unknown")
+
+	require.Equal(t, "testnet4", leafy.TestNet4Params.Name)
+	require.Equal(t, wire.BitcoinNet(0x283f161c), leafy.TestNet4Params.Net)
+	require.Equal(t, "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043",
+		leafy.TestNet4Params.GenesisHash.String())
+}
+
+func TestSignetAndTestNet4Addresses(t *testing.T) {
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	for _, params := range []*chaincfg.Params{&chaincfg.SigNetParams, &leafy.TestNet4Params} {
+		addresses, err := leafy.GetAddresses(params, wallet, 0, 2)
+		require.NoError(t, err)
+		for _, address := range addresses {
+			require.True(t, strings.HasPrefix(address, "tb1p"))
+			decoded, err := btcutil.DecodeAddress(address, params)
+			require.NoError(t, err)
+			require.True(t, decoded.IsForNet(params))
+		}
+		descriptor, err := wallet.GetSecondDescriptor(params)
+		require.NoError(t, err)
+		recoveryWallet := leafy.NewRecoveryWallet(wallet.GetFirstMnemonic(), descriptor)
+		recoveryAddresses, err := leafy.GetAddresses(params, recoveryWallet, 0, 2)
+		require.NoError(t, err)
+		require.Equal(t, addresses, recoveryAddresses)
+	}
+}
+
+func TestRegisterNetwork(t *testing.T) {
+	signet := chaincfg.CustomSignetParams([]byte{0x51}, nil)
+	require.NoError(t, leafy.RegisterNetwork("QASignet", &signet))
+	params, err := leafy.NetworkParams("qasignet")
+	require.NoError(t, err)
+	require.Equal(t, &signet, params)
+	// re-registration, e.g. upon each app start, replaces the network
+	require.NoError(t, leafy.RegisterNetwork("qasignet", &signet))
+
+	custom := chaincfg.RegressionNetParams
+	custom.Bech32HRPSegwit = "lfy"
+	err = leafy.RegisterNetwork("custom", &custom)
+	require.ErrorContains(t, err, "bech32 HRP lfy requires a distinct magic")
+	custom.Net = wire.BitcoinNet(0x4c46590a)
+	require.NoError(t, leafy.RegisterNetwork("custom", &custom))
+	params, err = leafy.NetworkParams("custom")
+	require.NoError(t, err)
+	addresses, err := leafy.GetAddresses(params, leafy.NewWallet(seedMnemonic, seedMnemonic), 0, 1)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(addresses[0], "lfy1p"))
+	decoded, err := btcutil.DecodeAddress(addresses[0], params)
+	require.NoError(t, err)
+	require.True(t, decoded.IsForNet(params))
+
+	require.ErrorContains(t, leafy.RegisterNetwork("signet", &signet), "cannot replace built-in network: signet")
+	require.ErrorContains(t, leafy.RegisterNetwork(" ", &signet), "network name is required")
+	require.ErrorContains(t, leafy.RegisterNetwork("nil", nil), "network params are required")
+}
@@ -0,0 +1,192 @@
+package leafy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"strings"
+)
+
+// LeafyPolicyTemplate describes, in the style of a BIP-388 template, a Leafy address where @0 is the key of the second
+// seed and @1 the key of the first seed. It is not a BIP-388 policy as neither key is used as is:
+//
+//   - tweaked(@0/*) is the internal key, the @0/i key taproot tweaked (BIP-341 TapTweak) by the sha256 of the @1/i
+//     private key; as the tweak is secret the internal key of each address is provided (see WalletPolicy.InternalKeys)
+//   - bip86(@1/*) is the leaf key, the x-only output key of tr(@1/i), i.e. the @1/i key tweaked as in BIP-86
+const LeafyPolicyTemplate = "tr(tweaked(@0/*),and_v(v:pk(bip86(@1/*)),older(%d)))"
+
+// WalletPolicy describes how the addresses of a Leafy wallet are constructed so that they can be independently
+// regenerated, by a watch-only importer or an auditor, without either mnemonic; see LeafyPolicyTemplate. For address
+// index i the single leaf script is "<leaf key> OP_CHECKSIGVERIFY <Timelock> OP_CHECKSEQUENCEVERIFY".
+//
+// The policy holds no secrets. In particular it omits the internal key tweaks, which along with the second seed would
+// allow spending via the key path without the first seed.
+type WalletPolicy struct {
+	// Template is LeafyPolicyTemplate with the Timelock
+	Template string
+	// Keys is the key information of @0 and @1 (as "[fingerprint/derivation]xpub")
+	Keys []string
+	// Timelock is the relative timelock, in blocks, of the recovery leaf
+	Timelock uint32
+	// Chain is that of the addresses, e.g. InternalChain for change addresses
+	Chain uint32
+	// StartIndex is the address index of the first of InternalKeys
+	StartIndex uint32
+	// InternalKeys are the hex encoded x-only internal keys of address indices StartIndex onwards
+	InternalKeys []string
+}
+
+// GetWalletPolicy creates the WalletPolicy of 'wallet' for the 'num' ExternalChain addresses from 'startIndex'
+func GetWalletPolicy(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	startIndex uint32,
+	num uint8,
+) (*WalletPolicy, error) {
+	return GetChainWalletPolicy(params, wallet, ExternalChain, startIndex, num)
+}
+
+// GetChainWalletPolicy is GetWalletPolicy for the addresses of 'chain'; i.e. InternalChain for change addresses
+func GetChainWalletPolicy(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	chain uint32,
+	startIndex uint32,
+	num uint8,
+) (*WalletPolicy, error) {
+	if num < 1 {
+		return nil, fmt.Errorf("invalid amount of addresses [%d], must be greater than 0", num)
+	}
+	if uint64(startIndex)+uint64(num) > hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("exhausted address indices at %d", startIndex)
+	}
+	deriver, err := newAddressDeriver(params, wallet, addressBranch{chain: chain})
+	if err != nil {
+		return nil, err
+	}
+	firstKey, err := deriver.firstKey.DeriveSibling(Path(startIndex))
+	if err != nil {
+		return nil, err
+	}
+	// the change level key of the addresses, as the second descriptor may be multipath
+	secondKey := deriver.secondKey
+	firstDescriptor := firstKey.GetTaprootParentDescriptorWithoutChecksum("")
+	secondIndexKey, err := secondKey.DeriveSibling(Path(startIndex))
+	if err != nil {
+		return nil, err
+	}
+	internalKeys := make([]string, num)
+	for i := range internalKeys {
+		firstPrivateKey, err := firstKey.GetPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		secondPublicKey, err := secondIndexKey.GetPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		internalKey := txscript.ComputeTaprootOutputKey(secondPublicKey, computeHashRaw(firstPrivateKey.Serialize()))
+		internalKeys[i] = hex.EncodeToString(schnorr.SerializePubKey(internalKey))
+		if firstKey, err = firstKey.DeriveNextSibling(); err != nil {
+			return nil, err
+		}
+		if secondIndexKey, err = secondIndexKey.DeriveNextSibling(); err != nil {
+			return nil, err
+		}
+	}
+	return &WalletPolicy{
+		Template: fmt.Sprintf(LeafyPolicyTemplate, GetWalletConfig(wallet).Timelock),
+		Keys: []string{taprootDescriptorKey(secondKey.GetTaprootParentDescriptorWithoutChecksum("")),
+			taprootDescriptorKey(firstDescriptor)},
+		Timelock:     GetWalletConfig(wallet).Timelock,
+		Chain:        chain,
+		StartIndex:   startIndex,
+		InternalKeys: internalKeys,
+	}, nil
+}
+
+// GetAddressDescriptors returns, per address of the policy, a checksummed descriptor of the form
+// "tr(<internal key>,and_v(v:pk(<leaf key>),older(<timelock>)))" which can be imported, watch-only, into
+// Bitcoin Core or Sparrow.
+func (p *WalletPolicy) GetAddressDescriptors() ([]string, error) {
+	descriptors := make([]string, 0, len(p.InternalKeys))
+	err := p.forEachAddress(func(internalKey *btcec.PublicKey, firstPublicKey *btcec.PublicKey) error {
+		leafKey := schnorr.SerializePubKey(txscript.ComputeTaprootKeyNoScript(firstPublicKey))
+		descriptor, err := AddDescriptorChecksum(fmt.Sprintf("tr(%x,and_v(v:pk(%x),older(%d)))",
+			schnorr.SerializePubKey(internalKey), leafKey, p.Timelock))
+		if err != nil {
+			return err
+		}
+		descriptors = append(descriptors, descriptor)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return descriptors, nil
+}
+
+// GetAddresses regenerates the addresses of the policy, which are those of GetChainAddresses for the same wallet and
+// chain
+func (p *WalletPolicy) GetAddresses(params *chaincfg.Params) ([]string, error) {
+	addresses := make([]string, 0, len(p.InternalKeys))
+	err := p.forEachAddress(func(internalKey *btcec.PublicKey, firstPublicKey *btcec.PublicKey) error {
+		leafScript, err := CreateTapscriptTimelockFromKey(params, int64(p.Timelock), firstPublicKey)
+		if err != nil {
+			return err
+		}
+		address, err := NewTapscriptBuilder(internalKey).
+			AddLeafScript(leafScript).
+			Address(params)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, address.EncodeAddress())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// forEachAddress calls 'fn' with the internal key and first seed key of each address of the policy
+func (p *WalletPolicy) forEachAddress(fn func(internalKey *btcec.PublicKey, firstPublicKey *btcec.PublicKey) error) error {
+	if len(p.Keys) != 2 {
+		return fmt.Errorf("invalid wallet policy; expecting 2 keys but was %d", len(p.Keys))
+	}
+	firstKey, err := ImportFromTaprootDescriptorForParent(fmt.Sprintf("tr(%s)", p.Keys[1]), Path(p.StartIndex))
+	if err != nil {
+		return fmt.Errorf("invalid wallet policy key @1: %w", err)
+	}
+	for i, internalKeyHex := range p.InternalKeys {
+		serialized, err := hex.DecodeString(internalKeyHex)
+		if err != nil {
+			return fmt.Errorf("invalid wallet policy internal key %d: %s", i, internalKeyHex)
+		}
+		internalKey, err := schnorr.ParsePubKey(serialized)
+		if err != nil {
+			return fmt.Errorf("invalid wallet policy internal key %d: %w", i, err)
+		}
+		firstPublicKey, err := firstKey.GetPublicKey()
+		if err != nil {
+			return err
+		}
+		if err = fn(internalKey, firstPublicKey); err != nil {
+			return err
+		}
+		if firstKey, err = firstKey.DeriveNextSibling(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taprootDescriptorKey returns the key expression of a "tr(KEY)" descriptor
+func taprootDescriptorKey(descriptor string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(descriptor, "tr("), ")")
+}
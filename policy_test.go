@@ -0,0 +1,80 @@
+package leafy_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"strings"
+	"testing"
+)
+
+func TestWalletPolicy(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	descriptor, err := leafy.GetDescriptorWithChecksum(params, wallet.GetSecondMnemonic())
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(wallet.GetFirstMnemonic(), descriptor)
+
+	policy, err := leafy.GetWalletPolicy(params, recoveryWallet, 3, 5)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("tr(tweaked(@0/*),and_v(v:pk(bip86(@1/*)),older(%d)))", leafy.DefaultTimelock),
+		policy.Template)
+	require.Equal(t, 2, len(policy.Keys))
+	require.Equal(t, 5, len(policy.InternalKeys))
+	for _, key := range policy.Keys {
+		require.True(t, strings.HasPrefix(key, "["))
+		require.False(t, strings.Contains(key, "#"))
+	}
+
+	expected, err := leafy.GetAddresses(params, wallet, 3, 5)
+	require.NoError(t, err)
+	// regenerated from only the serialized policy, which has no secrets
+	serialized, err := json.Marshal(policy)
+	require.NoError(t, err)
+	require.NotContains(t, string(serialized), "Tweak")
+	var deserialized leafy.WalletPolicy
+	require.NoError(t, json.Unmarshal(serialized, &deserialized))
+	addresses, err := deserialized.GetAddresses(params)
+	require.NoError(t, err)
+	require.Equal(t, expected, addresses)
+
+	descriptors, err := deserialized.GetAddressDescriptors()
+	require.NoError(t, err)
+	require.Equal(t, 5, len(descriptors))
+	for _, addressDescriptor := range descriptors {
+		stripped, err := leafy.StripDescriptorChecksum(addressDescriptor)
+		require.NoError(t, err)
+		require.Regexp(t, fmt.Sprintf(`^tr\([0-9a-f]{64},and_v\(v:pk\([0-9a-f]{64}\),older\(%d\)\)\)$`, leafy.DefaultTimelock),
+			stripped)
+	}
+
+	// change addresses
+	policy, err = leafy.GetChainWalletPolicy(params, recoveryWallet, leafy.InternalChain, 2, 4)
+	require.NoError(t, err)
+	require.Equal(t, leafy.InternalChain, policy.Chain)
+	expected, err = leafy.GetChainAddresses(params, wallet, leafy.InternalChain, 2, 4)
+	require.NoError(t, err)
+	serialized, err = json.Marshal(policy)
+	require.NoError(t, err)
+	var internal leafy.WalletPolicy
+	require.NoError(t, json.Unmarshal(serialized, &internal))
+	addresses, err = internal.GetAddresses(params)
+	require.NoError(t, err)
+	require.Equal(t, expected, addresses)
+
+	// invalid
+	_, err = leafy.GetWalletPolicy(params, recoveryWallet, 0, 0)
+	require.Error(t, err)
+	_, err = leafy.GetWalletPolicy(params, recoveryWallet, hdkeychain.HardenedKeyStart-1, 2)
+	require.ErrorContains(t, err, "exhausted address indices")
+	deserialized.InternalKeys[0] = "abcd"
+	_, err = deserialized.GetAddresses(params)
+	require.Error(t, err)
+	deserialized.Keys = deserialized.Keys[:1]
+	_, err = deserialized.GetAddressDescriptors()
+	require.Error(t, err)
+}
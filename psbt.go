@@ -0,0 +1,437 @@
+package leafy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// PsbtVersion is the serialization version of a PSBT; see [BIP-174](https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki)
+// and [BIP-370](https://github.com/bitcoin/bips/blob/master/bip-0370.mediawiki)
+type PsbtVersion uint32
+
+const (
+	PsbtV0 PsbtVersion = 0
+	PsbtV2 PsbtVersion = 2
+)
+
+// ToPsbt converts the transaction into a PSBT to be signed via the key path (i.e. SignPsbt). Each input carries its
+// witness utxo as well as the [BIP-371](https://github.com/bitcoin/bips/blob/master/bip-0371.mediawiki) taproot fields
+// for the Leafy address being spent.
+func (t *TransactionInfo) ToPsbt(params *chaincfg.Params, wallet RecoveryWallet) (*psbt.Packet, error) {
+	return t.toPsbt(params, wallet, 0)
+}
+
+// ToRecoveryPsbt is like ToPsbt but sets each input's sequence to the wallet's timelock so that the PSBT can be signed via
+// the timelock script path (i.e. SignRecoveryPsbt).
+func (t *TransactionInfo) ToRecoveryPsbt(params *chaincfg.Params, wallet RecoveryWallet) (*psbt.Packet, error) {
+	return t.toPsbt(params, wallet, GetWalletConfig(wallet).Timelock)
+}
+
+func (t *TransactionInfo) toPsbt(params *chaincfg.Params, wallet RecoveryWallet, sequence uint32) (*psbt.Packet, error) {
+	// CreateTransaction uses placeholder witnesses for fee estimation, a PSBT's transaction must be unsigned
+	msgTx := t.MsgTx.Copy()
+	for _, txin := range msgTx.TxIn {
+		txin.Witness = nil
+		txin.Sequence = sequence
+	}
+	packet, err := psbt.NewFromUnsignedTx(msgTx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := findSigningRecoveryKeys(params, wallet, t, nil)
+	if err != nil {
+		return nil, err
+	}
+	derivers := newAddressDerivers(params, wallet)
+	for index, txin := range msgTx.TxIn {
+		outpoint := txin.PreviousOutPoint.String()
+		outpointAddr, found := t.outpointToAddr[outpoint]
+		if !found {
+			return nil, fmt.Errorf("failed to find outpoint %s", outpoint)
+		}
+		key, found := keys[outpointAddr]
+		if !found {
+			return nil, fmt.Errorf("failed to find signing key for outpoint %s @ %s", outpoint, outpointAddr)
+		}
+		deriver, err := derivers.forDerivation(key.derivation)
+		if err != nil {
+			return nil, err
+		}
+		firstKey, secondKey, err := deriver.bip44KeysAt(key.derivation.Index)
+		if err != nil {
+			return nil, err
+		}
+		firstDerivation, err := taprootBip32Derivation(firstKey, key.tapscriptData.Leaf)
+		if err != nil {
+			return nil, err
+		}
+		secondDerivation, err := taprootBip32Derivation(secondKey)
+		if err != nil {
+			return nil, err
+		}
+		input := &packet.Inputs[index]
+		input.WitnessUtxo = &wire.TxOut{
+			Value:    t.outpointToAmt[outpoint],
+			PkScript: t.outpointToScript[outpoint],
+		}
+		input.TaprootInternalKey = schnorr.SerializePubKey(key.internalKey)
+		input.TaprootMerkleRoot = key.tapscriptData.MerkleRoot[:]
+		input.TaprootLeafScript = []*psbt.TaprootTapLeafScript{
+			{
+				ControlBlock: key.tapscriptData.ControlBlock,
+				Script:       key.tapscriptData.LeafScript,
+				LeafVersion:  key.tapscriptData.Leaf.LeafVersion,
+			},
+		}
+		input.TaprootBip32Derivation = []*psbt.TaprootBip32Derivation{firstDerivation}
+		// a derivation is keyed by its public key, only possible to collide if both seeds are the same
+		if !bytes.Equal(firstDerivation.XOnlyPubKey, secondDerivation.XOnlyPubKey) {
+			input.TaprootBip32Derivation = append(input.TaprootBip32Derivation, secondDerivation)
+		}
+	}
+	return packet, nil
+}
+
+func taprootBip32Derivation(key *Bip44Key, leaves ...txscript.TapLeaf) (*psbt.TaprootBip32Derivation, error) {
+	publicKey, err := key.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := fingerprintToUint32(key.GetFingerprint())
+	if err != nil {
+		return nil, err
+	}
+	leafHashes := make([][]byte, 0, len(leaves))
+	for _, leaf := range leaves {
+		leafHash := leaf.TapHash()
+		leafHashes = append(leafHashes, leafHash[:])
+	}
+	return &psbt.TaprootBip32Derivation{
+		XOnlyPubKey:          schnorr.SerializePubKey(publicKey),
+		LeafHashes:           leafHashes,
+		MasterKeyFingerprint: fingerprint,
+		Bip32Path: []uint32{key.GetPurposeRaw(), key.GetCoinRaw(), key.GetAccountRaw(), key.GetChangeRaw(),
+			key.GetIndexRaw()},
+	}, nil
+}
+
+// fingerprintToUint32 converts the hex fingerprint into the little-endian uint32 used by PSBT derivation fields
+func fingerprintToUint32(fingerprint string) (uint32, error) {
+	decoded, err := hex.DecodeString(fingerprint)
+	if err != nil {
+		return 0, err
+	}
+	if len(decoded) != 4 {
+		return 0, fmt.Errorf("invalid fingerprint %v; expecting 4 bytes", fingerprint)
+	}
+	return binary.LittleEndian.Uint32(decoded), nil
+}
+
+// SignPsbt adds key path signatures to each unsigned input of 'packet' using both of the wallet's mnemonics.
+func SignPsbt(params *chaincfg.Params, wallet Wallet, packet *psbt.Packet) error {
+	fingerprint, err := walletFingerprint(params, wallet.GetFirstMnemonic())
+	if err != nil {
+		return err
+	}
+	fetcher, err := psbtPrevOutFetcher(packet)
+	if err != nil {
+		return err
+	}
+	derivers := newAddressDerivers(params, wallet)
+	for index := range packet.Inputs {
+		input := &packet.Inputs[index]
+		if len(input.FinalScriptWitness) > 0 || len(input.TaprootKeySpendSig) > 0 {
+			continue
+		}
+		derivation, err := psbtDerivation(params, input, fingerprint)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", index, err)
+		}
+		deriver, err := derivers.forDerivation(derivation)
+		if err != nil {
+			return err
+		}
+		firstKey, secondKey, err := deriver.bip44KeysAt(derivation.Index)
+		if err != nil {
+			return err
+		}
+		firstPrivateKey, err := firstKey.GetPrivateKey()
+		if err != nil {
+			return err
+		}
+		secondPrivateKey, err := secondKey.GetPrivateKey()
+		if err != nil {
+			return err
+		}
+		address, _, tweakedPrivateKey, merkleRoot, _, err := createTweakedAddress(params, GetWalletConfig(wallet).Timelock, secondPrivateKey, firstPrivateKey)
+		if err != nil {
+			return err
+		}
+		if err = checkPsbtInputScript(input, address.ScriptAddress()); err != nil {
+			return fmt.Errorf("input %d: %w", index, err)
+		}
+		signer := NewInMemorySigner(tweakedPrivateKey)
+		witness, _, err := signer.TaprootSign(fetcher, packet.UnsignedTx, txscript.SigHashDefault, index, merkleRoot)
+		if err != nil {
+			return err
+		}
+		input.TaprootKeySpendSig = (*witness)[0]
+	}
+	return nil
+}
+
+// SignRecoveryPsbt adds timelock script path signatures to each unsigned input of 'packet'. The 'packet' must have
+// been created via TransactionInfo.ToRecoveryPsbt.
+func SignRecoveryPsbt(params *chaincfg.Params, wallet RecoveryWallet, packet *psbt.Packet) error {
+	fingerprint, err := walletFingerprint(params, wallet.GetFirstMnemonic())
+	if err != nil {
+		return err
+	}
+	fetcher, err := psbtPrevOutFetcher(packet)
+	if err != nil {
+		return err
+	}
+	derivers := newAddressDerivers(params, wallet)
+	for index := range packet.Inputs {
+		input := &packet.Inputs[index]
+		if len(input.FinalScriptWitness) > 0 || len(input.TaprootScriptSpendSig) > 0 {
+			continue
+		}
+		if packet.UnsignedTx.TxIn[index].Sequence != GetWalletConfig(wallet).Timelock {
+			return fmt.Errorf("input %d: sequence %d does not match timelock %d", index,
+				packet.UnsignedTx.TxIn[index].Sequence, GetWalletConfig(wallet).Timelock)
+		}
+		derivation, err := psbtDerivation(params, input, fingerprint)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", index, err)
+		}
+		deriver, err := derivers.forDerivation(derivation)
+		if err != nil {
+			return err
+		}
+		firstPrivateKey, secondPublicKey, err := deriver.keysAt(derivation.Index)
+		if err != nil {
+			return err
+		}
+		address, _, _, tapscriptData, err := createTweakedAddressFromPublicKey(params, GetWalletConfig(wallet).Timelock, secondPublicKey, firstPrivateKey)
+		if err != nil {
+			return err
+		}
+		if err = checkPsbtInputScript(input, address.ScriptAddress()); err != nil {
+			return fmt.Errorf("input %d: %w", index, err)
+		}
+		leafKey, err := GetTaprootAddress(firstPrivateKey.PubKey(), params)
+		if err != nil {
+			return err
+		}
+		signer := NewInMemorySigner(firstPrivateKey)
+		witness, _, err := signer.TapscriptSign(fetcher, packet.UnsignedTx, txscript.SigHashDefault, index, tapscriptData)
+		if err != nil {
+			return err
+		}
+		leafHash := tapscriptData.Leaf.TapHash()
+		input.TaprootScriptSpendSig = append(input.TaprootScriptSpendSig, &psbt.TaprootScriptSpendSig{
+			XOnlyPubKey: leafKey.ScriptAddress(),
+			LeafHash:    leafHash[:],
+			Signature:   (*witness)[0],
+			SigHash:     txscript.SigHashDefault,
+		})
+	}
+	return nil
+}
+
+func walletFingerprint(params *chaincfg.Params, mnemonic string) (uint32, error) {
+	key, err := getBip44Key(mnemonic, params, 0)
+	if err != nil {
+		return 0, err
+	}
+	return fingerprintToUint32(key.GetFingerprint())
+}
+
+// psbtDerivation returns the Leafy address derivation of 'input' from its taproot derivation matching 'fingerprint'
+func psbtDerivation(params *chaincfg.Params, input *psbt.PInput, fingerprint uint32) (AddressDerivation, error) {
+	for _, derivation := range input.TaprootBip32Derivation {
+		if derivation.MasterKeyFingerprint != fingerprint || len(derivation.Bip32Path) != 5 {
+			continue
+		}
+		chain := derivation.Bip32Path[3]
+		if chain != ExternalChain && chain != InternalChain {
+			return AddressDerivation{}, fmt.Errorf("unsupported derivation chain %d", chain)
+		}
+		legacy := params.HDCoinType != legacyCoinType && derivation.Bip32Path[1] == PathHardened(legacyCoinType).path
+		return AddressDerivation{Chain: chain, Index: derivation.Bip32Path[4], Legacy: legacy}, nil
+	}
+	return AddressDerivation{}, fmt.Errorf("failed to find derivation for fingerprint %08x", fingerprint)
+}
+
+func checkPsbtInputScript(input *psbt.PInput, witnessProgram []byte) error {
+	if input.WitnessUtxo == nil {
+		return fmt.Errorf("missing witness utxo")
+	}
+	if !txscript.IsPayToTaproot(input.WitnessUtxo.PkScript) ||
+		!bytes.Equal(input.WitnessUtxo.PkScript[2:], witnessProgram) {
+		return fmt.Errorf("derived address does not match witness utxo script %x", input.WitnessUtxo.PkScript)
+	}
+	return nil
+}
+
+func psbtPrevOutFetcher(packet *psbt.Packet) (*txscript.MultiPrevOutFetcher, error) {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for index, txin := range packet.UnsignedTx.TxIn {
+		witnessUtxo := packet.Inputs[index].WitnessUtxo
+		if witnessUtxo == nil {
+			return nil, fmt.Errorf("input %d: missing witness utxo", index)
+		}
+		fetcher.AddPrevOut(txin.PreviousOutPoint, witnessUtxo)
+	}
+	return fetcher, nil
+}
+
+// CombinePsbts merges the signatures and taproot fields of 'packets' into a new PSBT. All 'packets' must be for
+// the same unsigned transaction.
+func CombinePsbts(packets ...*psbt.Packet) (*psbt.Packet, error) {
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("no psbts to combine")
+	}
+	combined, err := copyPsbt(packets[0])
+	if err != nil {
+		return nil, err
+	}
+	txHash := combined.UnsignedTx.TxHash()
+	for _, packet := range packets[1:] {
+		if packet.UnsignedTx.TxHash() != txHash {
+			return nil, fmt.Errorf("cannot combine psbts for different transactions %v and %v", txHash,
+				packet.UnsignedTx.TxHash())
+		}
+		for index := range packet.Inputs {
+			combinePsbtInput(&combined.Inputs[index], &packet.Inputs[index])
+		}
+	}
+	return combined, nil
+}
+
+func combinePsbtInput(into *psbt.PInput, from *psbt.PInput) {
+	if into.WitnessUtxo == nil {
+		into.WitnessUtxo = from.WitnessUtxo
+	}
+	if len(into.FinalScriptWitness) == 0 {
+		into.FinalScriptWitness = from.FinalScriptWitness
+	}
+	if len(into.TaprootKeySpendSig) == 0 {
+		into.TaprootKeySpendSig = from.TaprootKeySpendSig
+	}
+	if len(into.TaprootInternalKey) == 0 {
+		into.TaprootInternalKey = from.TaprootInternalKey
+	}
+	if len(into.TaprootMerkleRoot) == 0 {
+		into.TaprootMerkleRoot = from.TaprootMerkleRoot
+	}
+outerSig:
+	for _, sig := range from.TaprootScriptSpendSig {
+		for _, existing := range into.TaprootScriptSpendSig {
+			if existing.EqualKey(sig) {
+				continue outerSig
+			}
+		}
+		into.TaprootScriptSpendSig = append(into.TaprootScriptSpendSig, sig)
+	}
+outerLeaf:
+	for _, leaf := range from.TaprootLeafScript {
+		for _, existing := range into.TaprootLeafScript {
+			if bytes.Equal(existing.ControlBlock, leaf.ControlBlock) {
+				continue outerLeaf
+			}
+		}
+		into.TaprootLeafScript = append(into.TaprootLeafScript, leaf)
+	}
+outerDerivation:
+	for _, derivation := range from.TaprootBip32Derivation {
+		for _, existing := range into.TaprootBip32Derivation {
+			if bytes.Equal(existing.XOnlyPubKey, derivation.XOnlyPubKey) {
+				continue outerDerivation
+			}
+		}
+		into.TaprootBip32Derivation = append(into.TaprootBip32Derivation, derivation)
+	}
+}
+
+func copyPsbt(packet *psbt.Packet) (*psbt.Packet, error) {
+	var buf bytes.Buffer
+	if err := packet.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return psbt.NewFromRawBytes(&buf, false)
+}
+
+// FinalizePsbt finalizes each input of 'packet' (which is modified) and extracts the signed transaction.
+func FinalizePsbt(packet *psbt.Packet) (*SignedMsg, error) {
+	if err := psbt.MaybeFinalizeAll(packet); err != nil {
+		return nil, err
+	}
+	msgTx, err := psbt.Extract(packet)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, msgTx.SerializeSize()))
+	if err = msgTx.Serialize(buf); err != nil {
+		return nil, err
+	}
+	return &SignedMsg{
+		Msg: msgTx,
+		Hex: hex.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// EncodePsbt serializes 'packet' as base64 in the provided 'version'
+func EncodePsbt(packet *psbt.Packet, version PsbtVersion) (string, error) {
+	var buf bytes.Buffer
+	if err := packet.Serialize(&buf); err != nil {
+		return "", err
+	}
+	raw := buf.Bytes()
+	switch version {
+	case PsbtV0:
+	case PsbtV2:
+		var err error
+		if raw, err = convertPsbtV0ToV2(raw); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported psbt version %d", version)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// DecodePsbt deserializes the base64 'encoded' PSBT, returning the PSBT and its version
+func DecodePsbt(encoded string) (*psbt.Packet, PsbtVersion, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, err
+	}
+	version, err := psbtRawVersion(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch version {
+	case PsbtV0:
+	case PsbtV2:
+		if raw, err = convertPsbtV2ToV0(raw); err != nil {
+			return nil, 0, err
+		}
+	default:
+		return nil, 0, fmt.Errorf("unsupported psbt version %d", version)
+	}
+	packet, err := psbt.NewFromRawBytes(bytes.NewReader(raw), false)
+	if err != nil {
+		return nil, 0, err
+	}
+	return packet, version, nil
+}
@@ -0,0 +1,204 @@
+package leafy_test
+
+import (
+	"encoding/hex"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestPsbtSignAndFinalize(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, destAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+
+	tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	packet, err := tx.ToPsbt(params, wallet)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(packet.Inputs))
+	for _, input := range packet.Inputs {
+		require.NotNil(t, input.WitnessUtxo)
+		require.Equal(t, 32, len(input.TaprootInternalKey))
+		require.Equal(t, 32, len(input.TaprootMerkleRoot))
+		require.Equal(t, 1, len(input.TaprootLeafScript))
+		require.Equal(t, 2, len(input.TaprootBip32Derivation))
+	}
+
+	// round trip both versions
+	for _, version := range []leafy.PsbtVersion{leafy.PsbtV0, leafy.PsbtV2} {
+		encoded, err := leafy.EncodePsbt(packet, version)
+		require.NoError(t, err)
+		decoded, decodedVersion, err := leafy.DecodePsbt(encoded)
+		require.NoError(t, err)
+		require.Equal(t, version, decodedVersion)
+		require.Equal(t, packet.UnsignedTx.TxHash(), decoded.UnsignedTx.TxHash())
+		reencoded, err := leafy.EncodePsbt(decoded, version)
+		require.NoError(t, err)
+		require.Equal(t, encoded, reencoded)
+	}
+
+	// unsigned cannot be finalized
+	encoded, err := leafy.EncodePsbt(packet, leafy.PsbtV0)
+	require.NoError(t, err)
+	unsigned, _, err := leafy.DecodePsbt(encoded)
+	require.NoError(t, err)
+	_, err = leafy.FinalizePsbt(unsigned)
+	require.Error(t, err)
+
+	err = leafy.SignPsbt(params, wallet, packet)
+	require.NoError(t, err)
+	combined, err := leafy.CombinePsbts(unsigned, packet)
+	require.NoError(t, err)
+	signed, err := leafy.FinalizePsbt(combined)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+}
+
+func TestRecoveryPsbtSignAndFinalize(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, destAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(wallet.GetFirstMnemonic(), descriptor)
+
+	tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 0, 2)
+	require.NoError(t, err)
+
+	// key path psbt cannot be signed via recovery
+	packet, err := tx.ToPsbt(params, recoveryWallet)
+	require.NoError(t, err)
+	err = leafy.SignRecoveryPsbt(params, recoveryWallet, packet)
+	require.Error(t, err)
+
+	packet, err = tx.ToRecoveryPsbt(params, recoveryWallet)
+	require.NoError(t, err)
+	for _, txin := range packet.UnsignedTx.TxIn {
+		require.EqualValues(t, leafy.DefaultTimelock, txin.Sequence)
+	}
+	encoded, err := leafy.EncodePsbt(packet, leafy.PsbtV2)
+	require.NoError(t, err)
+	decoded, _, err := leafy.DecodePsbt(encoded)
+	require.NoError(t, err)
+	err = leafy.SignRecoveryPsbt(params, recoveryWallet, decoded)
+	require.NoError(t, err)
+	signed, err := leafy.FinalizePsbt(decoded)
+	require.NoError(t, err)
+	for _, txin := range signed.Msg.TxIn {
+		require.Equal(t, 3, len(txin.Witness))
+	}
+	requireValidWitnesses(t, signed.Msg, utxos)
+}
+
+func TestCombinePsbtsMismatch(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	utxos, destAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+
+	one, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 1000, 2)
+	require.NoError(t, err)
+	two, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 2000, 2)
+	require.NoError(t, err)
+	packetOne, err := one.ToPsbt(params, wallet)
+	require.NoError(t, err)
+	packetTwo, err := two.ToPsbt(params, wallet)
+	require.NoError(t, err)
+	_, err = leafy.CombinePsbts(packetOne, packetTwo)
+	require.Error(t, err)
+	_, err = leafy.CombinePsbts()
+	require.Error(t, err)
+}
+
+func TestDecodePsbtInvalid(t *testing.T) {
+	_, _, err := leafy.DecodePsbt("not base64!")
+	require.Error(t, err)
+	_, _, err = leafy.DecodePsbt("cHNidP8=")
+	require.Error(t, err)
+}
+
+// createWalletUtxos creates (unconfirmed, fake) utxos for 'amounts' paying to the first addresses of 'wallet' and
+// returns them along with the next unused address of the wallet
+func createWalletUtxos(t *testing.T, params *chaincfg.Params, wallet leafy.RecoveryWallet, amounts ...int64) ([]leafy.Utxo, btcutil.Address) {
+	t.Helper()
+	addresses, err := leafy.GetAddresses(params, wallet, 0, uint8(len(amounts)+1))
+	require.NoError(t, err)
+	utxos := make([]leafy.Utxo, 0, len(amounts))
+	for index, amount := range amounts {
+		address, err := btcutil.DecodeAddress(addresses[index], params)
+		require.NoError(t, err)
+		script, err := txscript.PayToAddrScript(address)
+		require.NoError(t, err)
+		utxos = append(utxos, leafy.Utxo{
+			FromAddress: addresses[index],
+			Outpoint: wire.OutPoint{
+				Hash:  chainhash.DoubleHashH([]byte(addresses[index])),
+				Index: uint32(index),
+			},
+			Amount: amount,
+			Script: hex.EncodeToString(script),
+		})
+	}
+	destAddress, err := btcutil.DecodeAddress(addresses[len(amounts)], params)
+	require.NoError(t, err)
+	return utxos, destAddress
+}
+
+// requireValidWitnesses executes the script of each input of 'msgTx' against the 'utxos' it spends
+func requireValidWitnesses(t *testing.T, msgTx *wire.MsgTx, utxos []leafy.Utxo) {
+	t.Helper()
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for _, utxo := range utxos {
+		script, err := utxo.DecodeScript()
+		require.NoError(t, err)
+		fetcher.AddPrevOut(utxo.Outpoint, wire.NewTxOut(utxo.Amount, script))
+	}
+	sigHashes := txscript.NewTxSigHashes(msgTx, fetcher)
+	for index, txin := range msgTx.TxIn {
+		prevOut := fetcher.FetchPrevOutput(txin.PreviousOutPoint)
+		require.NotNil(t, prevOut)
+		engine, err := txscript.NewEngine(prevOut.PkScript, msgTx, index, txscript.StandardVerifyFlags, nil,
+			sigHashes, prevOut.Value, fetcher)
+		require.NoError(t, err)
+		require.NoError(t, engine.Execute())
+	}
+}
+
+func TestPsbtChangeChain(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	accountDescriptor, err := leafy.GetAccountDescriptor(params, seedMnemonic)
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(seedMnemonic, accountDescriptor)
+	utxos := []leafy.Utxo{
+		indexedUtxo(t, params, wallet, 1, 10000),
+		chainUtxo(t, params, wallet, leafy.InternalChain, 2, 20000),
+	}
+	destAddress, err := btcutil.DecodeAddress(utxos[0].FromAddress, params)
+	require.NoError(t, err)
+
+	tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	packet, err := tx.ToPsbt(params, wallet)
+	require.NoError(t, err)
+	require.NoError(t, leafy.SignPsbt(params, wallet, packet))
+	signed, err := leafy.FinalizePsbt(packet)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+
+	tx, err = leafy.CreateRecoveryTransaction(utxos, destAddress, destAddress, 15000, 2)
+	require.NoError(t, err)
+	packet, err = tx.ToRecoveryPsbt(params, recoveryWallet)
+	require.NoError(t, err)
+	require.NoError(t, leafy.SignRecoveryPsbt(params, recoveryWallet, packet))
+	signed, err = leafy.FinalizePsbt(packet)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+}
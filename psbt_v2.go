@@ -0,0 +1,325 @@
+package leafy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"io"
+	"sort"
+)
+
+// the btcd psbt package only supports version 0; version 2 (BIP-370) is handled by converting the serialized
+// key-value maps to and from version 0.
+
+var psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+const (
+	psbtGlobalUnsignedTx     = 0x00
+	psbtGlobalTxVersion      = 0x02
+	psbtGlobalFallbackLock   = 0x03
+	psbtGlobalInputCount     = 0x04
+	psbtGlobalOutputCount    = 0x05
+	psbtGlobalTxModifiable   = 0x06
+	psbtGlobalVersion        = 0xfb
+	psbtInPreviousTxid       = 0x0e
+	psbtInOutputIndex        = 0x0f
+	psbtInSequence           = 0x10
+	psbtInRequiredTimeLock   = 0x11
+	psbtInRequiredHeightLock = 0x12
+	psbtOutAmount            = 0x03
+	psbtOutScript            = 0x04
+	psbtMaxValueLength       = 4000000
+)
+
+type psbtKeyValue struct {
+	key   []byte
+	value []byte
+}
+
+type psbtMap []psbtKeyValue
+
+func (m psbtMap) get(keyType byte) ([]byte, bool) {
+	for _, kv := range m {
+		if len(kv.key) == 1 && kv.key[0] == keyType {
+			return kv.value, true
+		}
+	}
+	return nil, false
+}
+
+func (m psbtMap) without(keyTypes ...byte) psbtMap {
+	filtered := make(psbtMap, 0, len(m))
+outer:
+	for _, kv := range m {
+		for _, keyType := range keyTypes {
+			if kv.key[0] == keyType {
+				continue outer
+			}
+		}
+		filtered = append(filtered, kv)
+	}
+	return filtered
+}
+
+func (m psbtMap) with(keyType byte, value []byte) psbtMap {
+	return append(m, psbtKeyValue{key: []byte{keyType}, value: value})
+}
+
+func readPsbtMap(r io.Reader) (psbtMap, error) {
+	m := make(psbtMap, 0)
+	for {
+		key, err := wire.ReadVarBytes(r, 0, psbtMaxValueLength, "psbt key")
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return m, nil
+		}
+		value, err := wire.ReadVarBytes(r, 0, psbtMaxValueLength, "psbt value")
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, psbtKeyValue{key: key, value: value})
+	}
+}
+
+func writePsbtMap(w io.Writer, m psbtMap) error {
+	sorted := make(psbtMap, len(m))
+	copy(sorted, m)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].key, sorted[j].key) < 0
+	})
+	for _, kv := range sorted {
+		if err := wire.WriteVarBytes(w, 0, kv.key); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(w, 0, kv.value); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0x00})
+	return err
+}
+
+func readPsbtMagic(r io.Reader) error {
+	magic := make([]byte, len(psbtMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return err
+	}
+	if !bytes.Equal(magic, psbtMagic) {
+		return fmt.Errorf("invalid psbt magic bytes %x", magic)
+	}
+	return nil
+}
+
+func psbtRawVersion(raw []byte) (PsbtVersion, error) {
+	r := bytes.NewReader(raw)
+	if err := readPsbtMagic(r); err != nil {
+		return 0, err
+	}
+	global, err := readPsbtMap(r)
+	if err != nil {
+		return 0, err
+	}
+	version, found := global.get(psbtGlobalVersion)
+	if !found {
+		return PsbtV0, nil
+	}
+	if len(version) != 4 {
+		return 0, fmt.Errorf("invalid psbt version length %d", len(version))
+	}
+	return PsbtVersion(binary.LittleEndian.Uint32(version)), nil
+}
+
+func uint32Bytes(value uint32) []byte {
+	serialized := make([]byte, 4)
+	binary.LittleEndian.PutUint32(serialized, value)
+	return serialized
+}
+
+func varIntBytes(value uint64) []byte {
+	var buf bytes.Buffer
+	_ = wire.WriteVarInt(&buf, 0, value)
+	return buf.Bytes()
+}
+
+func convertPsbtV0ToV2(raw []byte) ([]byte, error) {
+	r := bytes.NewReader(raw)
+	if err := readPsbtMagic(r); err != nil {
+		return nil, err
+	}
+	global, err := readPsbtMap(r)
+	if err != nil {
+		return nil, err
+	}
+	serializedTx, found := global.get(psbtGlobalUnsignedTx)
+	if !found {
+		return nil, fmt.Errorf("psbt v0 missing unsigned transaction")
+	}
+	msgTx := wire.NewMsgTx(2)
+	if err = msgTx.DeserializeNoWitness(bytes.NewReader(serializedTx)); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+	global = global.without(psbtGlobalUnsignedTx, psbtGlobalVersion).
+		with(psbtGlobalTxVersion, uint32Bytes(uint32(msgTx.Version))).
+		with(psbtGlobalFallbackLock, uint32Bytes(msgTx.LockTime)).
+		with(psbtGlobalInputCount, varIntBytes(uint64(len(msgTx.TxIn)))).
+		with(psbtGlobalOutputCount, varIntBytes(uint64(len(msgTx.TxOut)))).
+		with(psbtGlobalVersion, uint32Bytes(uint32(PsbtV2)))
+	if err = writePsbtMap(&buf, global); err != nil {
+		return nil, err
+	}
+	for _, txin := range msgTx.TxIn {
+		input, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+		input = input.with(psbtInPreviousTxid, txin.PreviousOutPoint.Hash[:]).
+			with(psbtInOutputIndex, uint32Bytes(txin.PreviousOutPoint.Index)).
+			with(psbtInSequence, uint32Bytes(txin.Sequence))
+		if err = writePsbtMap(&buf, input); err != nil {
+			return nil, err
+		}
+	}
+	for _, txout := range msgTx.TxOut {
+		output, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+		amount := make([]byte, 8)
+		binary.LittleEndian.PutUint64(amount, uint64(txout.Value))
+		output = output.with(psbtOutAmount, amount).
+			with(psbtOutScript, txout.PkScript)
+		if err = writePsbtMap(&buf, output); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func convertPsbtV2ToV0(raw []byte) ([]byte, error) {
+	r := bytes.NewReader(raw)
+	if err := readPsbtMagic(r); err != nil {
+		return nil, err
+	}
+	global, err := readPsbtMap(r)
+	if err != nil {
+		return nil, err
+	}
+	txVersion, err := requiredPsbtUint32(global, psbtGlobalTxVersion, "global tx version")
+	if err != nil {
+		return nil, err
+	}
+	var lockTime uint32
+	if value, found := global.get(psbtGlobalFallbackLock); found {
+		if len(value) != 4 {
+			return nil, fmt.Errorf("invalid psbt fallback locktime length %d", len(value))
+		}
+		lockTime = binary.LittleEndian.Uint32(value)
+	}
+	inputCount, err := requiredPsbtVarInt(global, psbtGlobalInputCount, "global input count")
+	if err != nil {
+		return nil, err
+	}
+	outputCount, err := requiredPsbtVarInt(global, psbtGlobalOutputCount, "global output count")
+	if err != nil {
+		return nil, err
+	}
+	msgTx := wire.NewMsgTx(int32(txVersion))
+	msgTx.LockTime = lockTime
+	inputs := make([]psbtMap, 0)
+	for i := uint64(0); i < inputCount; i++ {
+		input, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := input.get(psbtInRequiredTimeLock); found {
+			return nil, fmt.Errorf("psbt v2 input %d: required time locktime is unsupported", i)
+		}
+		if _, found := input.get(psbtInRequiredHeightLock); found {
+			return nil, fmt.Errorf("psbt v2 input %d: required height locktime is unsupported", i)
+		}
+		txid, found := input.get(psbtInPreviousTxid)
+		if !found {
+			return nil, fmt.Errorf("psbt v2 input %d: missing previous txid", i)
+		}
+		hash, err := chainhash.NewHash(txid)
+		if err != nil {
+			return nil, err
+		}
+		outputIndex, err := requiredPsbtUint32(input, psbtInOutputIndex, "input output index")
+		if err != nil {
+			return nil, err
+		}
+		sequence := wire.MaxTxInSequenceNum
+		if value, found := input.get(psbtInSequence); found {
+			if len(value) != 4 {
+				return nil, fmt.Errorf("invalid psbt input sequence length %d", len(value))
+			}
+			sequence = binary.LittleEndian.Uint32(value)
+		}
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: *hash, Index: outputIndex},
+			Sequence:         sequence,
+		})
+		inputs = append(inputs, input.without(psbtInPreviousTxid, psbtInOutputIndex, psbtInSequence))
+	}
+	outputs := make([]psbtMap, 0)
+	for i := uint64(0); i < outputCount; i++ {
+		output, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+		amount, found := output.get(psbtOutAmount)
+		if !found || len(amount) != 8 {
+			return nil, fmt.Errorf("psbt v2 output %d: missing or invalid amount", i)
+		}
+		script, found := output.get(psbtOutScript)
+		if !found {
+			return nil, fmt.Errorf("psbt v2 output %d: missing script", i)
+		}
+		msgTx.AddTxOut(wire.NewTxOut(int64(binary.LittleEndian.Uint64(amount)), script))
+		outputs = append(outputs, output.without(psbtOutAmount, psbtOutScript))
+	}
+	var txBuf bytes.Buffer
+	if err = msgTx.SerializeNoWitness(&txBuf); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+	global = global.without(psbtGlobalTxVersion, psbtGlobalFallbackLock, psbtGlobalInputCount,
+		psbtGlobalOutputCount, psbtGlobalTxModifiable, psbtGlobalVersion).
+		with(psbtGlobalUnsignedTx, txBuf.Bytes())
+	if err = writePsbtMap(&buf, global); err != nil {
+		return nil, err
+	}
+	for _, m := range append(inputs, outputs...) {
+		if err = writePsbtMap(&buf, m); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func requiredPsbtUint32(m psbtMap, keyType byte, name string) (uint32, error) {
+	value, found := m.get(keyType)
+	if !found {
+		return 0, fmt.Errorf("psbt v2 missing %s", name)
+	}
+	if len(value) != 4 {
+		return 0, fmt.Errorf("invalid psbt %s length %d", name, len(value))
+	}
+	return binary.LittleEndian.Uint32(value), nil
+}
+
+func requiredPsbtVarInt(m psbtMap, keyType byte, name string) (uint64, error) {
+	value, found := m.get(keyType)
+	if !found {
+		return 0, fmt.Errorf("psbt v2 missing %s", name)
+	}
+	return wire.ReadVarInt(bytes.NewReader(value), 0)
+}
@@ -0,0 +1,196 @@
+package leafy
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// IncrementalRelayFeeRate is the fee rate (in sat/vByte) by which a replacement must, at least, pay for its own
+// size on top of the fees of the transaction it replaces (BIP-125 rule 4); Bitcoin Core's default.
+const IncrementalRelayFeeRate = 1
+
+// BumpFee replaces the unconfirmed 'original' transaction with one paying 'feeRate' and signs it via the key path.
+// See CreateFeeBumpTransaction.
+func BumpFee(
+	params *chaincfg.Params,
+	wallet Wallet,
+	original *wire.MsgTx,
+	prevouts []Utxo,
+	additional []Utxo,
+	changeAddr btcutil.Address,
+	feeRate float64,
+) (*SignedMsg, error) {
+	tx, err := CreateFeeBumpTransaction(original, prevouts, additional, changeAddr, feeRate, KeyPathSpend)
+	if err != nil {
+		return nil, err
+	}
+	return SignTransaction(params, wallet, tx)
+}
+
+// BumpRecoveryFee replaces the unconfirmed 'original' transaction with one paying 'feeRate' and signs it via the
+// timelock script path. See CreateFeeBumpTransaction.
+func BumpRecoveryFee(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	original *wire.MsgTx,
+	prevouts []Utxo,
+	additional []Utxo,
+	changeAddr btcutil.Address,
+	feeRate float64,
+) (*SignedMsg, error) {
+	tx, err := createFeeBumpTransaction(original, prevouts, additional, changeAddr, feeRate, RecoveryPathSpend,
+		GetWalletConfig(wallet).Timelock)
+	if err != nil {
+		return nil, err
+	}
+	return SignRecoveryTransaction(params, wallet, tx)
+}
+
+// CreateFeeBumpTransaction constructs a replacement (BIP-125) of the signed 'original' transaction paying 'feeRate'
+// (in sat/vByte). The 'prevouts' are the utxos spent by 'original', all of which are spent by the replacement.
+// The output paying to 'changeAddr' (if any) is reduced to pay the additional fee; if that is insufficient, the
+// confirmed utxos of 'additional' are added in order (unconfirmed ones cannot be used per BIP-125 rule 2) and change,
+// if not dust, is paid to 'changeAddr'. All other outputs of 'original' are kept as is. It is an error for more than
+// one output to pay to 'changeAddr' as which is the change, and not a recipient, is then ambiguous.
+//
+// The replacement pays at least the absolute fee of 'original' plus IncrementalRelayFeeRate for its own size and its
+// fee rate must be higher than that of 'original'. The fees are estimated for signing via 'path', the recovery path
+// being that of the DefaultWalletConfig's timelock.
+func CreateFeeBumpTransaction(
+	original *wire.MsgTx,
+	prevouts []Utxo,
+	additional []Utxo,
+	changeAddr btcutil.Address,
+	feeRate float64,
+	path SpendPath,
+) (*TransactionInfo, error) {
+	return createFeeBumpTransaction(original, prevouts, additional, changeAddr, feeRate, path, 0)
+}
+
+func createFeeBumpTransaction(
+	original *wire.MsgTx,
+	prevouts []Utxo,
+	additional []Utxo,
+	changeAddr btcutil.Address,
+	feeRate float64,
+	path SpendPath,
+	timelock uint32,
+) (*TransactionInfo, error) {
+	if feeRate <= 0 {
+		return nil, fmt.Errorf("invalid fee rate; should be >= 0")
+	}
+	changeScript, err := txscript.PayToAddrScript(changeAddr)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := originalInputs(original, prevouts)
+	if err != nil {
+		return nil, err
+	}
+	var inputAmount int64
+	for _, input := range inputs {
+		inputAmount += input.Amount
+	}
+	var outputAmount int64
+	for _, output := range original.TxOut {
+		outputAmount += output.Value
+	}
+	originalFee := inputAmount - outputAmount
+	if originalFee < 0 {
+		return nil, fmt.Errorf("original transaction outputs %d exceed its inputs %d", outputAmount, inputAmount)
+	}
+	originalWeight := blockchain.GetTransactionWeight(btcutil.NewTx(original))
+	originalVSize := (originalWeight + (blockchain.WitnessScaleFactor - 1)) / blockchain.WitnessScaleFactor
+	if feeRate <= float64(originalFee)/float64(originalVSize) {
+		return nil, fmt.Errorf("fee rate %.2f must be higher than the original fee rate %.2f", feeRate,
+			float64(originalFee)/float64(originalVSize))
+	}
+	// the outputs which are kept as is; the change output is re-valued (and kept in its position)
+	changeIndex := -1
+	outputs := make([]*wire.TxOut, 0, len(original.TxOut)+1)
+	var fixedAmount int64
+	estimator := &WeightEstimator{Timelock: timelock}
+	for index, output := range original.TxOut {
+		outputs = append(outputs, wire.NewTxOut(output.Value, output.PkScript))
+		if string(output.PkScript) == string(changeScript) {
+			if changeIndex >= 0 {
+				return nil, fmt.Errorf("outputs %d and %d both pay to the change address; the change is ambiguous",
+					changeIndex, index)
+			}
+			changeIndex = index
+			continue
+		}
+		fixedAmount += output.Value
+		estimator.AddOutput(output.PkScript)
+	}
+	for range inputs {
+		estimator.AddLeafyInput(path)
+	}
+	confirmed := make([]Utxo, 0, len(additional))
+	for _, utxo := range additional {
+		if utxo.BlockHeight > 0 {
+			confirmed = append(confirmed, utxo)
+		}
+	}
+	requiredFee := func(estimator *WeightEstimator) int64 {
+		fee := estimator.Fee(feeRate)
+		if replacementFee := originalFee + feeForWeight(estimator.Weight(), IncrementalRelayFeeRate); replacementFee > fee {
+			return replacementFee
+		}
+		return fee
+	}
+	for {
+		withChange := *estimator
+		withChange.AddOutput(changeScript)
+		change := inputAmount - fixedAmount - requiredFee(&withChange)
+		if change > P2trDustAmt {
+			if changeIndex < 0 {
+				changeIndex = len(outputs)
+				outputs = append(outputs, wire.NewTxOut(change, changeScript))
+			} else {
+				outputs[changeIndex].Value = change
+			}
+			return newTransactionInfo(inputs, outputs, inputAmount-fixedAmount-change, change, path, timelock)
+		}
+		if excess := inputAmount - fixedAmount - requiredFee(estimator); excess >= 0 {
+			// change would be dust (or not possible), leave the excess to the fee
+			if changeIndex >= 0 {
+				outputs = append(outputs[:changeIndex], outputs[changeIndex+1:]...)
+			}
+			return newTransactionInfo(inputs, outputs, inputAmount-fixedAmount, 0, path, timelock)
+		}
+		if len(confirmed) == 0 {
+			return nil, fmt.Errorf("insufficient funds to bump fee; need %d have %d", fixedAmount+requiredFee(estimator),
+				inputAmount)
+		}
+		inputs = append(inputs, confirmed[0])
+		inputAmount += confirmed[0].Amount
+		confirmed = confirmed[1:]
+		estimator.AddLeafyInput(path)
+	}
+}
+
+// originalInputs orders 'prevouts' by the inputs of 'original', ensuring each input has its prevout
+func originalInputs(original *wire.MsgTx, prevouts []Utxo) ([]Utxo, error) {
+	byOutpoint := make(map[wire.OutPoint]Utxo, len(prevouts))
+	for _, prevout := range prevouts {
+		byOutpoint[prevout.Outpoint] = prevout
+	}
+	inputs := make([]Utxo, 0, len(original.TxIn))
+	for _, txin := range original.TxIn {
+		if txin.Sequence >= wire.MaxTxInSequenceNum-1 {
+			return nil, fmt.Errorf("original transaction input %s does not signal replaceability",
+				txin.PreviousOutPoint.String())
+		}
+		prevout, found := byOutpoint[txin.PreviousOutPoint]
+		if !found {
+			return nil, fmt.Errorf("failed to find prevout for outpoint %s", txin.PreviousOutPoint.String())
+		}
+		inputs = append(inputs, prevout)
+	}
+	return inputs, nil
+}
@@ -0,0 +1,127 @@
+package leafy_test
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestBumpFee(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, changeAddress := createWalletUtxos(t, params, wallet, 10000, 20000, 30000)
+	destination, _ := createBatchAddresses(t, params)
+
+	original, err := leafy.CreateAndSignTransaction(params, wallet, utxos[:2], changeAddress, destination, 15000, 2)
+	require.NoError(t, err)
+	originalFee := requireFee(t, original.Msg, utxos)
+
+	// lower (or equal) fee rate
+	_, err = leafy.BumpFee(params, wallet, original.Msg, utxos[:2], nil, changeAddress, 2)
+	require.Error(t, err)
+	// missing prevout
+	_, err = leafy.BumpFee(params, wallet, original.Msg, utxos[:1], nil, changeAddress, 10)
+	require.Error(t, err)
+
+	bumped, err := leafy.BumpFee(params, wallet, original.Msg, utxos[:2], nil, changeAddress, 10)
+	require.NoError(t, err)
+	require.Equal(t, len(original.Msg.TxIn), len(bumped.Msg.TxIn))
+	for index, txin := range bumped.Msg.TxIn {
+		require.Equal(t, original.Msg.TxIn[index].PreviousOutPoint, txin.PreviousOutPoint)
+	}
+	require.Equal(t, 2, len(bumped.Msg.TxOut))
+	require.Equal(t, original.Msg.TxOut[0], bumped.Msg.TxOut[0])
+	require.True(t, bumped.Msg.TxOut[1].Value < original.Msg.TxOut[1].Value)
+	requireValidWitnesses(t, bumped.Msg, utxos)
+	requireReplacementFee(t, bumped.Msg, utxos, originalFee, 10)
+
+	// a recipient paid to the change address is not mistaken for change
+	ambiguous, err := leafy.CreateAndSignTransaction(params, wallet, utxos[:2], changeAddress, changeAddress, 15000, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ambiguous.Msg.TxOut))
+	_, err = leafy.BumpFee(params, wallet, ambiguous.Msg, utxos[:2], nil, changeAddress, 10)
+	require.ErrorContains(t, err, "change is ambiguous")
+}
+
+func TestBumpFeeAddsInputs(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, changeAddress := createWalletUtxos(t, params, wallet, 10000, 20000, 30000)
+	destination, _ := createBatchAddresses(t, params)
+
+	original, err := leafy.CreateAndSignTransaction(params, wallet, utxos[:2], changeAddress, destination, 29000, 2)
+	require.NoError(t, err)
+	originalFee := requireFee(t, original.Msg, utxos)
+
+	// unconfirmed utxos cannot be added
+	_, err = leafy.BumpFee(params, wallet, original.Msg, utxos[:2], utxos[2:], changeAddress, 20)
+	require.Error(t, err)
+
+	utxos[2].BlockHeight = 100
+	bumped, err := leafy.BumpFee(params, wallet, original.Msg, utxos[:2], utxos[2:], changeAddress, 20)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(bumped.Msg.TxIn))
+	require.Equal(t, 2, len(bumped.Msg.TxOut))
+	require.Equal(t, original.Msg.TxOut[0], bumped.Msg.TxOut[0])
+	requireValidWitnesses(t, bumped.Msg, utxos)
+	requireReplacementFee(t, bumped.Msg, utxos, originalFee, 20)
+}
+
+func TestBumpRecoveryFee(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, changeAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+	destination, _ := createBatchAddresses(t, params)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(wallet.GetFirstMnemonic(), descriptor)
+
+	original, err := leafy.CreateAndSignRecoveryTransaction(params, recoveryWallet, utxos, changeAddress, destination, 15000, 2)
+	require.NoError(t, err)
+	originalFee := requireFee(t, original.Msg, utxos)
+
+	bumped, err := leafy.BumpRecoveryFee(params, recoveryWallet, original.Msg, utxos, nil, changeAddress, 5)
+	require.NoError(t, err)
+	for _, txin := range bumped.Msg.TxIn {
+		require.EqualValues(t, leafy.DefaultTimelock, txin.Sequence)
+		require.Equal(t, 3, len(txin.Witness))
+	}
+	requireValidWitnesses(t, bumped.Msg, utxos)
+	requireReplacementFee(t, bumped.Msg, utxos, originalFee, 5)
+}
+
+// requireFee returns the fee paid by 'msgTx' spending (a subset of) 'utxos'
+func requireFee(t *testing.T, msgTx *wire.MsgTx, utxos []leafy.Utxo) int64 {
+	t.Helper()
+	var fee int64
+	for _, txin := range msgTx.TxIn {
+		found := false
+		for _, utxo := range utxos {
+			if utxo.Outpoint == txin.PreviousOutPoint {
+				fee += utxo.Amount
+				found = true
+			}
+		}
+		require.True(t, found)
+	}
+	for _, txout := range msgTx.TxOut {
+		fee -= txout.Value
+	}
+	return fee
+}
+
+// requireReplacementFee asserts 'replacement' pays 'feeRate' and satisfies BIP-125 rules 3 and 4
+func requireReplacementFee(t *testing.T, replacement *wire.MsgTx, utxos []leafy.Utxo, originalFee int64, feeRate int64) {
+	t.Helper()
+	fee := requireFee(t, replacement, utxos)
+	vSize := (blockchain.GetTransactionWeight(btcutil.NewTx(replacement)) + 3) / 4
+	require.True(t, fee >= feeRate*vSize)
+	require.True(t, fee >= originalFee+leafy.IncrementalRelayFeeRate*vSize)
+}
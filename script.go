@@ -17,6 +17,29 @@ type Utxo struct {
 	Outpoint    wire.OutPoint
 	Amount      int64
 	Script      string
+	// BlockHeight is the height of the block confirming the utxo, zero if unconfirmed or unknown
+	BlockHeight int64 `json:",omitempty"`
+	// DerivationIndex is, optionally, the derivation index of the Leafy address of Script. When present, signing
+	// derives the keys of this index directly (validating them against Script) rather than searching for them.
+	DerivationIndex *uint32 `json:",omitempty"`
+	// DerivationChain is the chain of DerivationIndex, ExternalChain (the default) or InternalChain
+	DerivationChain uint32 `json:",omitempty"`
+	// SpendPath is, optionally, the path via which the utxo must be spent; a transaction spending it via the other
+	// path is an error
+	SpendPath *SpendPath `json:",omitempty"`
+}
+
+// WithDerivation returns a copy of the utxo carrying its ExternalChain derivation 'index' and 'path'
+func (u Utxo) WithDerivation(index uint32, path SpendPath) Utxo {
+	return u.WithChainDerivation(ExternalChain, index, path)
+}
+
+// WithChainDerivation is like WithDerivation for an address of 'chain'
+func (u Utxo) WithChainDerivation(chain uint32, index uint32, path SpendPath) Utxo {
+	u.DerivationChain = chain
+	u.DerivationIndex = &index
+	u.SpendPath = &path
+	return u
 }
 
 type SpentInput struct {
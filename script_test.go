@@ -3,7 +3,9 @@ package leafy_test
 import (
 	"crypto/sha256"
 	"encoding/binary"
+	"encoding/json"
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/btcutil/base58"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -212,3 +214,51 @@ func verifyEndCSV(t *testing.T, csvScript []byte, timelockOp byte) {
 	require.EqualValues(t, txscript.OP_CHECKSEQUENCEVERIFY, csvScript[len(csvScript)-1])
 	require.EqualValues(t, timelockOp, csvScript[len(csvScript)-2])
 }
+
+func TestUtxoDerivation(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(seedMnemonic, descriptor)
+
+	// JSON form, as used by the mobile api
+	utxo := indexedUtxo(t, params, wallet, 5000, 20000).WithDerivation(5000, leafy.RecoveryPathSpend)
+	serialized, err := json.Marshal(utxo)
+	require.NoError(t, err)
+	require.Contains(t, string(serialized), `"DerivationIndex":5000,"SpendPath":"recovery"`)
+	var deserialized leafy.Utxo
+	require.NoError(t, json.Unmarshal(serialized, &deserialized))
+	require.Equal(t, utxo, deserialized)
+	serialized, err = json.Marshal(indexedUtxo(t, params, wallet, 1, 20000))
+	require.NoError(t, err)
+	require.NotContains(t, string(serialized), "DerivationIndex")
+	require.Error(t, json.Unmarshal([]byte(`{"SpendPath":"other"}`), &deserialized))
+
+	// beyond the scan limit, without an indexer
+	destAddress, err := btcutil.DecodeAddress(utxo.FromAddress, params)
+	require.NoError(t, err)
+	utxos := []leafy.Utxo{utxo, indexedUtxo(t, params, wallet, 3, 10000)}
+	recoveryTx, err := leafy.CreateRecoveryTransaction(utxos, destAddress, destAddress, 25000, 2)
+	require.NoError(t, err)
+	signed, err := leafy.SignRecoveryTransaction(params, recoveryWallet, recoveryTx)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+
+	// the spend path must match
+	_, err = leafy.CreateTransaction(utxos, destAddress, destAddress, 25000, 2)
+	require.Error(t, err)
+	utxos[0] = utxos[0].WithDerivation(5000, leafy.KeyPathSpend)
+	tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, 25000, 2)
+	require.NoError(t, err)
+	signed, err = leafy.SignTransaction(params, wallet, tx)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+
+	// the index is validated against the script
+	utxos[0] = utxos[0].WithDerivation(5001, leafy.KeyPathSpend)
+	tx, err = leafy.CreateTransaction(utxos, destAddress, destAddress, 25000, 2)
+	require.NoError(t, err)
+	_, err = leafy.SignTransaction(params, wallet, tx)
+	require.Error(t, err)
+}
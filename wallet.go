@@ -1,12 +1,102 @@
 package leafy
 
-import "github.com/btcsuite/btcd/chaincfg"
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// PurposeBip44 is the BIP-44 purpose of a wallet's keys, by default
+	PurposeBip44 uint32 = 44
+	// PurposeBip86 is the BIP-86 purpose of a wallet's keys if configured with WalletConfig.Bip86
+	PurposeBip86 uint32 = 86
+)
+
+// WalletConfig is the configuration of a Leafy wallet which, along with its mnemonics, determines its addresses
+type WalletConfig struct {
+	// Timelock is the relative timelock, in blocks, of the recovery path; see ValidateTimelock
+	Timelock uint32
+	// Account is the BIP-44 account, hardened, of both seeds' addresses; see ValidateAccount
+	Account uint32
+	// LegacyCoinType derives the BIP-44 coin type 0' on every network, as Leafy did before deriving it from the
+	// network (SLIP-44); only wallets created then, on a test network, need it. See DiscoverLegacyCoinType.
+	LegacyCoinType bool
+	// Bip86 derives with the BIP-86 purpose 86' rather than 44'. The key path only addresses of each seed's keys
+	// alone, see GetSingleSeedAddresses, are then those of a BIP-86 wallet.
+	Bip86 bool
+}
+
+// CoinType is the BIP-44 coin type, hardened, of the addresses on 'params'
+func (c *WalletConfig) CoinType(params *chaincfg.Params) uint32 {
+	return coinType(params, c.LegacyCoinType)
+}
+
+// Purpose is the purpose, hardened, of the wallet's keys; PurposeBip44 or PurposeBip86
+func (c *WalletConfig) Purpose() uint32 {
+	if c.Bip86 {
+		return PurposeBip86
+	}
+	return PurposeBip44
+}
+
+// accountPath is the accountPath of the wallet's keys on 'params', of the legacy coin type if 'legacy'
+func (c *WalletConfig) accountPath(params *chaincfg.Params, legacy bool) accountPath {
+	return accountPath{purpose: c.Purpose(), coinType: coinType(params, legacy), account: c.Account}
+}
+
+// DefaultWalletConfig is the configuration of wallets created without one
+func DefaultWalletConfig() *WalletConfig {
+	return &WalletConfig{
+		Timelock: DefaultTimelock,
+	}
+}
+
+// Validate returns an error if the configuration is invalid
+func (c *WalletConfig) Validate() error {
+	return errors.Join(ValidateTimelock(c.Timelock), ValidateAccount(c.Account))
+}
+
+// ValidateTimelock returns an error if 'timelock' is not a valid [BIP-68](https://github.com/bitcoin/bips/blob/master/bip-0068.mediawiki)
+// block based relative timelock; i.e. it must be non-zero and fit within the sequence's 16 bit value, without the
+// disable or time based flags.
+func ValidateTimelock(timelock uint32) error {
+	if timelock == 0 || timelock > wire.SequenceLockTimeMask {
+		return fmt.Errorf("invalid timelock [%d], must be between 1 and %d blocks", timelock, wire.SequenceLockTimeMask)
+	}
+	return nil
+}
+
+// ValidateAccount returns an error if 'account' cannot be a hardened BIP-32 derivation
+func ValidateAccount(account uint32) error {
+	if account >= hdkeychain.HardenedKeyStart {
+		return fmt.Errorf("invalid account [%d], must be less than %d", account, hdkeychain.HardenedKeyStart)
+	}
+	return nil
+}
 
 type RecoveryWallet interface {
 	GetFirstMnemonic() string
 	GetSecondDescriptor(*chaincfg.Params) (string, error)
 }
 
+// ConfiguredWallet is a wallet with a WalletConfig, as are those created by this package; see GetWalletConfig
+type ConfiguredWallet interface {
+	GetConfig() *WalletConfig
+}
+
+// GetWalletConfig returns the WalletConfig of 'wallet' if it is a ConfiguredWallet, otherwise the DefaultWalletConfig
+func GetWalletConfig(wallet RecoveryWallet) *WalletConfig {
+	if configured, ok := wallet.(ConfiguredWallet); ok {
+		if config := configured.GetConfig(); config != nil {
+			return config
+		}
+	}
+	return DefaultWalletConfig()
+}
+
 type Wallet interface {
 	RecoveryWallet
 	GetSecondMnemonic() string
@@ -15,30 +105,57 @@ type Wallet interface {
 type normalWallet struct {
 	firstMnemonic  string
 	secondMnemonic string
+	config         *WalletConfig
 }
 
 func (w *normalWallet) GetFirstMnemonic() string {
 	return w.firstMnemonic
 }
 
+// GetSecondDescriptor returns the multipath descriptor of the second seed's account, covering both its ExternalChain
+// and InternalChain; see GetAccountDescriptor
 func (w *normalWallet) GetSecondDescriptor(params *chaincfg.Params) (string, error) {
-	return GetDescriptor(params, w.secondMnemonic)
+	bip44Key, err := getBip44AccountKey(w.secondMnemonic, params, w.config.accountPath(params, w.config.LegacyCoinType),
+		ExternalChain, 0)
+	if err != nil {
+		return "", err
+	}
+	return bip44Key.GetTaprootAccountDescriptorWithoutChecksum()
 }
 
 func (w *normalWallet) GetSecondMnemonic() string {
 	return w.secondMnemonic
 }
 
+func (w *normalWallet) GetConfig() *WalletConfig {
+	return w.config
+}
+
 func NewWallet(firstMnemonic, secondMnemonic string) Wallet {
 	return &normalWallet{
 		firstMnemonic:  firstMnemonic,
 		secondMnemonic: secondMnemonic,
+		config:         DefaultWalletConfig(),
 	}
 }
 
+// NewWalletWithConfig is NewWallet with a validated 'config'
+func NewWalletWithConfig(firstMnemonic, secondMnemonic string, config *WalletConfig) (Wallet, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	configCopy := *config
+	return &normalWallet{
+		firstMnemonic:  firstMnemonic,
+		secondMnemonic: secondMnemonic,
+		config:         &configCopy,
+	}, nil
+}
+
 type recoveryWallet struct {
 	firstMnemonic    string
 	secondDescriptor string
+	config           *WalletConfig
 }
 
 func (w *recoveryWallet) GetFirstMnemonic() string {
@@ -49,15 +166,71 @@ func (w *recoveryWallet) GetSecondDescriptor(_ *chaincfg.Params) (string, error)
 	return w.secondDescriptor, nil
 }
 
+func (w *recoveryWallet) GetConfig() *WalletConfig {
+	return w.config
+}
+
 func NewRecoveryWallet(firstMnemonic, secondDescriptor string) RecoveryWallet {
 	return &recoveryWallet{
 		firstMnemonic:    firstMnemonic,
 		secondDescriptor: secondDescriptor,
+		config:           DefaultWalletConfig(),
+	}
+}
+
+// NewRecoveryWalletWithConfig is NewRecoveryWallet with a validated 'config'
+func NewRecoveryWalletWithConfig(firstMnemonic, secondDescriptor string, config *WalletConfig) (RecoveryWallet, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	configCopy := *config
+	return &recoveryWallet{
+		firstMnemonic:    firstMnemonic,
+		secondDescriptor: secondDescriptor,
+		config:           &configCopy,
+	}, nil
+}
+
+// WalletForAccount returns a copy of 'wallet' whose configuration is for BIP-44 'account'
+func WalletForAccount(wallet Wallet, account uint32) (Wallet, error) {
+	config := *GetWalletConfig(wallet)
+	config.Account = account
+	return NewWalletWithConfig(wallet.GetFirstMnemonic(), wallet.GetSecondMnemonic(), &config)
+}
+
+// LegacyCoinTypeWallet returns a copy of 'wallet' configured with LegacyCoinType
+func LegacyCoinTypeWallet(wallet Wallet) (Wallet, error) {
+	config := *GetWalletConfig(wallet)
+	config.LegacyCoinType = true
+	return NewWalletWithConfig(wallet.GetFirstMnemonic(), wallet.GetSecondMnemonic(), &config)
+}
+
+// RecoveryWalletForAccount returns a copy of 'wallet' whose configuration is for BIP-44 'account'. Unless 'wallet'
+// is a Wallet, its second descriptor must be of 'account' (as returned by GetDescriptorForAccount), as the account
+// of the second seed cannot otherwise be derived.
+func RecoveryWalletForAccount(params *chaincfg.Params, wallet RecoveryWallet, account uint32) (RecoveryWallet, error) {
+	if fullWallet, ok := wallet.(Wallet); ok {
+		return WalletForAccount(fullWallet, account)
 	}
+	secondDescriptor, err := wallet.GetSecondDescriptor(params)
+	if err != nil {
+		return nil, err
+	}
+	config := *GetWalletConfig(wallet)
+	config.Account = account
+	return NewRecoveryWalletWithConfig(wallet.GetFirstMnemonic(), secondDescriptor, &config)
 }
 
 // CreateNewWallet creates two hdkeychain.RecommendedSeedLen length seeds and their associated BIP-39 mnemonics.
 func CreateNewWallet() (Wallet, error) {
+	return CreateNewWalletWithConfig(DefaultWalletConfig())
+}
+
+// CreateNewWalletWithConfig is CreateNewWallet with a validated 'config'
+func CreateNewWalletWithConfig(config *WalletConfig) (Wallet, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	first, err := GenerateMnemonic()
 	if err != nil {
 		return nil, err
@@ -66,5 +239,5 @@ func CreateNewWallet() (Wallet, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewWallet(first, second), nil
+	return NewWalletWithConfig(first, second, config)
 }
@@ -0,0 +1,453 @@
+package leafy
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"sort"
+	"strings"
+)
+
+// resyncConfirmations are the confirmations, as of a checkpoint, below which Resync queries the transactions of an
+// address even if its status is unchanged, as a status need not reflect a transaction's replacement or reorganization
+const resyncConfirmations = 6
+
+// TransactionKind classifies a transaction relative to a wallet
+type TransactionKind string
+
+const (
+	// TransactionIncoming funds the wallet without spending from it
+	TransactionIncoming TransactionKind = "incoming"
+	// TransactionOutgoing spends from the wallet to addresses of others
+	TransactionOutgoing TransactionKind = "outgoing"
+	// TransactionSelfTransfer spends from the wallet only to its own addresses
+	TransactionSelfTransfer TransactionKind = "self-transfer"
+	// TransactionRecovery spends from the wallet via the recovery (timelocked script) path
+	TransactionRecovery TransactionKind = "recovery"
+)
+
+// WalletTransaction is a ChainTransaction of a wallet along with its effect on the wallet
+type WalletTransaction struct {
+	ChainTransaction
+	Kind TransactionKind
+	// Received is the amount of the outputs to the wallet and Sent that of the wallet's outputs spent
+	Received int64
+	Sent     int64
+}
+
+// Net is the change in the wallet's balance due to the transaction
+func (t *WalletTransaction) Net() int64 {
+	return t.Received - t.Sent
+}
+
+// WalletBalance is the sum of a wallet's utxos; Unconfirmed are those not yet in a block
+type WalletBalance struct {
+	Confirmed   int64
+	Unconfirmed int64
+}
+
+// Total is the sum of the confirmed and unconfirmed balance
+func (b WalletBalance) Total() int64 {
+	return b.Confirmed + b.Unconfirmed
+}
+
+// ChainSyncState is the discovered usage of the addresses of a chain
+type ChainSyncState struct {
+	// Used is true if any address has history, in which case HighestUsedIndex is the highest such index
+	Used             bool
+	HighestUsedIndex uint32
+	NextUnusedIndex  uint32
+}
+
+// WalletSyncCheckpoint is the state persisted between syncs from which WalletSync.Resync continues
+type WalletSyncCheckpoint struct {
+	TipHeight int64
+	External  ChainSyncState
+	Internal  ChainSyncState
+	// TxIds are those of the wallet's transactions as of the checkpoint
+	TxIds []string
+	// Addresses are the used addresses, if synced from an AddressStatusLookup, and Transactions the wallet's
+	// transactions; Resync reuses those of the addresses whose status is unchanged rather than querying them
+	Addresses    map[string]AddressSyncState `json:",omitempty"`
+	Transactions []ChainTransaction          `json:",omitempty"`
+}
+
+// AddressSyncState is the status of a used address, see AddressStatusLookup, and the txids of its transactions
+type AddressSyncState struct {
+	Status string
+	TxIds  []string
+}
+
+// WalletSnapshot is the state of a wallet as of a sync. Its Utxos carry their derivation and so may be passed as is
+// to CreateAndSignTransaction (or, serialized as JSON, to MobileCreateAndSignTransaction).
+type WalletSnapshot struct {
+	TipHeight int64
+	Balance   WalletBalance
+	// Utxos are ordered by height, unconfirmed last
+	Utxos []Utxo
+	// Transactions are ordered unconfirmed first and then confirmed from the newest
+	Transactions []WalletTransaction
+	External     ChainSyncState
+	Internal     ChainSyncState
+	// NewTxIds are those of transactions not in the checkpoint resynced from and DroppedTxIds those of the
+	// checkpoint no longer known, i.e. replaced, evicted or reorganized out
+	NewTxIds     []string `json:",omitempty"`
+	DroppedTxIds []string `json:",omitempty"`
+	// Checkpoint is to be persisted for the next Resync
+	Checkpoint *WalletSyncCheckpoint
+}
+
+// WalletSync syncs the state of a wallet from a ChainBackend
+type WalletSync struct {
+	params   *chaincfg.Params
+	wallet   RecoveryWallet
+	backend  ChainBackend
+	gapLimit uint32
+}
+
+// NewWalletSync creates a WalletSync of 'wallet' from 'backend', discovering the addresses of both chains with
+// 'gapLimit'; see DiscoverAddresses
+func NewWalletSync(
+	params *chaincfg.Params,
+	wallet RecoveryWallet,
+	backend ChainBackend,
+	gapLimit uint32,
+) (*WalletSync, error) {
+	if gapLimit < 1 {
+		return nil, fmt.Errorf("invalid gap limit [%d], must be greater than 0", gapLimit)
+	}
+	return &WalletSync{params: params, wallet: wallet, backend: backend, gapLimit: gapLimit}, nil
+}
+
+// Sync syncs the wallet from scratch
+func (s *WalletSync) Sync() (*WalletSnapshot, error) {
+	return s.Resync(nil)
+}
+
+// Resync syncs the wallet from 'checkpoint', a prior snapshot's Checkpoint, or from scratch if nil. Addresses
+// through the checkpoint's highest used indices are synced even if beyond the gap limit of those unused, and the
+// snapshot reports the transactions new and dropped since the checkpoint. If the backend is an AddressStatusLookup,
+// only the transactions of addresses whose status changed since the checkpoint are queried. A chain which the
+// wallet's second descriptor does not cover, see ErrChainNotCovered, is not synced and its state left empty.
+func (s *WalletSync) Resync(checkpoint *WalletSyncCheckpoint) (*WalletSnapshot, error) {
+	tipHeight, err := s.backend.TipHeight()
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint != nil && checkpoint.TipHeight > tipHeight {
+		return nil, fmt.Errorf("checkpoint at height %d is beyond the tip %d", checkpoint.TipHeight, tipHeight)
+	}
+	state := &walletSyncState{scripts: map[string]syncedAddress{}, txs: map[string]ChainTransaction{}}
+	var knownExternal, knownInternal *ChainSyncState
+	if checkpoint != nil {
+		knownExternal, knownInternal = &checkpoint.External, &checkpoint.Internal
+		state.checkpoint = checkpoint
+		state.checkpointTxs = make(map[string]ChainTransaction, len(checkpoint.Transactions))
+		for _, tx := range checkpoint.Transactions {
+			state.checkpointTxs[tx.TxId] = tx
+		}
+	}
+	if _, ok := s.backend.(AddressStatusLookup); ok {
+		state.addresses = map[string]AddressSyncState{}
+	}
+	external, err := s.syncChain(ExternalChain, knownExternal, state)
+	if err != nil {
+		return nil, err
+	}
+	internal, err := s.syncChain(InternalChain, knownInternal, state)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &WalletSnapshot{
+		TipHeight:    tipHeight,
+		Utxos:        state.utxos(),
+		Transactions: state.walletTransactions(),
+		External:     external,
+		Internal:     internal,
+	}
+	for _, utxo := range snapshot.Utxos {
+		if utxo.BlockHeight > 0 {
+			snapshot.Balance.Confirmed += utxo.Amount
+		} else {
+			snapshot.Balance.Unconfirmed += utxo.Amount
+		}
+	}
+	txIds := make([]string, len(snapshot.Transactions))
+	for i, tx := range snapshot.Transactions {
+		txIds[i] = tx.TxId
+	}
+	snapshot.NewTxIds = txIds
+	if checkpoint != nil {
+		snapshot.NewTxIds, snapshot.DroppedTxIds = diffTxIds(checkpoint.TxIds, txIds)
+	}
+	snapshot.Checkpoint = &WalletSyncCheckpoint{TipHeight: tipHeight, External: external, Internal: internal,
+		TxIds: txIds, Addresses: state.addresses}
+	if state.addresses != nil {
+		snapshot.Checkpoint.Transactions = make([]ChainTransaction, len(snapshot.Transactions))
+		for i, tx := range snapshot.Transactions {
+			snapshot.Checkpoint.Transactions[i] = tx.ChainTransaction
+		}
+	}
+	return snapshot, nil
+}
+
+type syncedAddress struct {
+	address    string
+	derivation AddressDerivation
+}
+
+type walletSyncState struct {
+	// scripts are the hex encoded scripts of the used addresses
+	scripts map[string]syncedAddress
+	txs     map[string]ChainTransaction
+	// addresses are the used addresses synced, if the backend is an AddressStatusLookup
+	addresses     map[string]AddressSyncState
+	checkpoint    *WalletSyncCheckpoint
+	checkpointTxs map[string]ChainTransaction
+}
+
+// syncChain queries the transactions of the addresses of 'chain' through those 'known' to be used and then until
+// the gap limit of unused addresses
+func (s *WalletSync) syncChain(chain uint32, known *ChainSyncState, state *walletSyncState) (ChainSyncState, error) {
+	deriver, err := newAddressDeriver(s.params, s.wallet, addressBranch{chain: chain})
+	if errors.Is(err, ErrChainNotCovered) {
+		return ChainSyncState{}, nil
+	} else if err != nil {
+		return ChainSyncState{}, err
+	}
+	knownCount := uint32(0)
+	if known != nil && known.Used {
+		knownCount = known.HighestUsedIndex + 1
+	}
+	var result ChainSyncState
+	unused := uint32(0)
+	for index := uint32(0); index < knownCount || unused < s.gapLimit; index++ {
+		if index >= hdkeychain.HardenedKeyStart {
+			return ChainSyncState{}, fmt.Errorf("exhausted address indices at %d", index)
+		}
+		script, err := deriver.scriptAt(index)
+		if err != nil {
+			return ChainSyncState{}, err
+		}
+		_, addresses, _, err := txscript.ExtractPkScriptAddrs(script, s.params)
+		if err != nil {
+			return ChainSyncState{}, err
+		}
+		address := addresses[0].EncodeAddress()
+		txs, err := s.addressTransactions(address, state)
+		if err != nil {
+			return ChainSyncState{}, err
+		}
+		if len(txs) == 0 {
+			unused++
+			continue
+		}
+		unused = 0
+		result.Used = true
+		result.HighestUsedIndex = index
+		state.scripts[hex.EncodeToString(script)] = syncedAddress{address: address,
+			derivation: AddressDerivation{Chain: chain, Index: index, Legacy: deriver.legacy}}
+		for _, tx := range txs {
+			state.txs[tx.TxId] = tx
+		}
+	}
+	if result.Used {
+		result.NextUnusedIndex = result.HighestUsedIndex + 1
+	}
+	return result, nil
+}
+
+// addressTransactions queries the transactions of 'address' unless the backend is an AddressStatusLookup and the
+// address' status is unchanged since the checkpoint
+func (s *WalletSync) addressTransactions(address string, state *walletSyncState) ([]ChainTransaction, error) {
+	lookup, ok := s.backend.(AddressStatusLookup)
+	if !ok {
+		return s.backend.AddressTransactions(address)
+	}
+	status, err := lookup.AddressStatus(address)
+	if err != nil || status == "" {
+		return nil, err
+	}
+	txs, ok := state.checkpointed(address, status)
+	if !ok {
+		if txs, err = s.backend.AddressTransactions(address); err != nil {
+			return nil, err
+		}
+	}
+	txIds := make([]string, len(txs))
+	for i, tx := range txs {
+		txIds[i] = tx.TxId
+	}
+	state.addresses[address] = AddressSyncState{Status: status, TxIds: txIds}
+	return txs, nil
+}
+
+// checkpointed returns the checkpoint's transactions of 'address' if its status was 'status' and all of them had
+// resyncConfirmations
+func (s *walletSyncState) checkpointed(address string, status string) ([]ChainTransaction, bool) {
+	if s.checkpoint == nil {
+		return nil, false
+	}
+	previous, ok := s.checkpoint.Addresses[address]
+	if !ok || previous.Status != status {
+		return nil, false
+	}
+	txs := make([]ChainTransaction, len(previous.TxIds))
+	for i, txId := range previous.TxIds {
+		tx, ok := s.checkpointTxs[txId]
+		if !ok || !tx.Status.Confirmed || s.checkpoint.TipHeight-tx.Status.BlockHeight+1 < resyncConfirmations {
+			return nil, false
+		}
+		txs[i] = tx
+	}
+	return txs, true
+}
+
+func (s *walletSyncState) owned(script string) (syncedAddress, bool) {
+	owned, ok := s.scripts[strings.ToLower(script)]
+	return owned, ok
+}
+
+// utxos are the outputs to the wallet not spent by any of its transactions
+func (s *walletSyncState) utxos() []Utxo {
+	spent := map[wire.OutPoint]bool{}
+	for _, tx := range s.txs {
+		for _, input := range tx.Inputs {
+			spent[input.Outpoint] = true
+		}
+	}
+	var utxos []Utxo
+	for _, tx := range s.txs {
+		for index, output := range tx.Outputs {
+			owned, ok := s.owned(output.Script)
+			if !ok {
+				continue
+			}
+			hash, err := chainhash.NewHashFromStr(tx.TxId)
+			if err != nil {
+				continue
+			}
+			outpoint := wire.OutPoint{Hash: *hash, Index: uint32(index)}
+			if spent[outpoint] {
+				continue
+			}
+			derivationIndex := owned.derivation.Index
+			utxos = append(utxos, Utxo{
+				FromAddress:     owned.address,
+				Outpoint:        outpoint,
+				Amount:          output.Amount,
+				Script:          output.Script,
+				BlockHeight:     tx.Status.BlockHeight,
+				DerivationIndex: &derivationIndex,
+				DerivationChain: owned.derivation.Chain,
+			})
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		left, right := utxos[i], utxos[j]
+		if (left.BlockHeight == 0) != (right.BlockHeight == 0) {
+			return right.BlockHeight == 0
+		}
+		if left.BlockHeight != right.BlockHeight {
+			return left.BlockHeight < right.BlockHeight
+		}
+		if left.Outpoint.Hash != right.Outpoint.Hash {
+			return left.Outpoint.Hash.String() < right.Outpoint.Hash.String()
+		}
+		return left.Outpoint.Index < right.Outpoint.Index
+	})
+	return utxos
+}
+
+func (s *walletSyncState) walletTransactions() []WalletTransaction {
+	txs := make([]WalletTransaction, 0, len(s.txs))
+	for _, tx := range s.txs {
+		txs = append(txs, s.classify(tx))
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		left, right := txs[i].Status, txs[j].Status
+		if left.Confirmed != right.Confirmed {
+			return !left.Confirmed
+		}
+		if left.BlockHeight != right.BlockHeight {
+			return left.BlockHeight > right.BlockHeight
+		}
+		return txs[i].TxId < txs[j].TxId
+	})
+	return txs
+}
+
+func (s *walletSyncState) classify(tx ChainTransaction) WalletTransaction {
+	walletTx := WalletTransaction{ChainTransaction: tx}
+	spends, recovers, external := false, false, false
+	for _, input := range tx.Inputs {
+		if input.PrevOut == nil {
+			continue
+		}
+		if _, ok := s.owned(input.PrevOut.Script); !ok {
+			continue
+		}
+		spends = true
+		walletTx.Sent += input.PrevOut.Amount
+		if isScriptPathWitness(input.Witness) {
+			recovers = true
+		}
+	}
+	for _, output := range tx.Outputs {
+		if _, ok := s.owned(output.Script); ok {
+			walletTx.Received += output.Amount
+		} else {
+			external = true
+		}
+	}
+	switch {
+	case recovers:
+		walletTx.Kind = TransactionRecovery
+	case !spends:
+		walletTx.Kind = TransactionIncoming
+	case !external:
+		walletTx.Kind = TransactionSelfTransfer
+	default:
+		walletTx.Kind = TransactionOutgoing
+	}
+	return walletTx
+}
+
+// isScriptPathWitness is whether the hex encoded 'witness' of a taproot input spends via a script path (BIP-341),
+// i.e. has more than one item excluding any annex
+func isScriptPathWitness(witness []string) bool {
+	items := len(witness)
+	if items >= 2 && len(witness[items-1]) >= 2 && witness[items-1][:2] == "50" {
+		// annex
+		items--
+	}
+	return items >= 2
+}
+
+// diffTxIds returns the txids of 'current' not in 'previous' and those of 'previous' not in 'current'
+func diffTxIds(previous []string, current []string) ([]string, []string) {
+	previousSet := make(map[string]bool, len(previous))
+	for _, txId := range previous {
+		previousSet[txId] = true
+	}
+	currentSet := make(map[string]bool, len(current))
+	var added []string
+	for _, txId := range current {
+		currentSet[txId] = true
+		if !previousSet[txId] {
+			added = append(added, txId)
+		}
+	}
+	var dropped []string
+	for _, txId := range previous {
+		if !currentSet[txId] {
+			dropped = append(dropped, txId)
+		}
+	}
+	return added, dropped
+}
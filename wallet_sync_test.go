@@ -0,0 +1,343 @@
+package leafy_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"strings"
+	"testing"
+)
+
+// fakeChainBackend is a ChainBackend of transactions added by the test
+type fakeChainBackend struct {
+	tipHeight int64
+	txs       []leafy.ChainTransaction
+	added     int
+	queried   map[string]int
+}
+
+func (b *fakeChainBackend) AddressUtxos(string) ([]leafy.Utxo, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (b *fakeChainBackend) AddressTransactions(address string) ([]leafy.ChainTransaction, error) {
+	if b.queried == nil {
+		b.queried = map[string]int{}
+	}
+	b.queried[address]++
+	var txs []leafy.ChainTransaction
+	for _, tx := range b.txs {
+		involved := false
+		for _, input := range tx.Inputs {
+			involved = involved || (input.PrevOut != nil && input.PrevOut.Address == address)
+		}
+		for _, output := range tx.Outputs {
+			involved = involved || output.Address == address
+		}
+		if involved {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
+
+func (b *fakeChainBackend) TipHeight() (int64, error) {
+	return b.tipHeight, nil
+}
+
+func (b *fakeChainBackend) RecommendedFees() (*leafy.RecommendedFees, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (b *fakeChainBackend) Broadcast(*wire.MsgTx) (string, error) {
+	return "", fmt.Errorf("not implemented")
+}
+
+func (b *fakeChainBackend) TransactionStatus(string) (*leafy.TransactionStatus, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// fakeStatusBackend is a fakeChainBackend which is also an AddressStatusLookup
+type fakeStatusBackend struct {
+	*fakeChainBackend
+}
+
+func (b fakeStatusBackend) AddressStatus(address string) (string, error) {
+	var status strings.Builder
+	for _, tx := range b.txs {
+		for _, output := range tx.Outputs {
+			if output.Address == address {
+				_, _ = fmt.Fprintf(&status, "%s:%d:", tx.TxId, tx.Status.BlockHeight)
+			}
+		}
+	}
+	return status.String(), nil
+}
+
+// add adds a transaction at 'height' (0 if unconfirmed) spending 'inputs' (with 'witness') to 'outputs'
+func (b *fakeChainBackend) add(
+	height int64,
+	witness []string,
+	inputs []leafy.ChainTransactionInput,
+	outputs ...leafy.ChainTransactionOutput,
+) leafy.ChainTransaction {
+	b.added++
+	tx := leafy.ChainTransaction{TxId: fmt.Sprintf("%064x", b.added), Outputs: outputs}
+	if height > 0 {
+		tx.Status = leafy.TransactionStatus{Confirmed: true, BlockHeight: height, BlockHash: fmt.Sprintf("%064x", height)}
+	}
+	var in, out int64
+	for _, input := range inputs {
+		input.Witness = witness
+		tx.Inputs = append(tx.Inputs, input)
+		in += input.PrevOut.Amount
+	}
+	for _, output := range outputs {
+		out += output.Amount
+	}
+	tx.Fee = in - out
+	b.txs = append(b.txs, tx)
+	return tx
+}
+
+func spendOf(t *testing.T, tx leafy.ChainTransaction, index uint32) leafy.ChainTransactionInput {
+	hash, err := chainhash.NewHashFromStr(tx.TxId)
+	require.NoError(t, err)
+	prevOut := tx.Outputs[index]
+	return leafy.ChainTransactionInput{Outpoint: wire.OutPoint{Hash: *hash, Index: index}, PrevOut: &prevOut}
+}
+
+func outputTo(t *testing.T, params *chaincfg.Params, address string, amount int64) leafy.ChainTransactionOutput {
+	return leafy.ChainTransactionOutput{Script: hex.EncodeToString(addressScript(t, params, address)),
+		Address: address, Amount: amount}
+}
+
+func TestWalletSync(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	external, err := leafy.GetAddresses(params, wallet, 0, 12)
+	require.NoError(t, err)
+	internal, err := leafy.GetChainAddresses(params, wallet, leafy.InternalChain, 0, 3)
+	require.NoError(t, err)
+	otherMnemonic, err := leafy.GenerateMnemonic()
+	require.NoError(t, err)
+	others, err := leafy.GetAddresses(params, leafy.NewWallet(otherMnemonic, otherMnemonic), 0, 1)
+	require.NoError(t, err)
+	keyPath := []string{hex.EncodeToString(make([]byte, 64))}
+	scriptPath := []string{hex.EncodeToString(make([]byte, 64)), "20aa", "c0bb"}
+
+	backend := &fakeChainBackend{tipHeight: 110}
+	funding := backend.add(100, nil, []leafy.ChainTransactionInput{{PrevOut: &leafy.ChainTransactionOutput{
+		Address: others[0], Amount: 1_000_000}}},
+		outputTo(t, params, external[0], 100_000), outputTo(t, params, others[0], 899_000))
+	gapped := backend.add(101, nil, []leafy.ChainTransactionInput{spendOf(t, funding, 1)},
+		outputTo(t, params, external[3], 50_000), outputTo(t, params, others[0], 848_000))
+	outgoing := backend.add(105, keyPath, []leafy.ChainTransactionInput{spendOf(t, funding, 0)},
+		outputTo(t, params, others[0], 60_000), outputTo(t, params, internal[0], 39_000))
+	recovery := backend.add(106, scriptPath, []leafy.ChainTransactionInput{spendOf(t, outgoing, 1)},
+		outputTo(t, params, others[0], 38_500))
+	selfTransfer := backend.add(0, keyPath, []leafy.ChainTransactionInput{spendOf(t, gapped, 0)},
+		outputTo(t, params, internal[1], 49_500))
+	incoming := backend.add(0, nil, []leafy.ChainTransactionInput{spendOf(t, gapped, 1)},
+		outputTo(t, params, external[4], 10_000), outputTo(t, params, others[0], 837_000))
+
+	_, err = leafy.NewWalletSync(params, wallet, backend, 0)
+	require.ErrorContains(t, err, "invalid gap limit [0]")
+	walletSync, err := leafy.NewWalletSync(params, wallet, backend, 3)
+	require.NoError(t, err)
+	snapshot, err := walletSync.Sync()
+	require.NoError(t, err)
+
+	require.Equal(t, int64(110), snapshot.TipHeight)
+	require.Equal(t, leafy.ChainSyncState{Used: true, HighestUsedIndex: 4, NextUnusedIndex: 5}, snapshot.External)
+	require.Equal(t, leafy.ChainSyncState{Used: true, HighestUsedIndex: 1, NextUnusedIndex: 2}, snapshot.Internal)
+	require.Equal(t, leafy.WalletBalance{Confirmed: 0, Unconfirmed: 59_500}, snapshot.Balance)
+	require.Equal(t, int64(59_500), snapshot.Balance.Total())
+	// through the gap of each chain, and no further
+	require.Equal(t, 1, backend.queried[external[7]])
+	require.Zero(t, backend.queried[external[8]])
+	require.Equal(t, 1, backend.queried[internal[2]])
+
+	require.Len(t, snapshot.Utxos, 2)
+	require.Equal(t, internal[1], snapshot.Utxos[0].FromAddress)
+	require.Equal(t, uint32(1), *snapshot.Utxos[0].DerivationIndex)
+	require.Equal(t, leafy.InternalChain, snapshot.Utxos[0].DerivationChain)
+	require.Equal(t, int64(49_500), snapshot.Utxos[0].Amount)
+	require.Equal(t, int64(0), snapshot.Utxos[0].BlockHeight)
+	require.Equal(t, external[4], snapshot.Utxos[1].FromAddress)
+	require.Equal(t, uint32(4), *snapshot.Utxos[1].DerivationIndex)
+	require.Equal(t, leafy.ExternalChain, snapshot.Utxos[1].DerivationChain)
+
+	kinds := map[string]leafy.TransactionKind{}
+	for _, tx := range snapshot.Transactions {
+		kinds[tx.TxId] = tx.Kind
+	}
+	require.Equal(t, map[string]leafy.TransactionKind{
+		funding.TxId:      leafy.TransactionIncoming,
+		gapped.TxId:       leafy.TransactionIncoming,
+		outgoing.TxId:     leafy.TransactionOutgoing,
+		recovery.TxId:     leafy.TransactionRecovery,
+		selfTransfer.TxId: leafy.TransactionSelfTransfer,
+		incoming.TxId:     leafy.TransactionIncoming,
+	}, kinds)
+	// unconfirmed first and then confirmed from the newest
+	var order []string
+	for _, tx := range snapshot.Transactions {
+		order = append(order, tx.TxId)
+	}
+	require.Equal(t, []string{selfTransfer.TxId, incoming.TxId, recovery.TxId, outgoing.TxId, gapped.TxId,
+		funding.TxId}, order)
+	outgoingTx := snapshot.Transactions[3]
+	require.Equal(t, int64(100_000), outgoingTx.Sent)
+	require.Equal(t, int64(39_000), outgoingTx.Received)
+	require.Equal(t, int64(-61_000), outgoingTx.Net())
+	require.Equal(t, int64(1_000), outgoingTx.Fee)
+	require.Equal(t, int64(-500), snapshot.Transactions[0].Net())
+	require.Equal(t, order, snapshot.NewTxIds)
+	require.Empty(t, snapshot.DroppedTxIds)
+
+	// the snapshot's utxos are spendable as is
+	destination, err := btcutil.DecodeAddress(others[0], params)
+	require.NoError(t, err)
+	change, err := btcutil.DecodeAddress(internal[2], params)
+	require.NoError(t, err)
+	_, err = leafy.CreateAndSignTransaction(params, wallet, snapshot.Utxos, change, destination, 55_000, 2)
+	require.NoError(t, err)
+
+	// the JSON form round trips
+	serialized, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	require.Contains(t, string(serialized), `"Kind":"self-transfer"`)
+	var deserialized leafy.WalletSnapshot
+	require.NoError(t, json.Unmarshal(serialized, &deserialized))
+	require.Equal(t, snapshot, &deserialized)
+}
+
+func TestWalletResync(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	external, err := leafy.GetAddresses(params, wallet, 0, 12)
+	require.NoError(t, err)
+	funder := leafy.ChainTransactionInput{PrevOut: &leafy.ChainTransactionOutput{Address: "funder", Amount: 1_000_000}}
+
+	backend := &fakeChainBackend{tipHeight: 100}
+	first := backend.add(100, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[0], 10_000))
+	evicted := backend.add(0, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[1], 20_000))
+	walletSync, err := leafy.NewWalletSync(params, wallet, backend, 3)
+	require.NoError(t, err)
+	snapshot, err := walletSync.Sync()
+	require.NoError(t, err)
+	require.Equal(t, leafy.WalletBalance{Confirmed: 10_000, Unconfirmed: 20_000}, snapshot.Balance)
+	serialized, err := json.Marshal(snapshot.Checkpoint)
+	require.NoError(t, err)
+	var checkpoint leafy.WalletSyncCheckpoint
+	require.NoError(t, json.Unmarshal(serialized, &checkpoint))
+	require.Equal(t, []string{evicted.TxId, first.TxId}, checkpoint.TxIds)
+
+	backend.txs = backend.txs[:1]
+	backend.tipHeight = 102
+	second := backend.add(102, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[3], 30_000))
+	snapshot, err = walletSync.Resync(&checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, []string{second.TxId}, snapshot.NewTxIds)
+	require.Equal(t, []string{evicted.TxId}, snapshot.DroppedTxIds)
+	require.Equal(t, leafy.WalletBalance{Confirmed: 40_000}, snapshot.Balance)
+	require.Equal(t, leafy.ChainSyncState{Used: true, HighestUsedIndex: 3, NextUnusedIndex: 4}, snapshot.External)
+
+	// addresses through the checkpoint's highest used index are synced even if beyond the gap
+	beyondGap := backend.add(102, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[10], 5_000))
+	snapshot, err = walletSync.Sync()
+	require.NoError(t, err)
+	require.NotContains(t, snapshot.NewTxIds, beyondGap.TxId)
+	snapshot, err = walletSync.Resync(&leafy.WalletSyncCheckpoint{TipHeight: 102,
+		External: leafy.ChainSyncState{Used: true, HighestUsedIndex: 10, NextUnusedIndex: 11}})
+	require.NoError(t, err)
+	require.Contains(t, snapshot.NewTxIds, beyondGap.TxId)
+	require.Equal(t, uint32(10), snapshot.External.HighestUsedIndex)
+	require.Equal(t, int64(45_000), snapshot.Balance.Confirmed)
+
+	_, err = walletSync.Resync(&leafy.WalletSyncCheckpoint{TipHeight: 103})
+	require.ErrorContains(t, err, "checkpoint at height 103 is beyond the tip 102")
+}
+
+func TestWalletResyncQueriesChangedAddresses(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	external, err := leafy.GetAddresses(params, wallet, 0, 4)
+	require.NoError(t, err)
+	funder := leafy.ChainTransactionInput{PrevOut: &leafy.ChainTransactionOutput{Address: "funder", Amount: 1_000_000}}
+
+	backend := &fakeChainBackend{tipHeight: 110}
+	backend.add(100, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[0], 10_000))
+	recent := backend.add(110, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[1], 20_000))
+	walletSync, err := leafy.NewWalletSync(params, wallet, fakeStatusBackend{backend}, 2)
+	require.NoError(t, err)
+	snapshot, err := walletSync.Sync()
+	require.NoError(t, err)
+	serialized, err := json.Marshal(snapshot.Checkpoint)
+	require.NoError(t, err)
+	var checkpoint leafy.WalletSyncCheckpoint
+	require.NoError(t, json.Unmarshal(serialized, &checkpoint))
+	require.Len(t, checkpoint.Addresses, 2)
+	require.Equal(t, []string{recent.TxId}, checkpoint.Addresses[external[1]].TxIds)
+	require.Len(t, checkpoint.Transactions, 2)
+
+	backend.queried = nil
+	backend.tipHeight = 120
+	second := backend.add(120, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[2], 30_000))
+	snapshot, err = walletSync.Resync(&checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, []string{second.TxId}, snapshot.NewTxIds)
+	require.Empty(t, snapshot.DroppedTxIds)
+	require.Equal(t, leafy.WalletBalance{Confirmed: 60_000}, snapshot.Balance)
+	// the unchanged address is not queried, unlike that with a transaction of too few confirmations
+	require.Equal(t, map[string]int{external[1]: 1, external[2]: 1}, backend.queried)
+
+	// addresses no longer with history are dropped without querying their transactions
+	backend.queried = nil
+	backend.txs = backend.txs[:1]
+	snapshot, err = walletSync.Resync(snapshot.Checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, []string{second.TxId, recent.TxId}, snapshot.DroppedTxIds)
+	require.Equal(t, leafy.WalletBalance{Confirmed: 10_000}, snapshot.Balance)
+	require.Empty(t, backend.queried)
+}
+
+func TestRecoveryWalletSync(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet := leafy.NewWallet(seedMnemonic, seedMnemonic)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	external, err := leafy.GetAddresses(params, wallet, 0, 1)
+	require.NoError(t, err)
+	internal, err := leafy.GetChainAddresses(params, wallet, leafy.InternalChain, 0, 1)
+	require.NoError(t, err)
+	funder := leafy.ChainTransactionInput{PrevOut: &leafy.ChainTransactionOutput{Address: "funder", Amount: 1_000_000}}
+	backend := &fakeChainBackend{tipHeight: 100}
+	backend.add(100, nil, []leafy.ChainTransactionInput{funder}, outputTo(t, params, external[0], 10_000),
+		outputTo(t, params, internal[0], 20_000))
+
+	// the multipath descriptor covers both chains
+	walletSync, err := leafy.NewWalletSync(params, leafy.NewRecoveryWallet(seedMnemonic, descriptor), backend, 3)
+	require.NoError(t, err)
+	snapshot, err := walletSync.Sync()
+	require.NoError(t, err)
+	require.Equal(t, int64(30_000), snapshot.Balance.Confirmed)
+	require.True(t, snapshot.Internal.Used)
+
+	// a descriptor of the external chain alone syncs that chain only
+	walletSync, err = leafy.NewWalletSync(params, leafy.NewRecoveryWallet(seedMnemonic,
+		externalChainDescriptor(t, descriptor)), backend, 3)
+	require.NoError(t, err)
+	snapshot, err = walletSync.Sync()
+	require.NoError(t, err)
+	require.Equal(t, int64(10_000), snapshot.Balance.Confirmed)
+	require.Equal(t, leafy.ChainSyncState{Used: true, NextUnusedIndex: 1}, snapshot.External)
+	require.Equal(t, leafy.ChainSyncState{}, snapshot.Internal)
+}
@@ -0,0 +1,167 @@
+package leafy
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// txOverheadWeight is 4 * (version, input count, output count, locktime) plus the segwit marker and flag
+	txOverheadWeight = 4*(4+1+1+4) + 2
+	// p2trOutputWeight is 4 * (value, script length, script)
+	p2trOutputWeight = 4 * (8 + 1 + 34)
+	// txInNonWitnessWeight is 4 * (outpoint, script length, sequence)
+	txInNonWitnessWeight = 4 * (36 + 1 + 4)
+	// p2trKeyPathInputWeight is the non-witness input plus the witness (item count, signature length, signature)
+	p2trKeyPathInputWeight = txInNonWitnessWeight + (1 + 1 + 64)
+	// schnorrSignatureLen is the length of a SigHashDefault schnorr signature
+	schnorrSignatureLen = 64
+	// leafyControlBlockLen is the control block of the single leaf tapscript (leaf version and internal key,
+	// no merkle path)
+	leafyControlBlockLen = 1 + 32
+)
+
+// SpendPath is the way in which an input spends its Leafy address
+type SpendPath uint8
+
+const (
+	// KeyPathSpend spends via the taproot key path, requiring both mnemonics
+	KeyPathSpend SpendPath = iota
+	// RecoveryPathSpend spends via the timelock tapscript leaf, requiring the first mnemonic and second descriptor
+	RecoveryPathSpend
+)
+
+const (
+	keyPathSpendText      = "key"
+	recoveryPathSpendText = "recovery"
+)
+
+func (p SpendPath) String() string {
+	if p == RecoveryPathSpend {
+		return recoveryPathSpendText
+	}
+	return keyPathSpendText
+}
+
+// MarshalText encodes the path as "key" or "recovery"
+func (p SpendPath) MarshalText() ([]byte, error) {
+	if p != KeyPathSpend && p != RecoveryPathSpend {
+		return nil, fmt.Errorf("invalid spend path %d", p)
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes "key" or "recovery"
+func (p *SpendPath) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case keyPathSpendText:
+		*p = KeyPathSpend
+	case recoveryPathSpendText:
+		*p = RecoveryPathSpend
+	default:
+		return fmt.Errorf("invalid spend path %q; expecting %q or %q", text, keyPathSpendText, recoveryPathSpendText)
+	}
+	return nil
+}
+
+// LeafyInputWeight is the weight of an input spending a Leafy address via 'path', including its final witness. The
+// recovery path is that of the DefaultWalletConfig's timelock; see LeafyRecoveryInputWeight for other timelocks.
+func LeafyInputWeight(path SpendPath) int64 {
+	return leafyInputWeight(path, 0)
+}
+
+// LeafyRecoveryInputWeight is the weight of an input spending a Leafy address, of 'timelock', via the recovery path
+func LeafyRecoveryInputWeight(timelock uint32) int64 {
+	return leafyInputWeight(RecoveryPathSpend, timelock)
+}
+
+// leafyInputWeight is LeafyInputWeight of a recovery path with 'timelock', the DefaultWalletConfig's if zero
+func leafyInputWeight(path SpendPath, timelock uint32) int64 {
+	if path == RecoveryPathSpend {
+		return txInNonWitnessWeight + int64(witnessSize(placeholderWitness(path, timelock)))
+	}
+	return p2trKeyPathInputWeight
+}
+
+// placeholderWitness is a zeroed witness with the exact shape of the signed witness of 'path' (and, for the recovery
+// path, 'timelock'; the DefaultWalletConfig's if zero)
+func placeholderWitness(path SpendPath, timelock uint32) wire.TxWitness {
+	if path == RecoveryPathSpend {
+		return wire.TxWitness{
+			make([]byte, schnorrSignatureLen),
+			make([]byte, recoveryLeafScriptLen(timelock)),
+			make([]byte, leafyControlBlockLen),
+		}
+	}
+	return wire.TxWitness{make([]byte, schnorrSignatureLen)}
+}
+
+// recoveryLeafScriptLen is the length of the "and_v(v:pk(key),older(timelock))" leaf script of a Leafy address
+func recoveryLeafScriptLen(timelock uint32) int {
+	if timelock == 0 {
+		timelock = DefaultWalletConfig().Timelock
+	}
+	// the x-only key push and OP_CHECKSIGVERIFY
+	length := 1 + 32 + 1
+	timelockScript, err := AugmentWithTimelock(int64(timelock), nil)
+	if err != nil {
+		// only possible for scripts larger than the maximum script size
+		return length
+	}
+	return length + len(timelockScript)
+}
+
+func witnessSize(witness wire.TxWitness) int {
+	size := wire.VarIntSerializeSize(uint64(len(witness)))
+	for _, item := range witness {
+		size += wire.VarIntSerializeSize(uint64(len(item))) + len(item)
+	}
+	return size
+}
+
+// WeightEstimator estimates the weight of a signed transaction spending Leafy addresses prior to it being signed.
+// The zero value is an empty transaction.
+type WeightEstimator struct {
+	// Timelock is that of the recovery path of the Leafy addresses spent, the DefaultWalletConfig's if zero
+	Timelock      uint32
+	inputs        int
+	outputs       int
+	elementWeight int64
+}
+
+// AddLeafyInput adds an input spending a Leafy address via 'path'
+func (e *WeightEstimator) AddLeafyInput(path SpendPath) *WeightEstimator {
+	e.inputs++
+	e.elementWeight += leafyInputWeight(path, e.Timelock)
+	return e
+}
+
+// AddOutput adds an output paying to 'script'
+func (e *WeightEstimator) AddOutput(script []byte) *WeightEstimator {
+	e.outputs++
+	e.elementWeight += outputWeight(script)
+	return e
+}
+
+// Weight is the estimated weight of the transaction
+func (e *WeightEstimator) Weight() int64 {
+	// version and locktime plus the input and output counts
+	base := 4 + wire.VarIntSerializeSize(uint64(e.inputs)) + wire.VarIntSerializeSize(uint64(e.outputs)) + 4
+	// segwit marker and flag
+	return int64(4*base+2) + e.elementWeight
+}
+
+// VSize is the estimated virtual size of the transaction, in vBytes
+func (e *WeightEstimator) VSize() int64 {
+	return (e.Weight() + 3) / 4
+}
+
+// Fee is the fee, in sats, needed for the transaction to pay 'feeRate' sat/vByte
+func (e *WeightEstimator) Fee(feeRate float64) int64 {
+	return feeForWeight(e.Weight(), feeRate)
+}
+
+// outputWeight is the weight of an output paying to 'script'
+func outputWeight(script []byte) int64 {
+	return int64(4 * (8 + wire.VarIntSerializeSize(uint64(len(script))) + len(script)))
+}
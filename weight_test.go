@@ -0,0 +1,111 @@
+package leafy_test
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/stretchr/testify/require"
+	"leafy"
+	"testing"
+)
+
+func TestWeightEstimator(t *testing.T) {
+	addr, err := btcutil.DecodeAddress("bcrt1pkm32th8q6qhhnx5l5qmf7v3s29fsdsytl5h69c05chgz9mf4yl2qwnyzzk", &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	script, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+
+	estimator := &leafy.WeightEstimator{}
+	estimator.AddLeafyInput(leafy.KeyPathSpend).AddOutput(script)
+	require.EqualValues(t, 444, estimator.Weight())
+	require.EqualValues(t, 111, estimator.VSize())
+	require.EqualValues(t, 222, estimator.Fee(2))
+	estimator.AddOutput(script)
+	require.EqualValues(t, 154, estimator.VSize())
+
+	// signature, leaf script (with the default 3 byte timelock) and control block
+	require.EqualValues(t, 4*41+1+65+40+34, leafy.LeafyInputWeight(leafy.RecoveryPathSpend))
+	require.True(t, leafy.LeafyInputWeight(leafy.RecoveryPathSpend) > leafy.LeafyInputWeight(leafy.KeyPathSpend))
+	// a small timelock is a single op code
+	require.EqualValues(t, 4*41+1+65+37+34, leafy.LeafyRecoveryInputWeight(10))
+	require.EqualValues(t, 4*41+1+65+37+34, leafy.LeafyRecoveryInputWeight(16))
+	require.EqualValues(t, 4*41+1+65+40+34, leafy.LeafyRecoveryInputWeight(0xffff))
+	// the estimator's recovery inputs are of its Timelock
+	small := (&leafy.WeightEstimator{Timelock: 16}).AddLeafyInput(leafy.RecoveryPathSpend).Weight()
+	large := (&leafy.WeightEstimator{Timelock: 0xffff}).AddLeafyInput(leafy.RecoveryPathSpend).Weight()
+	require.EqualValues(t, 3, large-small)
+}
+
+func TestEstimatedWeightOfConfiguredTimelock(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.NewWalletWithConfig(seedMnemonic, seedMnemonic, &leafy.WalletConfig{Timelock: 10})
+	require.NoError(t, err)
+	utxos, destAddress := createWalletUtxos(t, params, wallet, 10000, 20000)
+
+	signed, err := leafy.CreateAndSignRecoveryTransaction(params, wallet, utxos, destAddress, destAddress, 25000, 3)
+	require.NoError(t, err)
+	requireValidWitnesses(t, signed.Msg, utxos)
+	fee := utxos[0].Amount + utxos[1].Amount
+	for _, txOut := range signed.Msg.TxOut {
+		fee -= txOut.Value
+	}
+	// the fee is that of the signed transaction, whose leaf script has a single op code timelock
+	vSize := (blockchain.GetTransactionWeight(btcutil.NewTx(signed.Msg)) + 3) / 4
+	require.True(t, fee >= 3*vSize)
+	require.True(t, fee < 3*(vSize+1))
+}
+
+func TestEstimatedWeightMatchesSigned(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	wallet, err := leafy.CreateNewWallet()
+	require.NoError(t, err)
+	utxos, destAddress := createWalletUtxos(t, params, wallet, 10000, 20000, 30000)
+	descriptor, err := wallet.GetSecondDescriptor(params)
+	require.NoError(t, err)
+	recoveryWallet := leafy.NewRecoveryWallet(wallet.GetFirstMnemonic(), descriptor)
+
+	for _, amount := range []int64{0, 25000} {
+		tx, err := leafy.CreateTransaction(utxos, destAddress, destAddress, amount, 3)
+		require.NoError(t, err)
+		signed, err := leafy.SignTransaction(params, wallet, tx)
+		require.NoError(t, err)
+		requireValidWitnesses(t, signed.Msg, utxos)
+		requireEstimatedWeight(t, tx, signed, 3)
+
+		recoveryTx, err := leafy.CreateRecoveryTransaction(utxos, destAddress, destAddress, amount, 3)
+		require.NoError(t, err)
+		require.True(t, recoveryTx.TxFeeAmt > tx.TxFeeAmt)
+		recoverySigned, err := leafy.SignRecoveryTransaction(params, recoveryWallet, recoveryTx)
+		require.NoError(t, err)
+		requireValidWitnesses(t, recoverySigned.Msg, utxos)
+		requireEstimatedWeight(t, recoveryTx, recoverySigned, 3)
+	}
+}
+
+func TestCreateTransactionChangeCannotPayForOutput(t *testing.T) {
+	addr, err := btcutil.DecodeAddress("bcrt1pkm32th8q6qhhnx5l5qmf7v3s29fsdsytl5h69c05chgz9mf4yl2qwnyzzk", &chaincfg.RegressionNetParams)
+	require.NoError(t, err)
+	utxos := createSelectionUtxos(100, 1000, 20, 20)
+	tx, err := leafy.CreateTransaction(utxos, addr, addr, 850, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, len(tx.MsgTx.TxIn))
+	require.EqualValues(t, 1, len(tx.MsgTx.TxOut))
+	require.EqualValues(t, int64(1140), tx.TxInputAmt)
+	require.EqualValues(t, int64(290), tx.TxFeeAmt)
+	require.EqualValues(t, int64(0), tx.TxChangeAmt)
+
+	// spend-all which cannot cover the fee
+	_, err = leafy.CreateTransaction(createSelectionUtxos(100), addr, addr, 0, 1)
+	require.Error(t, err)
+}
+
+// requireEstimatedWeight asserts the unsigned 'tx' has the weight of 'signed' and that 'feeRate' is paid
+func requireEstimatedWeight(t *testing.T, tx *leafy.TransactionInfo, signed *leafy.SignedMsg, feeRate int64) {
+	t.Helper()
+	signedWeight := blockchain.GetTransactionWeight(btcutil.NewTx(signed.Msg))
+	require.EqualValues(t, signedWeight, blockchain.GetTransactionWeight(btcutil.NewTx(tx.MsgTx)))
+	vSize := (signedWeight + 3) / 4
+	require.True(t, tx.TxFeeAmt >= feeRate*vSize)
+	require.True(t, tx.TxFeeAmt < feeRate*(vSize+1))
+}